@@ -2,10 +2,16 @@ package announcer
 
 import (
 	"context"
-	"strconv"
+	"fmt"
+	"net"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	apb "google.golang.org/protobuf/types/known/anypb"
 )
 
@@ -16,78 +22,262 @@ type GoBGPServer interface {
 
 type Announcer interface {
 	Announce(ctx context.Context) error
+	Degrade(ctx context.Context) error
 	Denounce(ctx context.Context) error
 }
 
+// MEDSetter is implemented by announcers able to change MED of the announced
+// routes on the fly.
+type MEDSetter interface {
+	SetMED(ctx context.Context, med uint32) error
+}
+
+// retryBackoff is the delays between the attempts to apply the change to
+// the failed prefixes.
+var retryBackoff = []time.Duration{
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	400 * time.Millisecond,
+}
+
+// PrefixResult is the outcome of the change applied to the single prefix.
+type PrefixResult struct {
+	Prefix string
+	Err    error
+}
+
+// PartialError is returned when the change is not applied to some of the
+// prefixes. Results contain the outcome of every prefix of the service.
+type PartialError struct {
+	Results []PrefixResult
+}
+
+// Failed returns the results of the failed prefixes.
+func (e *PartialError) Failed() []PrefixResult {
+	out := []PrefixResult{}
+	for _, r := range e.Results {
+		if r.Err != nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (e *PartialError) Error() string {
+	failed := e.Failed()
+
+	msgs := make([]string, 0, len(failed))
+	for _, r := range failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", r.Prefix, r.Err))
+	}
+
+	return fmt.Sprintf("change is not applied to %d of %d prefixes: %s", len(failed), len(e.Results), strings.Join(msgs, "; "))
+}
+
+type state int
+
+const (
+	stateWithdrawn state = iota
+	stateAnnounced
+	stateDegraded
+)
+
+// Route is a prefix to announce with the communities attached to it.
+type Route struct {
+	Prefix              string
+	Communities         []string
+	LargeCommunities    []string
+	ExtendedCommunities []string
+}
+
+// Degraded defines how routes are made less preferred while the service is
+// degraded.
+type Degraded struct {
+	ASPathPrepend    uint32
+	MED              uint32
+	Communities      []string
+	LargeCommunities []string
+}
+
 type Config struct {
-	GoBGP    GoBGPServer
-	Prefixes []string
-	NextHop  string
-	LocalASN uint32
+	Name        string
+	Registry    *Registry
+	Routes      []Route
+	NextHop     string
+	NextHopIPv6 string
+	Degraded    Degraded
+
+	// ExtendedNextHop allows IPv4 routes to be announced over IPv6 next
+	// hop (RFC 5549) when no IPv4 next hop is configured.
+	ExtendedNextHop bool
+
+	// VRF makes the routes announced into the VRF instead of the global
+	// routing table.
+	VRF *VRF
 }
 
 type announcer struct {
-	gobgp    GoBGPServer
-	prefixes []string
-	nextHop  string
-	localASN uint32
+	name        string
+	registry    *Registry
+	routes      []Route
+	nextHop     string
+	nextHopIPv6 string
+	degraded    Degraded
+
+	extendedNextHop bool
+	vrf             *VRF
+
+	mutex *sync.Mutex
+	state state
+	med   uint32
 }
 
+// New creates announcer for the service defined by Name. All of the route
+// prefixes are registered in the registry as owned by the service.
 func New(cfg Config) Announcer {
-	return &announcer{
-		gobgp:    cfg.GoBGP,
-		prefixes: cfg.Prefixes,
-		nextHop:  cfg.NextHop,
-		localASN: cfg.LocalASN,
+	a := &announcer{
+		name:        cfg.Name,
+		registry:    cfg.Registry,
+		routes:      cfg.Routes,
+		nextHop:     cfg.NextHop,
+		nextHopIPv6: cfg.NextHopIPv6,
+		degraded:    cfg.Degraded,
+
+		extendedNextHop: cfg.ExtendedNextHop,
+		vrf:             cfg.VRF,
+
+		mutex: &sync.Mutex{},
+		state: stateWithdrawn,
+	}
+
+	for _, route := range cfg.Routes {
+		cfg.Registry.Register(cfg.Name, a.prefixKey(route))
 	}
+
+	return a
 }
 
 func (a *announcer) Announce(ctx context.Context) error {
-	pp, err := a.newPathList()
-	if err != nil {
-		return err
-	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 
-	for _, p := range pp {
-		_, err = a.gobgp.AddPath(ctx, &api.AddPathRequest{
-			Path: p,
-		})
-		if err != nil {
-			return err
-		}
+	a.state = stateAnnounced
+	return a.announce(ctx)
+}
+
+// Degrade announces routes with the attributes making them less preferred
+// so the node stays as a backup path.
+func (a *announcer) Degrade(ctx context.Context) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.state = stateDegraded
+	return a.announce(ctx)
+}
+
+// SetMED sets MED for the routes and re-announces them if they're announced.
+func (a *announcer) SetMED(ctx context.Context, med uint32) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.med == med {
+		return nil
 	}
 
-	return nil
+	a.med = med
+	if a.state == stateWithdrawn {
+		return nil
+	}
+	return a.announce(ctx)
 }
 
-func (a *announcer) Denounce(ctx context.Context) error {
-	pp, err := a.newPathList()
+func (a *announcer) announce(ctx context.Context) error {
+	pp, err := a.newPathList(a.state == stateDegraded)
 	if err != nil {
 		return err
 	}
 
-	for _, p := range pp {
-		err := a.gobgp.DeletePath(ctx, &api.DeletePathRequest{
-			Path: p,
-		})
-		if err != nil {
-			return err
+	return applyRoutes(ctx, a.name, a.routes, func(i int) error {
+		return a.registry.Announce(ctx, a.name, a.prefixKey(a.routes[i]), pp[i], a.state == stateDegraded)
+	})
+}
+
+func (a *announcer) Denounce(ctx context.Context) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.state = stateWithdrawn
+	return applyRoutes(ctx, a.name, a.routes, func(i int) error {
+		return a.registry.Withdraw(ctx, a.name, a.prefixKey(a.routes[i]))
+	})
+}
+
+// prefixKey returns the key the route is kept by in the registry. Routes of
+// the VRF are distinguished by the route distinguisher.
+func (a *announcer) prefixKey(route Route) string {
+	if a.vrf != nil {
+		return vrfPrefixKey(a.vrf.RD, route.Prefix)
+	}
+	return route.Prefix
+}
+
+// applyRoutes calls fn for every route of the service and retries the failed
+// ones with backoff. The change is applied to as many prefixes as possible,
+// *PartialError with the outcome of every prefix is returned if some of them
+// are still failed after the retries.
+func applyRoutes(ctx context.Context, name string, routes []Route, fn func(i int) error) error {
+	results := make([]PrefixResult, len(routes))
+	pending := make([]int, len(routes))
+	for i, route := range routes {
+		results[i].Prefix = route.Prefix
+		pending[i] = i
+	}
+
+	for attempt := 0; ; attempt++ {
+		failed := []int{}
+		for _, i := range pending {
+			results[i].Err = fn(i)
+			if results[i].Err != nil {
+				failed = append(failed, i)
+			}
+		}
+
+		if len(failed) == 0 {
+			return nil
+		}
+
+		if attempt == len(retryBackoff) {
+			return &PartialError{Results: results}
 		}
+
+		log.WithFields(log.Fields{
+			"service": name,
+			"failed":  len(failed),
+			"attempt": attempt + 1,
+		}).Debugf("retrying failed prefixes in %s", retryBackoff[attempt])
+
+		select {
+		case <-ctx.Done():
+			return &PartialError{Results: results}
+		case <-time.After(retryBackoff[attempt]):
+		}
+
+		pending = failed
 	}
-	return nil
 }
 
-func (a *announcer) newPathList() ([]*api.Path, error) {
+func (a *announcer) newPathList(degraded bool) ([]*api.Path, error) {
 	prefixes := []*api.Path{}
-	for _, p := range a.prefixes {
-		l := strings.SplitN(p, "/", 2)
-		prefixLen, err := strconv.ParseUint(l[1], 10, 32)
+	for _, route := range a.routes {
+		p := route.Prefix
+		ip, ipNet, err := net.ParseCIDR(p)
 		if err != nil {
 			return nil, err
 		}
+		prefixLen, _ := ipNet.Mask.Size()
 
 		nlri, err := apb.New(&api.IPAddressPrefix{
-			Prefix:    l[0],
+			Prefix:    ipNet.IP.String(),
 			PrefixLen: uint32(prefixLen),
 		})
 		if err != nil {
@@ -101,17 +291,85 @@ func (a *announcer) newPathList() ([]*api.Path, error) {
 			return nil, err
 		}
 
-		a2, err := apb.New(&api.NextHopAttribute{
-			NextHop: a.nextHop,
-		})
+		family := &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST}
+
+		var a2 *apb.Any
+		switch {
+		case a.vrf != nil:
+			family, nlri, a2, err = a.newVRFReach(p, ipNet)
+		case ip.To4() != nil && a.nextHop != "":
+			a2, err = apb.New(&api.NextHopAttribute{
+				NextHop: a.nextHop,
+			})
+		case ip.To4() != nil:
+			if !a.extendedNextHop || a.nextHopIPv6 == "" {
+				return nil, errors.Errorf("no IPv4 next hop is configured for `%s`", p)
+			}
+
+			// IPv4 routes over IPv6 next hop (RFC 5549) are carried in
+			// MP_REACH_NLRI as well, the peer must have negotiated the
+			// extended next hop capability
+			a2, err = apb.New(&api.MpReachNLRIAttribute{
+				Family:   family,
+				NextHops: []string{a.nextHopIPv6},
+				Nlris:    []*apb.Any{nlri},
+			})
+		default:
+			if a.nextHopIPv6 == "" {
+				return nil, errors.Errorf("no IPv6 next hop is configured for `%s`", p)
+			}
+
+			// IPv6 routes are carried in MP_REACH_NLRI (RFC 4760) since
+			// NEXT_HOP attribute could hold IPv4 address only
+			family = &api.Family{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_UNICAST}
+			a2, err = apb.New(&api.MpReachNLRIAttribute{
+				Family:   family,
+				NextHops: []string{a.nextHopIPv6},
+				Nlris:    []*apb.Any{nlri},
+			})
+		}
 		if err != nil {
 			return nil, err
 		}
 
 		attrs := []*apb.Any{a1, a2}
 
+		if degraded {
+			route.Communities = append(slices.Clone(route.Communities), a.degraded.Communities...)
+			route.LargeCommunities = append(slices.Clone(route.LargeCommunities), a.degraded.LargeCommunities...)
+
+			// AS path is prepended by the export policy with the local AS
+			// of each session
+			if a.degraded.ASPathPrepend > 0 {
+				route.LargeCommunities = append(route.LargeCommunities, DegradedPrependCommunity(a.degraded.ASPathPrepend))
+			}
+		}
+
+		if med := a.routeMED(degraded); med > 0 {
+			medAttr, err := apb.New(&api.MultiExitDiscAttribute{
+				Med: med,
+			})
+			if err != nil {
+				return nil, err
+			}
+			attrs = append(attrs, medAttr)
+		}
+
+		if a.vrf != nil {
+			route.ExtendedCommunities = slices.Clone(route.ExtendedCommunities)
+			for _, rt := range a.vrf.ExportRTs {
+				route.ExtendedCommunities = append(route.ExtendedCommunities, "rt:"+rt)
+			}
+		}
+
+		communityAttrs, err := newCommunityAttributes(route)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, communityAttrs...)
+
 		prefixes = append(prefixes, &api.Path{
-			Family: &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+			Family: family,
 			Nlri:   nlri,
 			Pattrs: attrs,
 		})
@@ -119,3 +377,75 @@ func (a *announcer) newPathList() ([]*api.Path, error) {
 
 	return prefixes, nil
 }
+
+// routeMED returns MED for the routes: the dynamic one set via SetMED or the
+// degraded one while the service is degraded whichever is higher.
+func (a *announcer) routeMED(degraded bool) uint32 {
+	if degraded && a.degraded.MED > a.med {
+		return a.degraded.MED
+	}
+	return a.med
+}
+
+func newCommunityAttributes(route Route) ([]*apb.Any, error) {
+	attrs := []*apb.Any{}
+
+	if len(route.Communities) > 0 {
+		communities := []uint32{}
+		for _, c := range route.Communities {
+			v, err := ParseCommunity(c)
+			if err != nil {
+				return nil, err
+			}
+			communities = append(communities, v)
+		}
+
+		attr, err := apb.New(&api.CommunitiesAttribute{
+			Communities: communities,
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	if len(route.LargeCommunities) > 0 {
+		communities := []*api.LargeCommunity{}
+		for _, c := range route.LargeCommunities {
+			v, err := ParseLargeCommunity(c)
+			if err != nil {
+				return nil, err
+			}
+			communities = append(communities, v)
+		}
+
+		attr, err := apb.New(&api.LargeCommunitiesAttribute{
+			Communities: communities,
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	if len(route.ExtendedCommunities) > 0 {
+		communities := []*apb.Any{}
+		for _, c := range route.ExtendedCommunities {
+			v, err := ParseExtendedCommunity(c)
+			if err != nil {
+				return nil, err
+			}
+			communities = append(communities, v)
+		}
+
+		attr, err := apb.New(&api.ExtendedCommunitiesAttribute{
+			Communities: communities,
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	return attrs, nil
+}
@@ -3,8 +3,12 @@ package announcer
 import (
 	"context"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -32,8 +36,9 @@ func TestAnnouncer(t *testing.T) {
 	).Return(nil).NotBefore(call1).Once()
 
 	a := New(Config{
-		GoBGP:    goBgpM,
-		Prefixes: []string{"172.16.38.43/32"},
+		Name:     "test_service",
+		Registry: NewRegistry(goBgpM, SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32"),
 		NextHop:  "172.12.33.14",
 	})
 
@@ -42,4 +47,353 @@ func TestAnnouncer(t *testing.T) {
 
 	err = a.Denounce(context.Background())
 	r.NoError(err)
+
+	goBgpM.AssertExpectations(t)
+}
+
+func TestNewPathListDualStack(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:        "test_service",
+		Registry:    NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes:      routesOf("172.16.38.43/32", "2001:db8::43/128"),
+		NextHop:     "172.12.33.14",
+		NextHopIPv6: "2001:db8::14",
+	}).(*announcer)
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	r.Len(pp, 2)
+
+	r.Equal(api.Family_AFI_IP, pp[0].Family.Afi)
+	nh := &api.NextHopAttribute{}
+	r.NoError(pp[0].Pattrs[1].UnmarshalTo(nh))
+	r.Equal("172.12.33.14", nh.NextHop)
+
+	r.Equal(api.Family_AFI_IP6, pp[1].Family.Afi)
+	nlri := &api.IPAddressPrefix{}
+	r.NoError(pp[1].Nlri.UnmarshalTo(nlri))
+	r.Equal("2001:db8::43", nlri.Prefix)
+	r.Equal(uint32(128), nlri.PrefixLen)
+
+	mpReach := &api.MpReachNLRIAttribute{}
+	r.NoError(pp[1].Pattrs[1].UnmarshalTo(mpReach))
+	r.Equal([]string{"2001:db8::14"}, mpReach.NextHops)
+	r.Equal(api.Family_AFI_IP6, mpReach.Family.Afi)
+}
+
+func TestNewPathListNoNextHop(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes:   routesOf("2001:db8::43/128"),
+		NextHop:  "172.12.33.14",
+	}).(*announcer)
+
+	_, err := a.newPathList(false)
+	r.Error(err)
+	r.Equal("no IPv6 next hop is configured for `2001:db8::43/128`", err.Error())
+}
+
+func TestNewPathListExtendedNextHop(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:            "test_service",
+		Registry:        NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes:          routesOf("172.16.38.43/32"),
+		NextHopIPv6:     "2001:db8::14",
+		ExtendedNextHop: true,
+	}).(*announcer)
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	r.Len(pp, 1)
+
+	r.Equal(api.Family_AFI_IP, pp[0].Family.Afi)
+	mpReach := &api.MpReachNLRIAttribute{}
+	r.NoError(pp[0].Pattrs[1].UnmarshalTo(mpReach))
+	r.Equal(api.Family_AFI_IP, mpReach.Family.Afi)
+	r.Equal([]string{"2001:db8::14"}, mpReach.NextHops)
+
+	nlri := &api.IPAddressPrefix{}
+	r.NoError(mpReach.Nlris[0].UnmarshalTo(nlri))
+	r.Equal("172.16.38.43", nlri.Prefix)
+	r.Equal(uint32(32), nlri.PrefixLen)
+
+	// IPv4 next hop is preferred when configured
+	a.nextHop = "172.12.33.14"
+	pp, err = a.newPathList(false)
+	r.NoError(err)
+
+	nh := &api.NextHopAttribute{}
+	r.NoError(pp[0].Pattrs[1].UnmarshalTo(nh))
+	r.Equal("172.12.33.14", nh.NextHop)
+
+	// IPv6 next hop isn't used for IPv4 routes unless enabled
+	a.nextHop = ""
+	a.extendedNextHop = false
+	_, err = a.newPathList(false)
+	r.Error(err)
+	r.Equal("no IPv4 next hop is configured for `172.16.38.43/32`", err.Error())
+}
+
+func TestExtendedNextHopAdjRIBOut(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	srv := newTestPeering(t)
+
+	a := New(Config{
+		Name:            "test_service",
+		Registry:        NewRegistry(srv, SharePolicyAny),
+		Routes:          routesOf("172.16.38.43/32"),
+		NextHopIPv6:     "2001:db8::14",
+		ExtendedNextHop: true,
+	})
+	r.NoError(a.Announce(ctx))
+
+	r.Eventually(func() bool {
+		nextHops := []string{}
+		r.NoError(srv.ListPath(ctx, &api.ListPathRequest{
+			TableType: api.TableType_ADJ_OUT,
+			Name:      "127.0.0.2",
+			Family:    &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+		}, func(d *api.Destination) {
+			for _, p := range d.GetPaths() {
+				for _, attr := range p.GetPattrs() {
+					mpReach := &api.MpReachNLRIAttribute{}
+					if attr.UnmarshalTo(mpReach) == nil {
+						nextHops = append(nextHops, mpReach.GetNextHops()...)
+					}
+				}
+			}
+		}))
+		return len(nextHops) == 1 && nextHops[0] == "2001:db8::14"
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestNewPathListCommunities(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes: []Route{
+			{
+				Prefix:              "172.16.38.43/32",
+				Communities:         []string{"65000:100", "no-export"},
+				LargeCommunities:    []string{"65000:1:2"},
+				ExtendedCommunities: []string{"rt:65000:100"},
+			},
+			{
+				Prefix: "172.16.38.44/32",
+			},
+		},
+		NextHop: "172.12.33.14",
+	}).(*announcer)
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	r.Len(pp, 2)
+	r.Len(pp[0].Pattrs, 5)
+	r.Len(pp[1].Pattrs, 2)
+
+	communities := &api.CommunitiesAttribute{}
+	r.NoError(pp[0].Pattrs[2].UnmarshalTo(communities))
+	r.Equal([]uint32{65000<<16 | 100, 0xFFFFFF01}, communities.Communities)
+
+	largeCommunities := &api.LargeCommunitiesAttribute{}
+	r.NoError(pp[0].Pattrs[3].UnmarshalTo(largeCommunities))
+	r.Len(largeCommunities.Communities, 1)
+	r.Equal(uint32(65000), largeCommunities.Communities[0].GlobalAdmin)
+
+	extendedCommunities := &api.ExtendedCommunitiesAttribute{}
+	r.NoError(pp[0].Pattrs[4].UnmarshalTo(extendedCommunities))
+	r.Len(extendedCommunities.Communities, 1)
+}
+
+func routesOf(prefixes ...string) []Route {
+	routes := []Route{}
+	for _, prefix := range prefixes {
+		routes = append(routes, Route{Prefix: prefix})
+	}
+	return routes
+}
+
+func TestNewPathListDegraded(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes: []Route{
+			{
+				Prefix:      "172.16.38.43/32",
+				Communities: []string{"65000:100"},
+			},
+		},
+		NextHop: "172.12.33.14",
+		Degraded: Degraded{
+			ASPathPrepend: 3,
+			MED:           500,
+			Communities:   []string{"65000:50"},
+		},
+	}).(*announcer)
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	r.Len(pp[0].Pattrs, 3)
+
+	pp, err = a.newPathList(true)
+	r.NoError(err)
+	r.Len(pp[0].Pattrs, 5)
+
+	med := &api.MultiExitDiscAttribute{}
+	r.NoError(pp[0].Pattrs[2].UnmarshalTo(med))
+	r.Equal(uint32(500), med.Med)
+
+	communities := &api.CommunitiesAttribute{}
+	r.NoError(pp[0].Pattrs[3].UnmarshalTo(communities))
+	r.Equal([]uint32{65000<<16 | 100, 65000<<16 | 50}, communities.Communities)
+
+	// AS path is prepended by the export policy matching the marker
+	largeCommunities := &api.LargeCommunitiesAttribute{}
+	r.NoError(pp[0].Pattrs[4].UnmarshalTo(largeCommunities))
+	r.Equal([]*api.LargeCommunity{{GlobalAdmin: 4294967295, LocalData1: 0, LocalData2: 3}}, largeCommunities.Communities)
+
+	// degraded communities must not leak into the route definition
+	r.Equal([]string{"65000:100"}, a.routes[0].Communities)
+}
+
+func TestDegradeReannouncesPath(t *testing.T) {
+	r := require.New(t)
+
+	goBgpM := newGoBGPMock()
+	matcher := mock.MatchedBy(func(in string) bool {
+		return reProtoString.MatchString(in)
+	})
+	goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).Times(3)
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(goBgpM, SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32"),
+		NextHop:  "172.12.33.14",
+		Degraded: Degraded{MED: 500},
+	})
+
+	r.NoError(a.Announce(context.Background()))
+	r.NoError(a.Degrade(context.Background()))
+	r.NoError(a.Degrade(context.Background()))
+	r.NoError(a.Announce(context.Background()))
+
+	goBgpM.AssertExpectations(t)
+}
+
+func TestSetMED(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	goBgpM := newGoBGPMock()
+	matcher := mock.MatchedBy(func(in string) bool {
+		return reProtoString.MatchString(in)
+	})
+	goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).Twice()
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(goBgpM, SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32"),
+		NextHop:  "172.12.33.14",
+		Degraded: Degraded{MED: 500},
+	}).(*announcer)
+
+	// routes are not announced yet so MED is just stored
+	r.NoError(a.SetMED(ctx, 100))
+
+	r.NoError(a.Announce(ctx))
+	r.NoError(a.SetMED(ctx, 100))
+	r.NoError(a.SetMED(ctx, 200))
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	med := &api.MultiExitDiscAttribute{}
+	r.NoError(pp[0].Pattrs[2].UnmarshalTo(med))
+	r.Equal(uint32(200), med.Med)
+
+	// degraded MED is used when it's higher than dynamic one
+	pp, err = a.newPathList(true)
+	r.NoError(err)
+	r.NoError(pp[0].Pattrs[2].UnmarshalTo(med))
+	r.Equal(uint32(500), med.Med)
+
+	goBgpM.AssertExpectations(t)
+}
+
+func TestAnnounceRetriesFailedPrefixes(t *testing.T) {
+	r := require.New(t)
+
+	retryBackoff = []time.Duration{time.Millisecond, time.Millisecond}
+
+	goBgpM := newGoBGPMock()
+
+	second := func(in string) bool {
+		return strings.Contains(in, `"172.16.38.44"`)
+	}
+
+	goBgpM.On("AddPath", mock.MatchedBy(reProtoString.MatchString)).Return([]byte("1"), nil).Once()
+	call1 := goBgpM.On("AddPath", mock.MatchedBy(second)).Return([]byte{}, errors.New("error")).Once()
+	goBgpM.On("AddPath", mock.MatchedBy(second)).Return([]byte("2"), nil).NotBefore(call1).Once()
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(goBgpM, SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32", "172.16.38.44/32"),
+		NextHop:  "172.12.33.14",
+	})
+
+	r.NoError(a.Announce(context.Background()))
+
+	goBgpM.AssertExpectations(t)
+}
+
+func TestAnnouncePartialError(t *testing.T) {
+	r := require.New(t)
+
+	retryBackoff = []time.Duration{time.Millisecond, time.Millisecond}
+
+	errAddPath := errors.New("error")
+
+	goBgpM := newGoBGPMock()
+
+	second := func(in string) bool {
+		return strings.Contains(in, `"172.16.38.44"`)
+	}
+
+	goBgpM.On("AddPath", mock.MatchedBy(reProtoString.MatchString)).Return([]byte("1"), nil).Once()
+	goBgpM.On("AddPath", mock.MatchedBy(second)).Return([]byte{}, errAddPath).Times(3)
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(goBgpM, SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32", "172.16.38.44/32"),
+		NextHop:  "172.12.33.14",
+	})
+
+	err := a.Announce(context.Background())
+	r.Error(err)
+	r.Equal("change is not applied to 1 of 2 prefixes: 172.16.38.44/32: error", err.Error())
+
+	var partialErr *PartialError
+	r.ErrorAs(err, &partialErr)
+	r.Equal([]PrefixResult{
+		{Prefix: "172.16.38.43/32"},
+		{Prefix: "172.16.38.44/32", Err: errAddPath},
+	}, partialErr.Results)
+
+	goBgpM.AssertExpectations(t)
 }
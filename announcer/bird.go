@@ -0,0 +1,188 @@
+package announcer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBIRDSocket is the default path of BIRD 2 control socket.
+	DefaultBIRDSocket = "/run/bird/bird.ctl"
+
+	// DefaultBIRDTimeout is the default timeout of BIRD control socket
+	// session.
+	DefaultBIRDTimeout = 5 * time.Second
+)
+
+// BIRDConfig defines the BIRD protocols the service routes are announced by.
+// Protocol (e.g. static protocol with the service routes) is enabled while
+// the service is healthy. DegradedProtocol, if set, is enabled instead while
+// the service is degraded, so BIRD announces the routes with the attributes
+// set by its filters since there's no way to change the route attributes
+// via control socket.
+type BIRDConfig struct {
+	Name             string
+	Socket           string
+	Protocol         string
+	DegradedProtocol string
+	Timeout          time.Duration
+}
+
+type birdAnnouncer struct {
+	name             string
+	socket           string
+	protocol         string
+	degradedProtocol string
+	timeout          time.Duration
+
+	mutex *sync.Mutex
+}
+
+// NewBIRD creates announcer enabling and disabling BIRD protocols via BIRD
+// control socket.
+func NewBIRD(cfg BIRDConfig) Announcer {
+	if cfg.Socket == "" {
+		cfg.Socket = DefaultBIRDSocket
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultBIRDTimeout
+	}
+
+	return &birdAnnouncer{
+		name:             cfg.Name,
+		socket:           cfg.Socket,
+		protocol:         cfg.Protocol,
+		degradedProtocol: cfg.DegradedProtocol,
+		timeout:          cfg.Timeout,
+
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (b *birdAnnouncer) Announce(ctx context.Context) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	commands := []string{"enable " + b.protocol}
+	if b.degradedProtocol != "" {
+		commands = append(commands, "disable "+b.degradedProtocol)
+	}
+	return b.run(ctx, commands...)
+}
+
+// Degrade enables the degraded protocol before disabling the regular one so
+// the routes are not withdrawn in between. The routes stay announced by the
+// regular protocol if there's no degraded one.
+func (b *birdAnnouncer) Degrade(ctx context.Context) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.degradedProtocol == "" {
+		return b.run(ctx, "enable "+b.protocol)
+	}
+	return b.run(ctx, "enable "+b.degradedProtocol, "disable "+b.protocol)
+}
+
+func (b *birdAnnouncer) Denounce(ctx context.Context) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	commands := []string{"disable " + b.protocol}
+	if b.degradedProtocol != "" {
+		commands = append(commands, "disable "+b.degradedProtocol)
+	}
+	return b.run(ctx, commands...)
+}
+
+// run sends the commands to BIRD over a new control socket session and
+// stops on the first failed one.
+func (b *birdAnnouncer) run(ctx context.Context, commands ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", b.socket)
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to BIRD socket `%s`", b.socket)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return errors.Wrap(err, "error setting BIRD socket deadline")
+		}
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := readBIRDReply(r); err != nil {
+		return errors.Wrap(err, "error reading BIRD greeting")
+	}
+
+	for _, command := range commands {
+		if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+			return errors.Wrapf(err, "error sending `%s` to BIRD", command)
+		}
+
+		if _, err := readBIRDReply(r); err != nil {
+			return errors.Wrapf(err, "error running `%s` on BIRD", command)
+		}
+	}
+	return nil
+}
+
+// BIRDError is the runtime (8xxx) or parse (9xxx) error replied by BIRD.
+type BIRDError struct {
+	Code    int
+	Message string
+}
+
+func (e *BIRDError) Error() string {
+	return fmt.Sprintf("BIRD error %04d: %s", e.Code, e.Message)
+}
+
+// readBIRDReply reads the reply to the command. Each line of the reply starts
+// with the four-digit code followed by `-` if the reply continues or by space
+// on its last line, lines starting with space continue the previous code.
+// Lines of the reply are returned, *BIRDError is returned for the error
+// codes.
+func readBIRDReply(r *bufio.Reader) ([]string, error) {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading reply")
+		}
+		line = strings.TrimRight(line, "\n")
+
+		if strings.HasPrefix(line, " ") {
+			lines = append(lines, line[1:])
+			continue
+		}
+
+		if len(line) < 5 || (line[4] != ' ' && line[4] != '-') {
+			return nil, errors.Errorf("malformed reply line `%s`", line)
+		}
+
+		code, err := strconv.Atoi(line[:4])
+		if err != nil {
+			return nil, errors.Errorf("malformed reply code in `%s`", line)
+		}
+		lines = append(lines, line[5:])
+
+		if line[4] == '-' {
+			continue
+		}
+
+		if code >= 8000 {
+			return nil, &BIRDError{Code: code, Message: strings.Join(lines, "\n")}
+		}
+		return lines, nil
+	}
+}
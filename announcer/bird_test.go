@@ -0,0 +1,234 @@
+package announcer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBIRD is BIRD control socket server keeping the enabled state of the
+// protocols and replying with BIRD reply codes.
+type fakeBIRD struct {
+	socket string
+
+	mutex     *sync.Mutex
+	protocols map[string]bool
+	commands  []string
+}
+
+func newFakeBIRD(t *testing.T, protocols ...string) *fakeBIRD {
+	f := &fakeBIRD{
+		socket:    filepath.Join(t.TempDir(), "bird.ctl"),
+		mutex:     &sync.Mutex{},
+		protocols: map[string]bool{},
+	}
+	for _, p := range protocols {
+		f.protocols[p] = false
+	}
+
+	l, err := net.Listen("unix", f.socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeBIRD) serve(conn net.Conn) {
+	defer conn.Close()
+
+	fmt.Fprint(conn, "0001 BIRD 2.15.1 ready.\n")
+
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		f.mutex.Lock()
+		f.commands = append(f.commands, s.Text())
+		fmt.Fprint(conn, f.reply(s.Text()))
+		f.mutex.Unlock()
+	}
+}
+
+func (f *fakeBIRD) reply(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) != 2 || (fields[0] != "enable" && fields[0] != "disable") {
+		return "9001 syntax error, unexpected CF_SYM_UNDEFINED\n"
+	}
+
+	enabled, ok := f.protocols[fields[1]]
+	if !ok {
+		return "8003 No protocols match\n"
+	}
+
+	switch {
+	case fields[0] == "enable" && enabled:
+		return fmt.Sprintf("0010-%s: already enabled\n0000 \n", fields[1])
+	case fields[0] == "enable":
+		f.protocols[fields[1]] = true
+		return fmt.Sprintf("0011-%s: enabled\n0000 \n", fields[1])
+	case !enabled:
+		return fmt.Sprintf("0008-%s: already disabled\n0000 \n", fields[1])
+	default:
+		f.protocols[fields[1]] = false
+		return fmt.Sprintf("0009-%s: disabled\n0000 \n", fields[1])
+	}
+}
+
+func (f *fakeBIRD) state() (map[string]bool, []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	protocols := map[string]bool{}
+	for k, v := range f.protocols {
+		protocols[k] = v
+	}
+	return protocols, append([]string{}, f.commands...)
+}
+
+func TestBIRDAnnouncer(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	f := newFakeBIRD(t, "anycast_dns", "anycast_dns_degraded")
+
+	a := NewBIRD(BIRDConfig{
+		Name:             "dns",
+		Socket:           f.socket,
+		Protocol:         "anycast_dns",
+		DegradedProtocol: "anycast_dns_degraded",
+	})
+
+	r.NoError(a.Announce(ctx))
+	protocols, commands := f.state()
+	r.Equal(map[string]bool{"anycast_dns": true, "anycast_dns_degraded": false}, protocols)
+	r.Equal([]string{"enable anycast_dns", "disable anycast_dns_degraded"}, commands)
+
+	r.NoError(a.Degrade(ctx))
+	protocols, commands = f.state()
+	r.Equal(map[string]bool{"anycast_dns": false, "anycast_dns_degraded": true}, protocols)
+	r.Equal([]string{"enable anycast_dns_degraded", "disable anycast_dns"}, commands[2:])
+
+	r.NoError(a.Announce(ctx))
+	protocols, _ = f.state()
+	r.Equal(map[string]bool{"anycast_dns": true, "anycast_dns_degraded": false}, protocols)
+
+	r.NoError(a.Denounce(ctx))
+	protocols, _ = f.state()
+	r.Equal(map[string]bool{"anycast_dns": false, "anycast_dns_degraded": false}, protocols)
+}
+
+func TestBIRDAnnouncerWithoutDegradedProtocol(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	f := newFakeBIRD(t, "anycast_dns")
+
+	a := NewBIRD(BIRDConfig{
+		Name:     "dns",
+		Socket:   f.socket,
+		Protocol: "anycast_dns",
+	})
+
+	r.NoError(a.Degrade(ctx))
+	r.NoError(a.Denounce(ctx))
+
+	protocols, commands := f.state()
+	r.Equal(map[string]bool{"anycast_dns": false}, protocols)
+	r.Equal([]string{"enable anycast_dns", "disable anycast_dns"}, commands)
+}
+
+func TestBIRDAnnouncerErrors(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	f := newFakeBIRD(t, "anycast_dns")
+
+	a := NewBIRD(BIRDConfig{
+		Name:             "dns",
+		Socket:           f.socket,
+		Protocol:         "anycast_dns",
+		DegradedProtocol: "anycast_ntp",
+	})
+
+	err := a.Announce(ctx)
+	r.EqualError(err, "error running `disable anycast_ntp` on BIRD: BIRD error 8003: No protocols match")
+
+	var birdErr *BIRDError
+	r.ErrorAs(err, &birdErr)
+	r.Equal(8003, birdErr.Code)
+
+	a = NewBIRD(BIRDConfig{
+		Name:     "dns",
+		Socket:   filepath.Join(t.TempDir(), "missing.ctl"),
+		Protocol: "anycast_dns",
+		Timeout:  time.Second,
+	})
+	r.ErrorContains(a.Announce(ctx), "error connecting to BIRD socket")
+}
+
+func TestReadBIRDReply(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       string
+		expected []string
+		expError string
+	}
+
+	tcs := []testCase{
+		{
+			name:     "single line",
+			in:       "0001 BIRD 2.15.1 ready.\n",
+			expected: []string{"BIRD 2.15.1 ready."},
+		},
+		{
+			name:     "multiple lines",
+			in:       "2002-Name       Proto      Table      State  Since         Info\n1002-anycast_dns Static     master4    up     2024-01-01\n continued\n0000 \n",
+			expected: []string{"Name       Proto      Table      State  Since         Info", "anycast_dns Static     master4    up     2024-01-01", "continued", ""},
+		},
+		{
+			name:     "parse error",
+			in:       "9001 syntax error, unexpected END\n",
+			expError: "BIRD error 9001: syntax error, unexpected END",
+		},
+		{
+			name:     "malformed line",
+			in:       "BIRD\n",
+			expError: "malformed reply line `BIRD`",
+		},
+		{
+			name:     "truncated reply",
+			in:       "0011-anycast_dns: enabled\n",
+			expError: "error reading reply: EOF",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			lines, err := readBIRDReply(bufio.NewReader(strings.NewReader(tc.in)))
+			if tc.expError != "" {
+				r.EqualError(err, tc.expError)
+				return
+			}
+			r.NoError(err)
+			r.Equal(tc.expected, lines)
+		})
+	}
+}
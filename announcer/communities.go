@@ -0,0 +1,189 @@
+package announcer
+
+import (
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	apb "google.golang.org/protobuf/types/known/anypb"
+)
+
+// GracefulShutdownCommunity is GRACEFUL_SHUTDOWN well-known community
+// (RFC 8326) asking the peers to lower the preference of the path.
+const GracefulShutdownCommunity uint32 = 0xFFFF0000
+
+// wellKnownCommunities maps names of the well-known communities to their
+// values as defined by IANA.
+var wellKnownCommunities = map[string]uint32{
+	"graceful-shutdown":   GracefulShutdownCommunity,
+	"blackhole":           0xFFFF029A,
+	"no-export":           0xFFFFFF01,
+	"no-advertise":        0xFFFFFF02,
+	"no-export-subconfed": 0xFFFFFF03,
+	"no-peer":             0xFFFFFF04,
+}
+
+// extendedCommunitySubTypes maps extended community kinds to their
+// subtypes (RFC 4360).
+var extendedCommunitySubTypes = map[string]uint32{
+	"rt":  0x02,
+	"soo": 0x03,
+}
+
+// ParseCommunity parses standard community (RFC 1997) in `ASN:value` format
+// or well-known community name.
+func ParseCommunity(in string) (uint32, error) {
+	if v, ok := wellKnownCommunities[strings.ToLower(in)]; ok {
+		return v, nil
+	}
+
+	parts := strings.Split(in, ":")
+	if len(parts) != 2 {
+		return 0, errors.Errorf("invalid community `%s`: `ASN:value` format expected", in)
+	}
+
+	asn, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return 0, errors.Errorf("invalid community `%s`: ASN must be 16-bit integer", in)
+	}
+
+	value, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return 0, errors.Errorf("invalid community `%s`: value must be 16-bit integer", in)
+	}
+
+	return uint32(asn<<16 | value), nil
+}
+
+// ParseLargeCommunity parses large community (RFC 8092) in
+// `ASN:value1:value2` format.
+func ParseLargeCommunity(in string) (*api.LargeCommunity, error) {
+	parts := strings.Split(in, ":")
+	if len(parts) != 3 {
+		return nil, errors.Errorf("invalid large community `%s`: `ASN:value1:value2` format expected", in)
+	}
+
+	values := make([]uint32, 3)
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid large community `%s`: all parts must be 32-bit integers", in)
+		}
+		values[i] = uint32(v)
+	}
+
+	return &api.LargeCommunity{
+		GlobalAdmin: values[0],
+		LocalData1:  values[1],
+		LocalData2:  values[2],
+	}, nil
+}
+
+// ParseExtendedCommunity parses route target or site of origin extended
+// community (RFC 4360) in `rt:ASN:value`, `rt:IPv4:value`, `soo:ASN:value`
+// or `soo:IPv4:value` format. 4-byte ASN format is used for ASNs not
+// fitting into 16 bits.
+func ParseExtendedCommunity(in string) (*apb.Any, error) {
+	parts := strings.Split(in, ":")
+	if len(parts) != 3 {
+		return nil, errors.Errorf("invalid extended community `%s`: `kind:admin:value` format expected", in)
+	}
+
+	subType, ok := extendedCommunitySubTypes[strings.ToLower(parts[0])]
+	if !ok {
+		return nil, errors.Errorf("invalid extended community `%s`: unsupported kind `%s`", in, parts[0])
+	}
+
+	if ip := net.ParseIP(parts[1]); ip != nil {
+		if ip.To4() == nil {
+			return nil, errors.Errorf("invalid extended community `%s`: IPv4 address expected", in)
+		}
+
+		value, err := strconv.ParseUint(parts[2], 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("invalid extended community `%s`: value must be 16-bit integer", in)
+		}
+
+		return apb.New(&api.IPv4AddressSpecificExtended{
+			IsTransitive: true,
+			SubType:      subType,
+			Address:      ip.String(),
+			LocalAdmin:   uint32(value),
+		})
+	}
+
+	asn, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("invalid extended community `%s`: ASN must be 32-bit integer", in)
+	}
+
+	if asn > math.MaxUint16 {
+		value, err := strconv.ParseUint(parts[2], 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("invalid extended community `%s`: value must be 16-bit integer", in)
+		}
+
+		return apb.New(&api.FourOctetAsSpecificExtended{
+			IsTransitive: true,
+			SubType:      subType,
+			Asn:          uint32(asn),
+			LocalAdmin:   uint32(value),
+		})
+	}
+
+	value, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("invalid extended community `%s`: value must be 32-bit integer", in)
+	}
+
+	return apb.New(&api.TwoOctetAsSpecificExtended{
+		IsTransitive: true,
+		SubType:      subType,
+		Asn:          uint32(asn),
+		LocalAdmin:   uint32(value),
+	})
+}
+
+// withCommunity returns copy of the path with the community added to its
+// communities attribute.
+func withCommunity(path *api.Path, community uint32) (*api.Path, error) {
+	out := proto.Clone(path).(*api.Path)
+
+	for i, attr := range out.Pattrs {
+		c := &api.CommunitiesAttribute{}
+		if !attr.MessageIs(c) {
+			continue
+		}
+
+		if err := attr.UnmarshalTo(c); err != nil {
+			return nil, errors.Wrap(err, "error decoding communities attribute")
+		}
+
+		if !slices.Contains(c.Communities, community) {
+			c.Communities = append(c.Communities, community)
+		}
+
+		a, err := apb.New(c)
+		if err != nil {
+			return nil, err
+		}
+		out.Pattrs[i] = a
+
+		return out, nil
+	}
+
+	a, err := apb.New(&api.CommunitiesAttribute{
+		Communities: []uint32{community},
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Pattrs = append(out.Pattrs, a)
+
+	return out, nil
+}
@@ -0,0 +1,191 @@
+package announcer
+
+import (
+	"testing"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	apb "google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestParseCommunity(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       string
+		expOut   uint32
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name:   "regular community",
+			in:     "65000:100",
+			expOut: 65000<<16 | 100,
+		},
+		{
+			name:   "well-known community",
+			in:     "no-export",
+			expOut: 0xFFFFFF01,
+		},
+		{
+			name:   "graceful shutdown community",
+			in:     "65535:0",
+			expOut: 0xFFFF0000,
+		},
+		{
+			name:     "too large ASN",
+			in:       "65536:100",
+			expError: errors.New("invalid community `65536:100`: ASN must be 16-bit integer"),
+		},
+		{
+			name:     "invalid format",
+			in:       "65000:100:1",
+			expError: errors.New("invalid community `65000:100:1`: `ASN:value` format expected"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			v, err := ParseCommunity(tc.in)
+			if tc.expError == nil {
+				r.NoError(err)
+				r.Equal(tc.expOut, v)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestParseLargeCommunity(t *testing.T) {
+	r := require.New(t)
+
+	v, err := ParseLargeCommunity("4200000000:1:2")
+	r.NoError(err)
+	r.Equal(uint32(4200000000), v.GlobalAdmin)
+	r.Equal(uint32(1), v.LocalData1)
+	r.Equal(uint32(2), v.LocalData2)
+
+	_, err = ParseLargeCommunity("65000:1")
+	r.Error(err)
+	r.Equal("invalid large community `65000:1`: `ASN:value1:value2` format expected", err.Error())
+
+	_, err = ParseLargeCommunity("65000:1:-2")
+	r.Error(err)
+	r.Equal("invalid large community `65000:1:-2`: all parts must be 32-bit integers", err.Error())
+}
+
+func TestParseExtendedCommunity(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       string
+		expOut   proto.Message
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "two octet ASN route target",
+			in:   "rt:65000:100",
+			expOut: &api.TwoOctetAsSpecificExtended{
+				IsTransitive: true,
+				SubType:      0x02,
+				Asn:          65000,
+				LocalAdmin:   100,
+			},
+		},
+		{
+			name: "four octet ASN site of origin",
+			in:   "soo:4200000000:100",
+			expOut: &api.FourOctetAsSpecificExtended{
+				IsTransitive: true,
+				SubType:      0x03,
+				Asn:          4200000000,
+				LocalAdmin:   100,
+			},
+		},
+		{
+			name: "IPv4 route target",
+			in:   "rt:10.0.0.1:100",
+			expOut: &api.IPv4AddressSpecificExtended{
+				IsTransitive: true,
+				SubType:      0x02,
+				Address:      "10.0.0.1",
+				LocalAdmin:   100,
+			},
+		},
+		{
+			name:     "unsupported kind",
+			in:       "color:0:100",
+			expError: errors.New("invalid extended community `color:0:100`: unsupported kind `color`"),
+		},
+		{
+			name:     "IPv6 address",
+			in:       "rt:2001:db8::1:100",
+			expError: errors.New("invalid extended community `rt:2001:db8::1:100`: `kind:admin:value` format expected"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			v, err := ParseExtendedCommunity(tc.in)
+			if tc.expError != nil {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+				return
+			}
+
+			r.NoError(err)
+
+			out, err := v.UnmarshalNew()
+			r.NoError(err)
+			r.True(proto.Equal(tc.expOut, out), "%s != %s", tc.expOut, out)
+		})
+	}
+}
+
+func TestWithCommunity(t *testing.T) {
+	r := require.New(t)
+
+	communitiesOf := func(path *api.Path) []uint32 {
+		for _, attr := range path.Pattrs {
+			c := &api.CommunitiesAttribute{}
+			if attr.MessageIs(c) {
+				r.NoError(attr.UnmarshalTo(c))
+				return c.Communities
+			}
+		}
+		return nil
+	}
+
+	origin, err := apb.New(&api.OriginAttribute{Origin: 0})
+	r.NoError(err)
+
+	path := &api.Path{Pattrs: []*apb.Any{origin}}
+
+	out, err := withCommunity(path, GracefulShutdownCommunity)
+	r.NoError(err)
+	r.Equal([]uint32{GracefulShutdownCommunity}, communitiesOf(out))
+	r.Len(path.Pattrs, 1)
+
+	communities, err := apb.New(&api.CommunitiesAttribute{Communities: []uint32{65000<<16 | 100}})
+	r.NoError(err)
+
+	path = &api.Path{Pattrs: []*apb.Any{origin, communities}}
+
+	out, err = withCommunity(path, GracefulShutdownCommunity)
+	r.NoError(err)
+	r.Equal([]uint32{65000<<16 | 100, GracefulShutdownCommunity}, communitiesOf(out))
+	r.Equal([]uint32{65000<<16 | 100}, communitiesOf(path))
+
+	out, err = withCommunity(out, GracefulShutdownCommunity)
+	r.NoError(err)
+	r.Equal([]uint32{65000<<16 | 100, GracefulShutdownCommunity}, communitiesOf(out))
+}
@@ -0,0 +1,218 @@
+package announcer
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultExaBGPNextHop makes ExaBGP announce the routes with the local
+// address of the session as next hop.
+const DefaultExaBGPNextHop = "self"
+
+// exaBGPExtendedCommunityKinds maps extended community kinds to the ones
+// used by ExaBGP.
+var exaBGPExtendedCommunityKinds = map[string]string{
+	"rt":  "target",
+	"soo": "origin",
+}
+
+// ExaBGPAPI writes ExaBGP text API commands to ExaBGP, i.e. to stdout when
+// anycastd is run as ExaBGP process or to ExaBGP named pipe. It's shared by
+// the announcers so the commands are written as whole lines.
+type ExaBGPAPI struct {
+	w     io.Writer
+	mutex *sync.Mutex
+}
+
+// NewExaBGPAPI creates ExaBGP API writing the commands to w.
+func NewExaBGPAPI(w io.Writer) *ExaBGPAPI {
+	return &ExaBGPAPI{
+		w:     w,
+		mutex: &sync.Mutex{},
+	}
+}
+
+// Send writes the command to ExaBGP.
+func (e *ExaBGPAPI) Send(command string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, err := io.WriteString(e.w, command+"\n"); err != nil {
+		return errors.Wrap(err, "error writing ExaBGP command")
+	}
+	return nil
+}
+
+// ExaBGPConfig defines the routes announced by ExaBGP via its text API
+// instead of the embedded GoBGP. ExaBGP prepends LocalASN itself on eBGP
+// sessions so it's required for degraded AS path prepend only.
+type ExaBGPConfig struct {
+	Name     string
+	API      *ExaBGPAPI
+	Routes   []Route
+	NextHop  string
+	LocalASN uint32
+	Degraded Degraded
+}
+
+type exaBGPAnnouncer struct {
+	name     string
+	api      *ExaBGPAPI
+	routes   []Route
+	nextHop  string
+	localASN uint32
+	degraded Degraded
+
+	mutex *sync.Mutex
+	state state
+	med   uint32
+}
+
+// NewExaBGP creates announcer sending ExaBGP API commands announcing and
+// withdrawing the routes of the service defined by Name.
+func NewExaBGP(cfg ExaBGPConfig) Announcer {
+	if cfg.NextHop == "" {
+		cfg.NextHop = DefaultExaBGPNextHop
+	}
+
+	return &exaBGPAnnouncer{
+		name:     cfg.Name,
+		api:      cfg.API,
+		routes:   cfg.Routes,
+		nextHop:  cfg.NextHop,
+		localASN: cfg.LocalASN,
+		degraded: cfg.Degraded,
+
+		mutex: &sync.Mutex{},
+		state: stateWithdrawn,
+	}
+}
+
+func (e *exaBGPAnnouncer) Announce(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.state = stateAnnounced
+	return e.announce(ctx)
+}
+
+// Degrade re-announces the routes with the degraded attributes, ExaBGP
+// replaces the announced ones.
+func (e *exaBGPAnnouncer) Degrade(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.state = stateDegraded
+	return e.announce(ctx)
+}
+
+func (e *exaBGPAnnouncer) Denounce(ctx context.Context) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.state = stateWithdrawn
+	return applyRoutes(ctx, e.name, e.routes, func(i int) error {
+		return e.api.Send("withdraw route " + e.routes[i].Prefix + " next-hop " + e.nextHop)
+	})
+}
+
+// SetMED sets MED for the routes and re-announces them if they're announced.
+func (e *exaBGPAnnouncer) SetMED(ctx context.Context, med uint32) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.med == med {
+		return nil
+	}
+
+	e.med = med
+	if e.state == stateWithdrawn {
+		return nil
+	}
+	return e.announce(ctx)
+}
+
+func (e *exaBGPAnnouncer) announce(ctx context.Context) error {
+	degraded := e.state == stateDegraded
+	if degraded && e.degraded.ASPathPrepend > 0 && e.localASN == 0 {
+		return errors.New("local ASN is required for AS path prepend")
+	}
+
+	return applyRoutes(ctx, e.name, e.routes, func(i int) error {
+		command, err := e.announceCommand(e.routes[i], degraded)
+		if err != nil {
+			return err
+		}
+		return e.api.Send(command)
+	})
+}
+
+// announceCommand builds `announce route` command with the route attributes.
+func (e *exaBGPAnnouncer) announceCommand(route Route, degraded bool) (string, error) {
+	command := []string{"announce", "route", route.Prefix, "next-hop", e.nextHop}
+
+	med := e.med
+	if degraded {
+		route.Communities = append(slices.Clone(route.Communities), e.degraded.Communities...)
+		route.LargeCommunities = append(slices.Clone(route.LargeCommunities), e.degraded.LargeCommunities...)
+
+		if e.degraded.MED > med {
+			med = e.degraded.MED
+		}
+
+		if e.degraded.ASPathPrepend > 0 {
+			asPath := make([]string, e.degraded.ASPathPrepend)
+			for i := range asPath {
+				asPath[i] = strconv.FormatUint(uint64(e.localASN), 10)
+			}
+			command = append(command, "as-path", exaBGPList(asPath))
+		}
+	}
+
+	if med > 0 {
+		command = append(command, "med", strconv.FormatUint(uint64(med), 10))
+	}
+
+	if len(route.Communities) > 0 {
+		// well-known communities are passed as numbers since ExaBGP names
+		// some of them differently
+		communities := make([]string, 0, len(route.Communities))
+		for _, c := range route.Communities {
+			v, err := ParseCommunity(c)
+			if err != nil {
+				return "", err
+			}
+			communities = append(communities, strconv.FormatUint(uint64(v>>16), 10)+":"+strconv.FormatUint(uint64(v&0xFFFF), 10))
+		}
+		command = append(command, "community", exaBGPList(communities))
+	}
+
+	if len(route.LargeCommunities) > 0 {
+		command = append(command, "large-community", exaBGPList(route.LargeCommunities))
+	}
+
+	if len(route.ExtendedCommunities) > 0 {
+		communities := make([]string, 0, len(route.ExtendedCommunities))
+		for _, c := range route.ExtendedCommunities {
+			kind, value, _ := strings.Cut(c, ":")
+			exaKind, ok := exaBGPExtendedCommunityKinds[strings.ToLower(kind)]
+			if !ok {
+				return "", errors.Errorf("invalid extended community `%s`: unsupported kind `%s`", c, kind)
+			}
+			communities = append(communities, exaKind+":"+value)
+		}
+		command = append(command, "extended-community", exaBGPList(communities))
+	}
+
+	return strings.Join(command, " "), nil
+}
+
+func exaBGPList(items []string) string {
+	return "[ " + strings.Join(items, " ") + " ]"
+}
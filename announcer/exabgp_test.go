@@ -0,0 +1,131 @@
+package announcer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExaBGPAnnouncer(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	out := &bytes.Buffer{}
+	a := NewExaBGP(ExaBGPConfig{
+		Name: "dns",
+		API:  NewExaBGPAPI(out),
+		Routes: []Route{
+			{
+				Prefix:              "10.0.0.53/32",
+				Communities:         []string{"65000:1"},
+				ExtendedCommunities: []string{"rt:65000:100", "soo:10.0.0.1:1"},
+			},
+			{Prefix: "2001:db8::53/128"},
+		},
+		LocalASN: 65999,
+		Degraded: Degraded{
+			ASPathPrepend:    2,
+			MED:              500,
+			Communities:      []string{"no-export"},
+			LargeCommunities: []string{"65000:1:2"},
+		},
+	})
+
+	r.NoError(a.Announce(ctx))
+	r.Equal([]string{
+		"announce route 10.0.0.53/32 next-hop self community [ 65000:1 ] extended-community [ target:65000:100 origin:10.0.0.1:1 ]",
+		"announce route 2001:db8::53/128 next-hop self",
+	}, readLines(out))
+
+	r.NoError(a.Degrade(ctx))
+	r.Equal([]string{
+		"announce route 10.0.0.53/32 next-hop self as-path [ 65999 65999 ] med 500 community [ 65000:1 65535:65281 ] large-community [ 65000:1:2 ] extended-community [ target:65000:100 origin:10.0.0.1:1 ]",
+		"announce route 2001:db8::53/128 next-hop self as-path [ 65999 65999 ] med 500 community [ 65535:65281 ] large-community [ 65000:1:2 ]",
+	}, readLines(out))
+
+	r.NoError(a.Denounce(ctx))
+	r.Equal([]string{
+		"withdraw route 10.0.0.53/32 next-hop self",
+		"withdraw route 2001:db8::53/128 next-hop self",
+	}, readLines(out))
+}
+
+func TestExaBGPAnnouncerSetMED(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	out := &bytes.Buffer{}
+	a := NewExaBGP(ExaBGPConfig{
+		Name:     "dns",
+		API:      NewExaBGPAPI(out),
+		Routes:   routesOf("10.0.0.53/32"),
+		NextHop:  "10.0.0.1",
+		Degraded: Degraded{MED: 500},
+	})
+
+	setter, ok := a.(MEDSetter)
+	r.True(ok)
+
+	// MED is applied on the next announcement while the routes are withdrawn
+	r.NoError(setter.SetMED(ctx, 100))
+	r.Empty(readLines(out))
+
+	r.NoError(a.Announce(ctx))
+	r.Equal([]string{"announce route 10.0.0.53/32 next-hop 10.0.0.1 med 100"}, readLines(out))
+
+	r.NoError(setter.SetMED(ctx, 100))
+	r.Empty(readLines(out))
+
+	r.NoError(setter.SetMED(ctx, 1000))
+	r.Equal([]string{"announce route 10.0.0.53/32 next-hop 10.0.0.1 med 1000"}, readLines(out))
+
+	// the higher of the dynamic and degraded MEDs is used
+	r.NoError(a.Degrade(ctx))
+	r.Equal([]string{"announce route 10.0.0.53/32 next-hop 10.0.0.1 med 1000"}, readLines(out))
+}
+
+func TestExaBGPAnnouncerErrors(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	a := NewExaBGP(ExaBGPConfig{
+		Name:     "dns",
+		API:      NewExaBGPAPI(&bytes.Buffer{}),
+		Routes:   routesOf("10.0.0.53/32"),
+		Degraded: Degraded{ASPathPrepend: 2},
+	})
+	r.EqualError(a.Degrade(ctx), "local ASN is required for AS path prepend")
+
+	a = NewExaBGP(ExaBGPConfig{
+		Name:   "dns",
+		API:    NewExaBGPAPI(failingWriter{}),
+		Routes: routesOf("10.0.0.53/32"),
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	var partialErr *PartialError
+	r.ErrorAs(a.Announce(ctx), &partialErr)
+	r.EqualError(partialErr.Results[0].Err, "error writing ExaBGP command: broken pipe")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, syscall.EPIPE
+}
+
+// readLines returns the lines written to the buffer since the last call.
+func readLines(b *bytes.Buffer) []string {
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	b.Reset()
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	return lines
+}
@@ -26,3 +26,8 @@ func (m *goBGPMock) DeletePath(ctx context.Context, r *api.DeletePathRequest) er
 	args := m.Called(r.GetPath().GetNlri().String())
 	return args.Error(0)
 }
+
+func (m *goBGPMock) EnableMrt(_ context.Context, r *api.EnableMrtRequest) error {
+	args := m.Called(r.GetType(), r.GetFilename(), r.GetDumpInterval(), r.GetRotationInterval())
+	return args.Error(0)
+}
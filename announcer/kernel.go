@@ -0,0 +1,239 @@
+package announcer
+
+import (
+	"context"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	KernelRouteUnicast   = "unicast"
+	KernelRouteBlackhole = "blackhole"
+	KernelRouteLocal     = "local"
+
+	// DefaultKernelTable is the main routing table.
+	DefaultKernelTable = unix.RT_TABLE_MAIN
+
+	// DefaultKernelProtocol is the protocol the routes are installed with
+	// unless set. It's not assigned in rt_protos, so the routes added by the
+	// administrator or the other daemons are never removed by anycastd.
+	DefaultKernelProtocol = 245
+)
+
+// KernelRouteHandler is the part of netlink handle used to manage the
+// routes.
+type KernelRouteHandler interface {
+	LinkByName(name string) (netlink.Link, error)
+	RouteReplace(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+}
+
+// KernelConfig defines the routes installed into the kernel routing table
+// instead of being announced via BGP. Unicast routes point to Interface,
+// local routes are bound to Interface (loopback by default) and blackhole
+// routes have no interface. Degraded routes are installed with
+// DegradedMetric.
+type KernelConfig struct {
+	Name           string
+	Handler        KernelRouteHandler
+	Routes         []Route
+	Type           string
+	Interface      string
+	Table          int
+	Protocol       int
+	Metric         int
+	DegradedMetric int
+}
+
+type kernelAnnouncer struct {
+	name           string
+	handler        KernelRouteHandler
+	routes         []Route
+	routeType      string
+	iface          string
+	table          int
+	protocol       int
+	metric         int
+	degradedMetric int
+
+	mutex *sync.Mutex
+
+	// metrics are the metrics the routes could be installed with, the ones
+	// other than the metric of the current state are removed once the routes
+	// are installed.
+	metrics map[int]struct{}
+}
+
+// NewKernel creates announcer installing the routes of the service defined
+// by Name into the kernel routing table via netlink.
+func NewKernel(cfg KernelConfig) Announcer {
+	if cfg.Type == "" {
+		cfg.Type = KernelRouteUnicast
+	}
+	if cfg.Type == KernelRouteLocal && cfg.Interface == "" {
+		cfg.Interface = "lo"
+	}
+	if cfg.Table == 0 {
+		cfg.Table = DefaultKernelTable
+	}
+	if cfg.Protocol == 0 {
+		cfg.Protocol = DefaultKernelProtocol
+	}
+
+	return &kernelAnnouncer{
+		name:           cfg.Name,
+		handler:        cfg.Handler,
+		routes:         cfg.Routes,
+		routeType:      cfg.Type,
+		iface:          cfg.Interface,
+		table:          cfg.Table,
+		protocol:       cfg.Protocol,
+		metric:         cfg.Metric,
+		degradedMetric: cfg.DegradedMetric,
+
+		mutex:   &sync.Mutex{},
+		metrics: map[int]struct{}{},
+	}
+}
+
+func (k *kernelAnnouncer) Announce(ctx context.Context) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.install(ctx, stateAnnounced)
+}
+
+// Degrade keeps the routes installed with the degraded metric so the other
+// nodes are preferred by the routing daemon redistributing them.
+func (k *kernelAnnouncer) Degrade(ctx context.Context) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.install(ctx, stateDegraded)
+}
+
+// Denounce removes the routes of the service with any metric, so the ones
+// left by the previous run are removed as well. Only the routes with the
+// protocol of the announcer are removed.
+func (k *kernelAnnouncer) Denounce(ctx context.Context) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	err := applyRoutes(ctx, k.name, k.routes, func(i int) error {
+		route, err := k.newRoute(k.routes[i].Prefix, 0, 0)
+		if err != nil {
+			return err
+		}
+		route.Scope = netlink.SCOPE_NOWHERE
+
+		for {
+			if err := k.handler.RouteDel(route); err != nil {
+				if errors.Is(err, syscall.ESRCH) {
+					return nil
+				}
+				return errors.Wrapf(err, "error removing route `%s`", k.routes[i].Prefix)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	k.metrics = map[int]struct{}{}
+	return nil
+}
+
+// install installs the routes with the metric of the state. The routes
+// installed with the other metrics (e.g. of the previous state) are removed
+// once the new ones are in place. The other metrics are kept until all of
+// the routes are installed and cleaned up, so the failed cleanup is retried
+// on the next call even if it's for the same state.
+func (k *kernelAnnouncer) install(ctx context.Context, to state) error {
+	metric := k.stateMetric(to)
+	k.metrics[metric] = struct{}{}
+
+	linkIndex := 0
+	if k.iface != "" {
+		link, err := k.handler.LinkByName(k.iface)
+		if err != nil {
+			return errors.Wrapf(err, "error looking up interface `%s`", k.iface)
+		}
+		linkIndex = link.Attrs().Index
+	}
+
+	err := applyRoutes(ctx, k.name, k.routes, func(i int) error {
+		prefix := k.routes[i].Prefix
+
+		route, err := k.newRoute(prefix, linkIndex, metric)
+		if err != nil {
+			return err
+		}
+
+		if err := k.handler.RouteReplace(route); err != nil {
+			return errors.Wrapf(err, "error installing route `%s`", prefix)
+		}
+
+		for m := range k.metrics {
+			if m == metric {
+				continue
+			}
+
+			old, err := k.newRoute(prefix, linkIndex, m)
+			if err != nil {
+				return err
+			}
+
+			if err := k.handler.RouteDel(old); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return errors.Wrapf(err, "error removing route `%s` with metric %d", prefix, m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	k.metrics = map[int]struct{}{metric: {}}
+	return nil
+}
+
+func (k *kernelAnnouncer) stateMetric(s state) int {
+	if s == stateDegraded && k.degradedMetric != 0 {
+		return k.degradedMetric
+	}
+	return k.metric
+}
+
+func (k *kernelAnnouncer) newRoute(prefix string, linkIndex, metric int) (*netlink.Route, error) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing prefix `%s`", prefix)
+	}
+
+	route := &netlink.Route{
+		Dst:       ipNet,
+		LinkIndex: linkIndex,
+		Table:     k.table,
+		Protocol:  netlink.RouteProtocol(k.protocol),
+		Priority:  metric,
+	}
+
+	switch k.routeType {
+	case KernelRouteBlackhole:
+		route.Type = unix.RTN_BLACKHOLE
+		route.Scope = netlink.SCOPE_UNIVERSE
+	case KernelRouteLocal:
+		route.Type = unix.RTN_LOCAL
+		route.Scope = netlink.SCOPE_HOST
+	default:
+		route.Type = unix.RTN_UNICAST
+		route.Scope = netlink.SCOPE_LINK
+	}
+
+	return route, nil
+}
@@ -0,0 +1,201 @@
+package announcer
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestKernelAnnouncer(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	m := newNetlinkMock()
+	defer m.AssertExpectations(t)
+
+	a := NewKernel(KernelConfig{
+		Name:           "test_service",
+		Handler:        m,
+		Routes:         routesOf("10.0.0.53/32", "2001:db8::53/128"),
+		Interface:      "dummy0",
+		Table:          100,
+		Protocol:       200,
+		Metric:         10,
+		DegradedMetric: 500,
+	})
+
+	m.On("LinkByName", "dummy0").Return(7, nil).Times(3)
+
+	m.On("RouteReplace", "10.0.0.53/32", 10).Return(nil).Once()
+	m.On("RouteReplace", "2001:db8::53/128", 10).Return(nil).Once()
+	r.NoError(a.Announce(ctx))
+
+	m.On("RouteReplace", "10.0.0.53/32", 500).Return(nil).Once()
+	m.On("RouteReplace", "2001:db8::53/128", 500).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 10).Return(nil).Once()
+	m.On("RouteDel", "2001:db8::53/128", 10).Return(syscall.ESRCH).Once()
+	r.NoError(a.Degrade(ctx))
+
+	m.On("RouteReplace", "10.0.0.53/32", 10).Return(nil).Once()
+	m.On("RouteReplace", "2001:db8::53/128", 10).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 500).Return(nil).Once()
+	m.On("RouteDel", "2001:db8::53/128", 500).Return(nil).Once()
+	r.NoError(a.Announce(ctx))
+
+	// routes are removed with any metric until there's none left
+	m.On("RouteDel", "10.0.0.53/32", 0).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 0).Return(syscall.ESRCH).Once()
+	m.On("RouteDel", "2001:db8::53/128", 0).Return(syscall.ESRCH).Once()
+	r.NoError(a.Denounce(ctx))
+}
+
+func TestKernelAnnouncerSameMetric(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	m := newNetlinkMock()
+	defer m.AssertExpectations(t)
+
+	a := NewKernel(KernelConfig{
+		Name:    "test_service",
+		Handler: m,
+		Routes:  routesOf("10.0.0.53/32"),
+		Type:    KernelRouteBlackhole,
+		Metric:  10,
+	})
+
+	m.On("RouteReplace", "10.0.0.53/32", 10).Return(nil).Twice()
+	r.NoError(a.Announce(ctx))
+	r.NoError(a.Degrade(ctx))
+}
+
+func TestKernelAnnouncerCleanupRetry(t *testing.T) {
+	r := require.New(t)
+
+	m := newNetlinkMock()
+	defer m.AssertExpectations(t)
+
+	a := NewKernel(KernelConfig{
+		Name:           "test_service",
+		Handler:        m,
+		Routes:         routesOf("10.0.0.53/32"),
+		Type:           KernelRouteBlackhole,
+		Metric:         10,
+		DegradedMetric: 500,
+	})
+
+	m.On("RouteReplace", "10.0.0.53/32", 10).Return(nil).Once()
+	r.NoError(a.Announce(context.Background()))
+
+	// the change is not retried with the cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m.On("RouteReplace", "10.0.0.53/32", 500).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 10).Return(syscall.EBUSY).Once()
+	r.Error(a.Degrade(ctx))
+
+	// the route with the preferred metric is removed on the next call
+	m.On("RouteReplace", "10.0.0.53/32", 500).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 10).Return(nil).Once()
+	r.NoError(a.Degrade(context.Background()))
+
+	// the same goes for the routes of the failed state
+	m.On("RouteReplace", "10.0.0.53/32", 10).Return(syscall.EBUSY).Once()
+	r.Error(a.Announce(ctx))
+
+	m.On("RouteReplace", "10.0.0.53/32", 500).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 10).Return(syscall.ESRCH).Once()
+	r.NoError(a.Degrade(context.Background()))
+
+	m.On("RouteReplace", "10.0.0.53/32", 10).Return(nil).Once()
+	m.On("RouteDel", "10.0.0.53/32", 500).Return(nil).Once()
+	r.NoError(a.Announce(context.Background()))
+}
+
+func TestKernelAnnouncerInterfaceError(t *testing.T) {
+	r := require.New(t)
+
+	m := newNetlinkMock()
+	defer m.AssertExpectations(t)
+
+	a := NewKernel(KernelConfig{
+		Name:      "test_service",
+		Handler:   m,
+		Routes:    routesOf("10.0.0.53/32"),
+		Interface: "dummy0",
+	})
+
+	m.On("LinkByName", "dummy0").Return(0, syscall.ENODEV).Once()
+	r.EqualError(a.Announce(context.Background()), "error looking up interface `dummy0`: no such device")
+}
+
+func TestKernelNewRoute(t *testing.T) {
+	type testCase struct {
+		name      string
+		cfg       KernelConfig
+		linkIndex int
+		expected  netlink.Route
+	}
+
+	tcs := []testCase{
+		{
+			name:      "unicast route with defaults",
+			cfg:       KernelConfig{Interface: "dummy0"},
+			linkIndex: 7,
+			expected: netlink.Route{
+				LinkIndex: 7,
+				Table:     unix.RT_TABLE_MAIN,
+				Protocol:  DefaultKernelProtocol,
+				Type:      unix.RTN_UNICAST,
+				Scope:     netlink.SCOPE_LINK,
+				Priority:  10,
+			},
+		},
+		{
+			name: "blackhole route",
+			cfg:  KernelConfig{Type: KernelRouteBlackhole, Table: 100, Protocol: 200},
+			expected: netlink.Route{
+				Table:    100,
+				Protocol: 200,
+				Type:     unix.RTN_BLACKHOLE,
+				Scope:    netlink.SCOPE_UNIVERSE,
+				Priority: 10,
+			},
+		},
+		{
+			name:      "local route",
+			cfg:       KernelConfig{Type: KernelRouteLocal, Table: 1000},
+			linkIndex: 1,
+			expected: netlink.Route{
+				LinkIndex: 1,
+				Table:     1000,
+				Protocol:  DefaultKernelProtocol,
+				Type:      unix.RTN_LOCAL,
+				Scope:     netlink.SCOPE_HOST,
+				Priority:  10,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			a := NewKernel(tc.cfg).(*kernelAnnouncer)
+			route, err := a.newRoute("10.0.0.53/32", tc.linkIndex, 10)
+			r.NoError(err)
+			r.Equal("10.0.0.53/32", route.Dst.String())
+
+			route.Dst = nil
+			r.Equal(tc.expected, *route)
+		})
+	}
+
+	a := NewKernel(KernelConfig{Type: KernelRouteLocal}).(*kernelAnnouncer)
+	require.Equal(t, "lo", a.iface)
+}
@@ -0,0 +1,80 @@
+package announcer
+
+import (
+	"sort"
+	"sync"
+)
+
+// MEDBucket sets MED for the measured values starting from Above.
+type MEDBucket struct {
+	Above float64
+	MED   uint32
+}
+
+// DynamicMED selects MED for the measured value by buckets. Hysteresis is
+// a fraction of the bucket bound the value must cross to move to another
+// bucket so the value oscillating around the bound doesn't flood peers with
+// UPDATEs.
+type DynamicMED struct {
+	buckets    []MEDBucket
+	hysteresis float64
+
+	mutex   *sync.Mutex
+	current int
+}
+
+func NewDynamicMED(buckets []MEDBucket, hysteresis float64) *DynamicMED {
+	buckets = append([]MEDBucket{}, buckets...)
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].Above < buckets[j].Above
+	})
+
+	return &DynamicMED{
+		buckets:    buckets,
+		hysteresis: hysteresis,
+		mutex:      &sync.Mutex{},
+		current:    -1,
+	}
+}
+
+// Observe selects the bucket for the value and returns its MED. changed is
+// true when the selected bucket differs from the previous one.
+func (d *DynamicMED) Observe(value float64) (med uint32, changed bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.buckets) == 0 {
+		return 0, false
+	}
+
+	if d.current < 0 {
+		d.current = d.bucketFor(value)
+		return d.buckets[d.current].MED, true
+	}
+
+	next := d.current
+	if up := d.bucketFor(value / (1 + d.hysteresis)); up > d.current {
+		next = up
+	} else if down := d.bucketFor(value / (1 - d.hysteresis)); down < d.current {
+		next = down
+	}
+
+	if next == d.current {
+		return d.buckets[d.current].MED, false
+	}
+
+	changed = d.buckets[next].MED != d.buckets[d.current].MED
+	d.current = next
+
+	return d.buckets[d.current].MED, changed
+}
+
+func (d *DynamicMED) bucketFor(value float64) int {
+	idx := 0
+	for i, b := range d.buckets {
+		if value >= b.Above {
+			idx = i
+		}
+	}
+	return idx
+}
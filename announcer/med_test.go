@@ -0,0 +1,90 @@
+package announcer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicMED(t *testing.T) {
+	type observation struct {
+		value      float64
+		expMED     uint32
+		expChanged bool
+	}
+
+	type testCase struct {
+		name         string
+		buckets      []MEDBucket
+		hysteresis   float64
+		observations []observation
+	}
+
+	tcs := []testCase{
+		{
+			name: "no hysteresis",
+			buckets: []MEDBucket{
+				{Above: 0, MED: 0},
+				{Above: 10, MED: 100},
+				{Above: 50, MED: 500},
+			},
+			observations: []observation{
+				{5, 0, true},
+				{9, 0, false},
+				{10, 100, true},
+				{70, 500, true},
+				{49, 100, true},
+				{1, 0, true},
+			},
+		},
+		{
+			name: "hysteresis",
+			buckets: []MEDBucket{
+				{Above: 50, MED: 500},
+				{Above: 0, MED: 0},
+				{Above: 10, MED: 100},
+			},
+			hysteresis: 0.2,
+			observations: []observation{
+				{5, 0, true},
+				{11, 0, false},
+				{12, 100, true},
+				{9, 100, false},
+				{8.5, 100, false},
+				{7.9, 0, true},
+				{100, 500, true},
+				{0, 0, true},
+			},
+		},
+		{
+			name: "value below the first bucket",
+			buckets: []MEDBucket{
+				{Above: 10, MED: 100},
+				{Above: 50, MED: 500},
+			},
+			observations: []observation{
+				{5, 100, true},
+				{60, 500, true},
+			},
+		},
+		{
+			name: "no buckets",
+			observations: []observation{
+				{5, 0, false},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			d := NewDynamicMED(tc.buckets, tc.hysteresis)
+			for i, o := range tc.observations {
+				med, changed := d.Observe(o.value)
+				r.Equalf(o.expMED, med, "observation#%d", i)
+				r.Equalf(o.expChanged, changed, "observation#%d", i)
+			}
+		})
+	}
+}
@@ -291,7 +291,7 @@ func (m *metrics) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil
 		default:
 			peers := []*apipb.Peer{}
 			if err := m.bgpSrv.ListPeer(ctx, &apipb.ListPeerRequest{}, func(p *apipb.Peer) {
@@ -304,7 +304,7 @@ func (m *metrics) Run(ctx context.Context) error {
 
 			for _, peer := range peers {
 				peerState := peer.GetState()
-				peerRouterID := peer.GetConf().GetNeighborAddress()
+				peerRouterID := peerAddress(peer)
 
 				m.peerAdminState.WithLabelValues(
 					m.routerID,
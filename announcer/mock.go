@@ -6,7 +6,10 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
-var _ Announcer = (*Mock)(nil)
+var (
+	_ Announcer = (*Mock)(nil)
+	_ MEDSetter = (*Mock)(nil)
+)
 
 type Mock struct {
 	mock.Mock
@@ -21,7 +24,17 @@ func (m *Mock) Announce(ctx context.Context) error {
 	return args.Error(0)
 }
 
+func (m *Mock) Degrade(ctx context.Context) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *Mock) Denounce(ctx context.Context) error {
 	args := m.Called()
 	return args.Error(0)
 }
+
+func (m *Mock) SetMED(ctx context.Context, med uint32) error {
+	args := m.Called(med)
+	return args.Error(0)
+}
@@ -0,0 +1,168 @@
+package announcer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultMRTSizeCheckInterval is how often the size of the MRT file is
+// checked when the dump is rotated by size.
+const DefaultMRTSizeCheckInterval = 10 * time.Second
+
+// MRTServer is the part of GoBGP server used to dump MRT files.
+type MRTServer interface {
+	EnableMrt(ctx context.Context, r *api.EnableMrtRequest) error
+}
+
+// MRTDump defines the MRT dump written by GoBGP. FileName is the Go time
+// layout GoBGP formats the file name with on rotation. Updates dumps record
+// BGP4MP messages, table dumps record TABLE_DUMP_V2 snapshots of the global
+// RIB every DumpInterval or RotationInterval. MaxSize rotates the updates
+// dump once it grows over the size in bytes: GoBGP keeps the file open, so the
+// file is moved aside and still written until the next RotationInterval, the
+// limit is only enforced on the interval rotation.
+type MRTDump struct {
+	Updates          bool
+	FileName         string
+	DumpInterval     time.Duration
+	RotationInterval time.Duration
+	MaxSize          int64
+}
+
+// MRTDumper enables the MRT dump and rotates it by size since GoBGP
+// rotates the files by interval only.
+type MRTDumper struct {
+	srv           MRTServer
+	dump          MRTDump
+	checkInterval time.Duration
+	rotatedAt     time.Time
+}
+
+func NewMRTDumper(srv MRTServer, dump MRTDump) *MRTDumper {
+	return &MRTDumper{
+		srv:           srv,
+		dump:          dump,
+		checkInterval: DefaultMRTSizeCheckInterval,
+	}
+}
+
+// Enable starts writing the dump. GoBGP can't stop the dump so it's written
+// until the process exits.
+func (d *MRTDumper) Enable(ctx context.Context) error {
+	dumpType := api.EnableMrtRequest_TABLE
+	if d.dump.Updates {
+		dumpType = api.EnableMrtRequest_UPDATES
+	}
+
+	return errors.Wrapf(d.srv.EnableMrt(ctx, &api.EnableMrtRequest{
+		Type:             dumpType,
+		Filename:         d.dump.FileName,
+		DumpInterval:     uint64(d.dump.DumpInterval.Seconds()),
+		RotationInterval: uint64(d.dump.RotationInterval.Seconds()),
+	}), "error enabling MRT dump `%s`", d.dump.FileName)
+}
+
+// Run rotates the dump by size until the context is done.
+func (d *MRTDumper) Run(ctx context.Context) error {
+	if d.dump.MaxSize == 0 {
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.checkInterval):
+			if err := d.rotateOversized(); err != nil {
+				log.Warnf("MRT dump rotation failed: %s", err)
+			}
+		}
+	}
+}
+
+// rotateOversized moves the current file aside with the first free numeric
+// suffix. GoBGP keeps writing to the moved file until its next interval
+// rotation opens a new file.
+func (d *MRTDumper) rotateOversized() error {
+	name, size, err := d.currentFile(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if name == "" || size < d.dump.MaxSize {
+		return nil
+	}
+
+	rotated := name
+	for i := 1; ; i++ {
+		rotated = name + "." + strconv.Itoa(i)
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			break
+		}
+	}
+
+	if err := os.Rename(name, rotated); err != nil {
+		return errors.Wrapf(err, "error rotating MRT file `%s`", name)
+	}
+	d.rotatedAt = time.Now()
+
+	log.WithFields(log.Fields{
+		"file": rotated,
+		"size": size,
+	}).Info("MRT file rotated by size")
+
+	return nil
+}
+
+// currentFile returns path and size of the most recently modified file
+// matching the file name layout of the dump or empty path if there's none.
+// Files not modified since the last size rotation are the ones GoBGP has
+// already rotated away from.
+func (d *MRTDumper) currentFile(now time.Time) (string, int64, error) {
+	dir := filepath.Dir(now.Format(d.dump.FileName))
+	layout := filepath.Base(d.dump.FileName)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", 0, nil
+		}
+		return "", 0, errors.Wrapf(err, "error reading MRT directory `%s`", dir)
+	}
+
+	var current os.FileInfo
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		if _, err := time.Parse(layout, e.Name()); err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return "", 0, errors.Wrapf(err, "error inspecting MRT file `%s`", e.Name())
+		}
+
+		if !info.ModTime().After(d.rotatedAt) {
+			continue
+		}
+
+		if current == nil || info.ModTime().After(current.ModTime()) {
+			current = info
+		}
+	}
+
+	if current == nil {
+		return "", 0, nil
+	}
+	return filepath.Join(dir, current.Name()), current.Size(), nil
+}
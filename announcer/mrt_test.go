@@ -0,0 +1,149 @@
+package announcer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMRTDumperRotateOversized(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	// GoBGP formats the whole path as time layout so the test directory is
+	// kept out of it
+	t.Chdir(t.TempDir())
+
+	srv, remote := newTestPeers(t)
+	d := NewMRTDumper(remote, MRTDump{
+		Updates:  true,
+		FileName: "mrt/updates.mrt",
+		MaxSize:  10,
+	})
+	r.NoError(d.Enable(ctx))
+	r.FileExists("mrt/updates.mrt")
+
+	r.NoError(d.rotateOversized())
+	r.NoFileExists("mrt/updates.mrt.1")
+
+	reg := NewRegistry(srv, SharePolicyAny)
+	r.NoError(New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "10.0.0.1"}).Announce(ctx))
+	size := waitFileGrowth(t, "mrt/updates.mrt", 0)
+
+	r.NoError(d.rotateOversized())
+	r.NoFileExists("mrt/updates.mrt")
+
+	// GoBGP keeps writing to the rotated file until its next interval
+	// rotation opens a new one
+	r.NoError(New(Config{Name: "ntp", Registry: reg, Routes: routesOf("172.16.38.123/32"), NextHop: "10.0.0.1"}).Announce(ctx))
+	waitFileGrowth(t, "mrt/updates.mrt.1", size)
+	r.NoFileExists("mrt/updates.mrt")
+
+	// the rotated file is not rotated again
+	r.NoError(d.rotateOversized())
+	r.NoFileExists("mrt/updates.mrt.1.1")
+	r.NoFileExists("mrt/updates.mrt.2")
+}
+
+func TestMRTDumperCurrentFile(t *testing.T) {
+	r := require.New(t)
+
+	t.Chdir(t.TempDir())
+	r.NoError(os.Mkdir("mrt", 0o755))
+
+	d := NewMRTDumper(newGoBGPMock(), MRTDump{FileName: "mrt/table.20060102.1504.mrt"})
+
+	name, size, err := d.currentFile(time.Now())
+	r.NoError(err)
+	r.Empty(name)
+	r.Zero(size)
+
+	now := time.Now()
+	for i, name := range []string{
+		"table.20240101.1300.mrt",
+		"table.20240101.1200.mrt",
+		"table.20240101.1300.mrt.1",
+		"updates.mrt",
+	} {
+		appendFile(t, filepath.Join("mrt", name), 10+i)
+		r.NoError(os.Chtimes(filepath.Join("mrt", name), now, now.Add(time.Duration(i)*time.Minute)))
+	}
+
+	name, size, err = d.currentFile(time.Now())
+	r.NoError(err)
+	r.Equal(filepath.Join("mrt", "table.20240101.1200.mrt"), name)
+	r.Equal(int64(11), size)
+}
+
+func TestMRTDumperCurrentFileRotated(t *testing.T) {
+	r := require.New(t)
+
+	t.Chdir(t.TempDir())
+	r.NoError(os.Mkdir("mrt", 0o755))
+
+	d := NewMRTDumper(newGoBGPMock(), MRTDump{FileName: "mrt/updates.20060102.1504.mrt", Updates: true, MaxSize: 10})
+
+	appendFile(t, "mrt/updates.20240101.1200.mrt", 20)
+	r.NoError(os.Chtimes("mrt/updates.20240101.1200.mrt", time.Now(), time.Now().Add(-time.Hour)))
+	appendFile(t, "mrt/updates.20240101.1300.mrt", 20)
+
+	r.NoError(d.rotateOversized())
+	r.FileExists("mrt/updates.20240101.1300.mrt.1")
+
+	// files GoBGP has rotated away from are not rotated by size
+	name, _, err := d.currentFile(time.Now())
+	r.NoError(err)
+	r.Empty(name)
+
+	r.NoError(d.rotateOversized())
+	r.FileExists("mrt/updates.20240101.1200.mrt")
+}
+
+func TestMRTDumperRunWithoutMaxSize(t *testing.T) {
+	r := require.New(t)
+
+	r.NoError(NewMRTDumper(newGoBGPMock(), MRTDump{Updates: true, FileName: "updates.mrt"}).Run(context.Background()))
+}
+
+func TestMRTDumperEnableRequest(t *testing.T) {
+	r := require.New(t)
+
+	m := newGoBGPMock()
+	defer m.AssertExpectations(t)
+
+	m.On("EnableMrt", api.EnableMrtRequest_TABLE, "/var/lib/anycastd/table.20060102.1504.mrt", uint64(0), uint64(3600)).Return(nil).Once()
+
+	r.NoError(NewMRTDumper(m, MRTDump{
+		FileName:         "/var/lib/anycastd/table.20060102.1504.mrt",
+		RotationInterval: time.Hour,
+	}).Enable(context.Background()))
+}
+
+func appendFile(t *testing.T, name string, size int) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write(make([]byte, size))
+	require.NoError(t, err)
+}
+
+// waitFileGrowth waits until the file written by GoBGP grows over the size and
+// returns the new size.
+func waitFileGrowth(t *testing.T, name string, size int64) int64 {
+	var current int64
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+
+		current = info.Size()
+		return current > size
+	}, 30*time.Second, 10*time.Millisecond)
+
+	return current
+}
@@ -0,0 +1,31 @@
+package announcer
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/vishvananda/netlink"
+)
+
+var _ KernelRouteHandler = (*netlinkMock)(nil)
+
+type netlinkMock struct {
+	mock.Mock
+}
+
+func newNetlinkMock() *netlinkMock {
+	return &netlinkMock{}
+}
+
+func (m *netlinkMock) LinkByName(name string) (netlink.Link, error) {
+	args := m.Called(name)
+	return &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name, Index: args.Int(0)}}, args.Error(1)
+}
+
+func (m *netlinkMock) RouteReplace(route *netlink.Route) error {
+	args := m.Called(route.Dst.String(), route.Priority)
+	return args.Error(0)
+}
+
+func (m *netlinkMock) RouteDel(route *netlink.Route) error {
+	args := m.Called(route.Dst.String(), route.Priority)
+	return args.Error(0)
+}
@@ -0,0 +1,384 @@
+package announcer
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+)
+
+// PeerSelectionPolicyName is the name of the export policy limiting the
+// peers the service prefixes are announced to.
+const PeerSelectionPolicyName = "anycastd-peer-selection"
+
+// NextHopPolicyName is the name of the export policy replacing the next hop
+// of the routes announced to the particular peers.
+const NextHopPolicyName = "anycastd-next-hop"
+
+// DegradedPrependPolicyName is the name of the export policy prepending AS
+// path of the degraded routes.
+const DegradedPrependPolicyName = "anycastd-degraded-prepend"
+
+// degradedPrependASN is the global administrator of the large communities
+// marking the degraded routes to prepend. It's reserved (RFC 7300) so the
+// marker never clashes with the communities of the services.
+const degradedPrependASN = "4294967295"
+
+// PeerSelection limits the peers the prefixes of the service are announced
+// to. Neighbors are the peer addresses or prefixes, nil neighbors mean the
+// prefixes are announced to every peer.
+type PeerSelection struct {
+	Service   string
+	Prefixes  []string
+	Neighbors []string
+}
+
+// NextHopOverride replaces next hop of the routes announced to the peer
+// with NextHop. Only the routes of the same address family as NextHop are
+// affected.
+type NextHopOverride struct {
+	Peer     string
+	Neighbor string
+	NextHop  string
+}
+
+// PolicyServer is the part of GoBGP server used to set up the policies.
+type PolicyServer interface {
+	AddDefinedSet(ctx context.Context, r *api.AddDefinedSetRequest) error
+	AddPolicy(ctx context.Context, r *api.AddPolicyRequest) error
+	AddPolicyAssignment(ctx context.Context, r *api.AddPolicyAssignmentRequest) error
+}
+
+type peerSelectionGroup struct {
+	name      string
+	prefixes  map[string][]string
+	neighbors []string
+}
+
+// NewPeerSelectionPolicy builds the defined sets and the export policy
+// rejecting the prefixes to the peers not selected by any of the services
+// owning the prefix. Prefixes owned by at least one service without peer
+// selection are announced to every peer. Nil policy is returned when there's
+// nothing to limit.
+func NewPeerSelectionPolicy(selections []PeerSelection) ([]*api.DefinedSet, *api.Policy, error) {
+	owners := map[string][]int{}
+	for i, sel := range selections {
+		for _, prefix := range sel.Prefixes {
+			key := prefixKey(prefix)
+			owners[key] = append(owners[key], i)
+		}
+	}
+
+	groups := map[string]*peerSelectionGroup{}
+	for prefix, idx := range owners {
+		services := []string{}
+		neighbors := []string{}
+		unrestricted := false
+		for _, i := range idx {
+			if selections[i].Neighbors == nil {
+				unrestricted = true
+				break
+			}
+			services = append(services, selections[i].Service)
+			neighbors = append(neighbors, selections[i].Neighbors...)
+		}
+
+		if unrestricted {
+			continue
+		}
+
+		slices.Sort(services)
+		name := "anycastd-service-" + strings.Join(slices.Compact(services), "+")
+
+		group, ok := groups[name]
+		if !ok {
+			group = &peerSelectionGroup{name: name, prefixes: map[string][]string{}}
+			groups[name] = group
+		}
+
+		family, err := prefixFamily(prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		group.prefixes[family] = append(group.prefixes[family], prefix)
+
+		for _, n := range neighbors {
+			cidr, err := NeighborCIDR(n)
+			if err != nil {
+				return nil, nil, err
+			}
+			group.neighbors = append(group.neighbors, cidr)
+		}
+	}
+
+	if len(groups) == 0 {
+		return nil, nil, nil
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	sets := []*api.DefinedSet{}
+	policy := &api.Policy{Name: PeerSelectionPolicyName}
+	for _, name := range names {
+		group := groups[name]
+
+		neighbors := group.neighbors
+		slices.Sort(neighbors)
+		sets = append(sets, &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        name + "-peers",
+			List:        slices.Compact(neighbors),
+		})
+
+		for _, family := range []string{"ipv4", "ipv6"} {
+			prefixes := group.prefixes[family]
+			if len(prefixes) == 0 {
+				continue
+			}
+			slices.Sort(prefixes)
+
+			set := &api.DefinedSet{
+				DefinedType: api.DefinedType_PREFIX,
+				Name:        name + "-" + family,
+			}
+			for _, prefix := range prefixes {
+				_, ipNet, _ := net.ParseCIDR(prefix)
+				length, _ := ipNet.Mask.Size()
+				set.Prefixes = append(set.Prefixes, &api.Prefix{
+					IpPrefix:      prefix,
+					MaskLengthMin: uint32(length),
+					MaskLengthMax: uint32(length),
+				})
+			}
+			sets = append(sets, set)
+
+			policy.Statements = append(policy.Statements, &api.Statement{
+				Name: name + "-" + family,
+				Conditions: &api.Conditions{
+					PrefixSet: &api.MatchSet{
+						Type: api.MatchSet_ANY,
+						Name: set.Name,
+					},
+					NeighborSet: &api.MatchSet{
+						Type: api.MatchSet_INVERT,
+						Name: name + "-peers",
+					},
+				},
+				Actions: &api.Actions{
+					RouteAction: api.RouteAction_REJECT,
+				},
+			})
+		}
+	}
+
+	return sets, policy, nil
+}
+
+// NewNextHopPolicy builds the defined sets and the export policy replacing
+// next hop of the routes announced to the peers. Nil policy is returned when
+// there are no overrides.
+func NewNextHopPolicy(overrides []NextHopOverride) ([]*api.DefinedSet, *api.Policy, error) {
+	if len(overrides) == 0 {
+		return nil, nil, nil
+	}
+
+	sets := []*api.DefinedSet{}
+	policy := &api.Policy{Name: NextHopPolicyName}
+	families := map[string]bool{}
+	for _, o := range overrides {
+		neighbor, err := NeighborCIDR(o.Neighbor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		family := "ipv6"
+		if ip := net.ParseIP(o.NextHop); ip == nil {
+			return nil, nil, errors.Errorf("invalid next hop `%s` of peer `%s`", o.NextHop, o.Peer)
+		} else if ip.To4() != nil {
+			family = "ipv4"
+		}
+		families[family] = true
+
+		name := "anycastd-peer-" + o.Peer
+		sets = append(sets, &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        name,
+			List:        []string{neighbor},
+		})
+
+		policy.Statements = append(policy.Statements, &api.Statement{
+			Name: name + "-next-hop",
+			Conditions: &api.Conditions{
+				PrefixSet: &api.MatchSet{
+					Type: api.MatchSet_ANY,
+					Name: "anycastd-" + family,
+				},
+				NeighborSet: &api.MatchSet{
+					Type: api.MatchSet_ANY,
+					Name: name,
+				},
+			},
+			Actions: &api.Actions{
+				RouteAction: api.RouteAction_NONE,
+				Nexthop: &api.NexthopAction{
+					Address: o.NextHop,
+				},
+			},
+		})
+	}
+
+	// the routes are matched by address family so IPv4 next hop isn't set
+	// to IPv6 routes and vice versa
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if !families[family] {
+			continue
+		}
+
+		prefix := &api.Prefix{IpPrefix: "0.0.0.0/0", MaskLengthMax: 32}
+		if family == "ipv6" {
+			prefix = &api.Prefix{IpPrefix: "::/0", MaskLengthMax: 128}
+		}
+
+		sets = append(sets, &api.DefinedSet{
+			DefinedType: api.DefinedType_PREFIX,
+			Name:        "anycastd-" + family,
+			Prefixes:    []*api.Prefix{prefix},
+		})
+	}
+
+	return sets, policy, nil
+}
+
+// DegradedPrependCommunity returns the large community marking the degraded
+// routes whose AS path is prepended n times by the degraded prepend policy.
+func DegradedPrependCommunity(n uint32) string {
+	return degradedPrependASN + ":0:" + strconv.FormatUint(uint64(n), 10)
+}
+
+// NewDegradedPrependPolicy builds the defined sets and the export policy
+// prepending AS path of the degraded routes marked with
+// DegradedPrependCommunity. The local AS of the session is prepended so
+// per-peer local AS is honoured, iBGP sessions are left as is since own AS
+// would make the peers drop the routes. The marker is removed before the
+// routes are sent. Nil policy is returned when nothing is prepended.
+func NewDegradedPrependPolicy(prepends []uint32) ([]*api.DefinedSet, *api.Policy) {
+	prepends = slices.Clone(prepends)
+	slices.Sort(prepends)
+	prepends = slices.Compact(prepends)
+
+	sets := []*api.DefinedSet{}
+	policy := &api.Policy{Name: DegradedPrependPolicyName}
+	for _, n := range prepends {
+		if n == 0 {
+			continue
+		}
+
+		community := DegradedPrependCommunity(n)
+		name := "anycastd-prepend-" + strconv.FormatUint(uint64(n), 10)
+		sets = append(sets, &api.DefinedSet{
+			DefinedType: api.DefinedType_LARGE_COMMUNITY,
+			Name:        name,
+			List:        []string{community},
+		})
+
+		policy.Statements = append(policy.Statements, &api.Statement{
+			Name: name,
+			Conditions: &api.Conditions{
+				LargeCommunitySet: &api.MatchSet{
+					Type: api.MatchSet_ANY,
+					Name: name,
+				},
+			},
+			Actions: &api.Actions{
+				RouteAction: api.RouteAction_NONE,
+				AsPrepend: &api.AsPrependAction{
+					Repeat:      n,
+					UseLeftMost: true,
+				},
+				LargeCommunity: &api.CommunityAction{
+					Type:        api.CommunityAction_REMOVE,
+					Communities: []string{community},
+				},
+			},
+		})
+	}
+
+	if len(policy.Statements) == 0 {
+		return nil, nil
+	}
+	return sets, policy
+}
+
+// AddExportPolicies adds the defined sets and the policies to the server and
+// assigns the policies as the global export policy. Routes not rejected by
+// the policies are accepted.
+func AddExportPolicies(ctx context.Context, srv PolicyServer, sets []*api.DefinedSet, policies []*api.Policy) error {
+	for _, set := range sets {
+		if err := srv.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+			DefinedSet: set,
+		}); err != nil {
+			return errors.Wrapf(err, "error adding defined set `%s`", set.GetName())
+		}
+	}
+
+	if len(policies) == 0 {
+		return nil
+	}
+
+	assigned := []*api.Policy{}
+	for _, policy := range policies {
+		if err := srv.AddPolicy(ctx, &api.AddPolicyRequest{
+			Policy: policy,
+		}); err != nil {
+			return errors.Wrapf(err, "error adding policy `%s`", policy.GetName())
+		}
+		assigned = append(assigned, &api.Policy{Name: policy.GetName()})
+	}
+
+	return errors.Wrap(srv.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{
+		Assignment: &api.PolicyAssignment{
+			Name:          "global",
+			Direction:     api.PolicyDirection_EXPORT,
+			Policies:      assigned,
+			DefaultAction: api.RouteAction_ACCEPT,
+		},
+	}), "error assigning export policies")
+}
+
+func prefixFamily(prefix string) (string, error) {
+	ip, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing prefix `%s`", prefix)
+	}
+
+	if ip.To4() != nil {
+		return "ipv4", nil
+	}
+	return "ipv6", nil
+}
+
+// NeighborCIDR returns the neighbor address or prefix in CIDR form GoBGP
+// expects in neighbor sets.
+func NeighborCIDR(neighbor string) (string, error) {
+	if _, ipNet, err := net.ParseCIDR(neighbor); err == nil {
+		return ipNet.String(), nil
+	}
+
+	ip := net.ParseIP(neighbor)
+	if ip == nil {
+		return "", errors.Errorf("invalid neighbor address `%s`", neighbor)
+	}
+
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+	return ip.String() + "/128", nil
+}
@@ -0,0 +1,282 @@
+package announcer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPeerSelectionPolicy(t *testing.T) {
+	r := require.New(t)
+
+	sets, policy, err := NewPeerSelectionPolicy([]PeerSelection{
+		{Service: "resolver", Prefixes: []string{"10.0.0.53/32", "2001:db8::53/128"}, Neighbors: []string{"10.1.0.1", "10.1.0.0/24"}},
+		{Service: "vip", Prefixes: []string{"10.0.0.80/32", "10.0.0.81/32"}, Neighbors: []string{"10.2.0.1"}},
+		{Service: "vip-tls", Prefixes: []string{"10.0.0.81/32"}, Neighbors: []string{"10.2.0.2"}},
+		{Service: "ntp", Prefixes: []string{"10.0.0.123/32", "10.0.0.80/32"}},
+	})
+	r.NoError(err)
+
+	r.Equal([]*api.DefinedSet{
+		{DefinedType: api.DefinedType_NEIGHBOR, Name: "anycastd-service-resolver-peers", List: []string{"10.1.0.0/24", "10.1.0.1/32"}},
+		{DefinedType: api.DefinedType_PREFIX, Name: "anycastd-service-resolver-ipv4", Prefixes: []*api.Prefix{
+			{IpPrefix: "10.0.0.53/32", MaskLengthMin: 32, MaskLengthMax: 32},
+		}},
+		{DefinedType: api.DefinedType_PREFIX, Name: "anycastd-service-resolver-ipv6", Prefixes: []*api.Prefix{
+			{IpPrefix: "2001:db8::53/128", MaskLengthMin: 128, MaskLengthMax: 128},
+		}},
+		{DefinedType: api.DefinedType_NEIGHBOR, Name: "anycastd-service-vip+vip-tls-peers", List: []string{"10.2.0.1/32", "10.2.0.2/32"}},
+		{DefinedType: api.DefinedType_PREFIX, Name: "anycastd-service-vip+vip-tls-ipv4", Prefixes: []*api.Prefix{
+			{IpPrefix: "10.0.0.81/32", MaskLengthMin: 32, MaskLengthMax: 32},
+		}},
+	}, sets)
+
+	r.Equal(PeerSelectionPolicyName, policy.Name)
+	r.Len(policy.Statements, 3)
+	r.Equal(&api.Statement{
+		Name: "anycastd-service-vip+vip-tls-ipv4",
+		Conditions: &api.Conditions{
+			PrefixSet:   &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-service-vip+vip-tls-ipv4"},
+			NeighborSet: &api.MatchSet{Type: api.MatchSet_INVERT, Name: "anycastd-service-vip+vip-tls-peers"},
+		},
+		Actions: &api.Actions{RouteAction: api.RouteAction_REJECT},
+	}, policy.Statements[2])
+}
+
+func TestNewPeerSelectionPolicyUnrestricted(t *testing.T) {
+	r := require.New(t)
+
+	sets, policy, err := NewPeerSelectionPolicy([]PeerSelection{
+		{Service: "ntp", Prefixes: []string{"10.0.0.123/32"}},
+	})
+	r.NoError(err)
+	r.Nil(sets)
+	r.Nil(policy)
+}
+
+func TestPeerSelectionPolicyFiltersAdjRIBOut(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	srv := newTestPeering(t)
+
+	sets, policy, err := NewPeerSelectionPolicy([]PeerSelection{
+		{Service: "internal", Prefixes: []string{"172.16.38.43/32"}, Neighbors: []string{"127.0.0.3"}},
+		{Service: "public", Prefixes: []string{"172.16.38.44/32"}, Neighbors: []string{"127.0.0.0/30"}},
+	})
+	r.NoError(err)
+	r.NoError(AddExportPolicies(ctx, srv, sets, []*api.Policy{policy}))
+
+	reg := NewRegistry(srv, SharePolicyAny)
+	for name, prefix := range map[string]string{"internal": "172.16.38.43/32", "public": "172.16.38.44/32"} {
+		a := New(Config{Name: name, Registry: reg, Routes: routesOf(prefix), NextHop: "127.0.0.1"})
+		r.NoError(a.Announce(ctx))
+	}
+
+	filtered := map[string]bool{}
+	r.NoError(srv.ListPath(ctx, &api.ListPathRequest{
+		TableType:      api.TableType_ADJ_OUT,
+		Name:           "127.0.0.2",
+		Family:         &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+		EnableFiltered: true,
+	}, func(d *api.Destination) {
+		for _, p := range d.GetPaths() {
+			filtered[d.GetPrefix()] = p.GetFiltered()
+		}
+	}))
+
+	r.Equal(map[string]bool{
+		"172.16.38.43/32": true,
+		"172.16.38.44/32": false,
+	}, filtered)
+}
+
+func TestNewNextHopPolicy(t *testing.T) {
+	r := require.New(t)
+
+	sets, policy, err := NewNextHopPolicy([]NextHopOverride{
+		{Peer: "transit1", Neighbor: "10.1.0.1", NextHop: "10.1.0.2"},
+		{Peer: "transit2", Neighbor: "2001:db8:1::1", NextHop: "2001:db8:1::2"},
+	})
+	r.NoError(err)
+
+	r.Equal([]*api.DefinedSet{
+		{DefinedType: api.DefinedType_NEIGHBOR, Name: "anycastd-peer-transit1", List: []string{"10.1.0.1/32"}},
+		{DefinedType: api.DefinedType_NEIGHBOR, Name: "anycastd-peer-transit2", List: []string{"2001:db8:1::1/128"}},
+		{DefinedType: api.DefinedType_PREFIX, Name: "anycastd-ipv4", Prefixes: []*api.Prefix{
+			{IpPrefix: "0.0.0.0/0", MaskLengthMax: 32},
+		}},
+		{DefinedType: api.DefinedType_PREFIX, Name: "anycastd-ipv6", Prefixes: []*api.Prefix{
+			{IpPrefix: "::/0", MaskLengthMax: 128},
+		}},
+	}, sets)
+
+	r.Equal(NextHopPolicyName, policy.Name)
+	r.Equal([]*api.Statement{
+		{
+			Name: "anycastd-peer-transit1-next-hop",
+			Conditions: &api.Conditions{
+				PrefixSet:   &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-ipv4"},
+				NeighborSet: &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-peer-transit1"},
+			},
+			Actions: &api.Actions{RouteAction: api.RouteAction_NONE, Nexthop: &api.NexthopAction{Address: "10.1.0.2"}},
+		},
+		{
+			Name: "anycastd-peer-transit2-next-hop",
+			Conditions: &api.Conditions{
+				PrefixSet:   &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-ipv6"},
+				NeighborSet: &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-peer-transit2"},
+			},
+			Actions: &api.Actions{RouteAction: api.RouteAction_NONE, Nexthop: &api.NexthopAction{Address: "2001:db8:1::2"}},
+		},
+	}, policy.Statements)
+
+	sets, policy, err = NewNextHopPolicy(nil)
+	r.NoError(err)
+	r.Nil(sets)
+	r.Nil(policy)
+
+	_, _, err = NewNextHopPolicy([]NextHopOverride{{Peer: "transit1", Neighbor: "10.1.0.1", NextHop: "transit"}})
+	r.Error(err)
+	r.Equal("invalid next hop `transit` of peer `transit1`", err.Error())
+}
+
+func TestNextHopPolicyAdjRIBOut(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	srv := newTestPeering(t)
+
+	sets, policy, err := NewNextHopPolicy([]NextHopOverride{
+		{Peer: "peer", Neighbor: "127.0.0.2", NextHop: "10.9.9.9"},
+		{Peer: "other", Neighbor: "127.0.0.3", NextHop: "10.8.8.8"},
+	})
+	r.NoError(err)
+	r.NoError(AddExportPolicies(ctx, srv, sets, []*api.Policy{policy}))
+
+	a := New(Config{Name: "dns", Registry: NewRegistry(srv, SharePolicyAny), Routes: routesOf("172.16.38.43/32"), NextHop: "127.0.0.1"})
+	r.NoError(a.Announce(ctx))
+
+	nextHops := map[string]string{}
+	r.NoError(srv.ListPath(ctx, &api.ListPathRequest{
+		TableType: api.TableType_ADJ_OUT,
+		Name:      "127.0.0.2",
+		Family:    &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+	}, func(d *api.Destination) {
+		for _, p := range d.GetPaths() {
+			for _, attr := range p.GetPattrs() {
+				nh := &api.NextHopAttribute{}
+				if attr.UnmarshalTo(nh) == nil {
+					nextHops[d.GetPrefix()] = nh.GetNextHop()
+				}
+			}
+		}
+	}))
+
+	r.Equal(map[string]string{"172.16.38.43/32": "10.9.9.9"}, nextHops)
+}
+
+func TestNewDegradedPrependPolicy(t *testing.T) {
+	r := require.New(t)
+
+	sets, policy := NewDegradedPrependPolicy([]uint32{3, 0, 1, 3})
+
+	r.Equal([]*api.DefinedSet{
+		{DefinedType: api.DefinedType_LARGE_COMMUNITY, Name: "anycastd-prepend-1", List: []string{"4294967295:0:1"}},
+		{DefinedType: api.DefinedType_LARGE_COMMUNITY, Name: "anycastd-prepend-3", List: []string{"4294967295:0:3"}},
+	}, sets)
+
+	r.Equal(DegradedPrependPolicyName, policy.Name)
+	r.Equal([]*api.Statement{
+		{
+			Name: "anycastd-prepend-1",
+			Conditions: &api.Conditions{
+				LargeCommunitySet: &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-prepend-1"},
+			},
+			Actions: &api.Actions{
+				RouteAction:    api.RouteAction_NONE,
+				AsPrepend:      &api.AsPrependAction{Repeat: 1, UseLeftMost: true},
+				LargeCommunity: &api.CommunityAction{Type: api.CommunityAction_REMOVE, Communities: []string{"4294967295:0:1"}},
+			},
+		},
+		{
+			Name: "anycastd-prepend-3",
+			Conditions: &api.Conditions{
+				LargeCommunitySet: &api.MatchSet{Type: api.MatchSet_ANY, Name: "anycastd-prepend-3"},
+			},
+			Actions: &api.Actions{
+				RouteAction:    api.RouteAction_NONE,
+				AsPrepend:      &api.AsPrependAction{Repeat: 3, UseLeftMost: true},
+				LargeCommunity: &api.CommunityAction{Type: api.CommunityAction_REMOVE, Communities: []string{"4294967295:0:3"}},
+			},
+		},
+	}, policy.Statements)
+
+	sets, policy = NewDegradedPrependPolicy([]uint32{0})
+	r.Nil(sets)
+	r.Nil(policy)
+}
+
+func TestDegradedPrependPolicyLocalAS(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	port := freeTCPPort(t)
+	srv := newTestBgpServer(t, 65999, "127.0.0.1", -1)
+	remote := newTestBgpServer(t, 65000, "127.0.0.2", int32(port), "127.0.0.2")
+
+	// the peer sees the local AS overridden for the session
+	r.NoError(srv.AddPeer(ctx, &api.AddPeerRequest{Peer: &api.Peer{
+		Conf:      &api.PeerConf{NeighborAddress: "127.0.0.2", PeerAsn: 65000, LocalAsn: 64512},
+		Transport: &api.Transport{LocalAddress: "127.0.0.1", RemotePort: uint32(port)},
+		Timers:    &api.Timers{Config: &api.TimersConfig{ConnectRetry: 1}},
+	}}))
+	r.NoError(remote.AddPeer(ctx, &api.AddPeerRequest{Peer: &api.Peer{
+		Conf:      &api.PeerConf{NeighborAddress: "127.0.0.1", PeerAsn: 64512},
+		Transport: &api.Transport{PassiveMode: true},
+	}}))
+
+	sets, policy := NewDegradedPrependPolicy([]uint32{2})
+	r.NoError(AddExportPolicies(ctx, srv, sets, []*api.Policy{policy}))
+
+	a := New(Config{
+		Name:     "dns",
+		Registry: NewRegistry(srv, SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32"),
+		NextHop:  "127.0.0.1",
+		Degraded: Degraded{ASPathPrepend: 2},
+	})
+	r.NoError(a.Degrade(ctx))
+
+	var asPath []uint32
+	var largeCommunities []*api.LargeCommunity
+	r.Eventually(func() bool {
+		r.NoError(remote.ListPath(ctx, &api.ListPathRequest{
+			TableType: api.TableType_GLOBAL,
+			Family:    &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+		}, func(d *api.Destination) {
+			for _, p := range d.GetPaths() {
+				for _, attr := range p.GetPattrs() {
+					asPathAttr := &api.AsPathAttribute{}
+					if attr.UnmarshalTo(asPathAttr) == nil {
+						asPath = nil
+						for _, s := range asPathAttr.GetSegments() {
+							asPath = append(asPath, s.GetNumbers()...)
+						}
+					}
+					lc := &api.LargeCommunitiesAttribute{}
+					if attr.UnmarshalTo(lc) == nil {
+						largeCommunities = lc.GetCommunities()
+					}
+				}
+			}
+		}))
+		return asPath != nil
+	}, 30*time.Second, 100*time.Millisecond)
+
+	r.Equal([]uint32{64512, 64512, 64512}, asPath)
+	r.Empty(largeCommunities)
+}
@@ -0,0 +1,273 @@
+package announcer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultReconcileInterval = 30 * time.Second
+
+	tableGlobal = "global"
+	tableAdjOut = "adj_out"
+)
+
+// reconcileFamilies are the address families of the announced paths.
+var reconcileFamilies = []*api.Family{
+	{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+	{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_UNICAST},
+	{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_MPLS_VPN},
+	{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_MPLS_VPN},
+	{Afi: api.Family_AFI_L2VPN, Safi: api.Family_SAFI_EVPN},
+}
+
+// RIBServer is the part of GoBGP server used to inspect RIBs.
+type RIBServer interface {
+	ListPath(ctx context.Context, r *api.ListPathRequest, fn func(*api.Destination)) error
+	ListPeer(ctx context.Context, r *api.ListPeerRequest, fn func(*api.Peer)) error
+	ResetPeer(ctx context.Context, r *api.ResetPeerRequest) error
+}
+
+// Reconciler periodically compares the paths the registry wants to be
+// announced with GoBGP global RIB and adj-RIB-out of the established peers
+// and repairs the drift: global RIB is fixed by adding or deleting the
+// paths, adj-RIB-out is resent to the peer by soft reset.
+type Reconciler struct {
+	registry *Registry
+	rib      RIBServer
+	metrics  ReconcilerMetrics
+	interval time.Duration
+}
+
+func NewReconciler(registry *Registry, rib RIBServer, metrics ReconcilerMetrics, interval time.Duration) *Reconciler {
+	if interval == 0 {
+		interval = DefaultReconcileInterval
+	}
+
+	return &Reconciler{
+		registry: registry,
+		rib:      rib,
+		metrics:  metrics,
+		interval: interval,
+	}
+}
+
+func (r *Reconciler) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.interval):
+			if err := r.reconcile(ctx); err != nil {
+				log.Warnf("RIB reconciliation failed: %s", err)
+			}
+		}
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) error {
+	drift, err := r.registry.reconcile(ctx, func() (map[string]*api.Path, error) {
+		return r.listGlobal(ctx)
+	})
+
+	// the prefixes failed to repair are not counted as repaired
+	repaired := drift
+	var partialErr *PartialError
+	if errors.As(err, &partialErr) {
+		repaired -= len(partialErr.Failed())
+	} else if err != nil {
+		return errors.Wrap(err, "error reconciling global RIB")
+	}
+
+	r.metrics.Drift(tableGlobal, "", drift)
+	r.metrics.Repaired(tableGlobal, "", repaired)
+	if err != nil {
+		return errors.Wrap(err, "error reconciling global RIB")
+	}
+
+	peers := []*api.Peer{}
+	if err := r.rib.ListPeer(ctx, &api.ListPeerRequest{}, func(p *api.Peer) {
+		peers = append(peers, p)
+	}); err != nil {
+		return errors.Wrap(err, "error listing peers")
+	}
+
+	announced := r.registry.announcedPaths()
+	for _, peer := range peers {
+		if peer.GetState().GetSessionState() != api.PeerState_ESTABLISHED {
+			continue
+		}
+
+		address := peerAddress(peer)
+		drift, err := r.adjOutDrift(ctx, peer, announced)
+		if err != nil {
+			return errors.Wrapf(err, "error reconciling adj-RIB-out of `%s`", address)
+		}
+
+		r.metrics.Drift(tableAdjOut, address, drift)
+		if drift == 0 {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"peer":  address,
+			"drift": drift,
+		}).Warn("adj-RIB-out doesn't match announced prefixes, resending")
+
+		if err := r.rib.ResetPeer(ctx, &api.ResetPeerRequest{
+			Address:   address,
+			Soft:      true,
+			Direction: api.ResetPeerRequest_OUT,
+		}); err != nil {
+			return errors.Wrapf(err, "error resending adj-RIB-out to `%s`", address)
+		}
+		r.metrics.Repaired(tableAdjOut, address, drift)
+	}
+
+	return nil
+}
+
+// adjOutDrift returns the amount of prefixes missing in or unexpected to be
+// in the peer adj-RIB-out for the families enabled on the peer. Prefixes
+// filtered by the export policy are in place as intended.
+func (r *Reconciler) adjOutDrift(ctx context.Context, peer *api.Peer, announced map[string]*api.Path) (int, error) {
+	drift := 0
+	for _, afiSafi := range peer.GetAfiSafis() {
+		family := afiSafi.GetConfig().GetFamily()
+		if !afiSafi.GetConfig().GetEnabled() || !isReconciledFamily(family) {
+			continue
+		}
+
+		actual, err := r.list(ctx, &api.ListPathRequest{
+			TableType:      api.TableType_ADJ_OUT,
+			Name:           peerAddress(peer),
+			Family:         family,
+			EnableFiltered: true,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for prefix, path := range announced {
+			if !sameFamily(path.GetFamily(), family) {
+				continue
+			}
+
+			if _, ok := actual[prefix]; !ok {
+				drift++
+			}
+			delete(actual, prefix)
+		}
+
+		for _, path := range actual {
+			if !path.GetFiltered() {
+				drift++
+			}
+		}
+	}
+	return drift, nil
+}
+
+func (r *Reconciler) listGlobal(ctx context.Context) (map[string]*api.Path, error) {
+	out := map[string]*api.Path{}
+	for _, family := range reconcileFamilies {
+		paths, err := r.list(ctx, &api.ListPathRequest{
+			TableType: api.TableType_GLOBAL,
+			Family:    family,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for prefix, path := range paths {
+			out[prefix] = path
+		}
+	}
+	return out, nil
+}
+
+// list returns locally originated paths of the table by prefixes including
+// the ones filtered by the export policy.
+func (r *Reconciler) list(ctx context.Context, req *api.ListPathRequest) (map[string]*api.Path, error) {
+	out := map[string]*api.Path{}
+	var decodeErr error
+	if err := r.rib.ListPath(ctx, req, func(d *api.Destination) {
+		for _, path := range d.GetPaths() {
+			if !isLocalPath(path) {
+				continue
+			}
+
+			prefix, err := pathPrefix(path)
+			if err != nil {
+				decodeErr = err
+				return
+			}
+			out[prefix] = path
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return out, decodeErr
+}
+
+// peerAddress returns address of the peer. Dynamic neighbors have no
+// configured address so the actual one is taken from the peer state.
+func peerAddress(peer *api.Peer) string {
+	if address := peer.GetConf().GetNeighborAddress(); address != "" {
+		return address
+	}
+	return peer.GetState().GetNeighborAddress()
+}
+
+// isLocalPath tells whether the path is originated locally rather than
+// received from a peer.
+func isLocalPath(path *api.Path) bool {
+	return net.ParseIP(path.GetNeighborIp()) == nil
+}
+
+func isReconciledFamily(family *api.Family) bool {
+	for _, f := range reconcileFamilies {
+		if sameFamily(f, family) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameFamily(a, b *api.Family) bool {
+	return a.GetAfi() == b.GetAfi() && a.GetSafi() == b.GetSafi()
+}
+
+// pathPrefix returns prefix of the path in the form the registry keeps it.
+func pathPrefix(path *api.Path) (string, error) {
+	v, err := path.GetNlri().UnmarshalNew()
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding path NLRI")
+	}
+
+	switch nlri := v.(type) {
+	case *api.IPAddressPrefix:
+		return prefixKey(fmt.Sprintf("%s/%d", nlri.GetPrefix(), nlri.GetPrefixLen())), nil
+	case *api.LabeledVPNIPAddressPrefix:
+		rd, err := formatRouteDistinguisher(nlri.GetRd())
+		if err != nil {
+			return "", err
+		}
+		return vrfPrefixKey(rd, fmt.Sprintf("%s/%d", nlri.GetPrefix(), nlri.GetPrefixLen())), nil
+	case *api.EVPNIPPrefixRoute:
+		rd, err := formatRouteDistinguisher(nlri.GetRd())
+		if err != nil {
+			return "", err
+		}
+		return vrfPrefixKey(rd, fmt.Sprintf("%s/%d", nlri.GetIpPrefix(), nlri.GetIpPrefixLen())), nil
+	default:
+		return "", errors.Errorf("unsupported path NLRI `%s`", path.GetNlri().GetTypeUrl())
+	}
+}
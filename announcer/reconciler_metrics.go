@@ -0,0 +1,56 @@
+package announcer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ReconcilerMetrics interface {
+	Drift(table, peer string, paths int)
+	Repaired(table, peer string, paths int)
+}
+
+type reconcilerMetrics struct {
+	driftPaths   *prometheus.GaugeVec
+	repairsTotal *prometheus.CounterVec
+}
+
+func NewReconcilerMetrics() (ReconcilerMetrics, error) {
+	driftPaths := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "anycastd",
+			Subsystem: "rib",
+			Name:      "drift_paths",
+			Help:      "Amount of paths differing from the desired ones on the last reconciliation",
+		},
+		[]string{"table", "peer"},
+	)
+
+	repairsTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "anycastd",
+			Subsystem: "rib",
+			Name:      "repaired_paths_total",
+			Help:      "Total amount of paths repaired by reconciliation",
+		},
+		[]string{"table", "peer"},
+	)
+
+	for _, m := range []prometheus.Collector{driftPaths, repairsTotal} {
+		if err := prometheus.Register(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return &reconcilerMetrics{
+		driftPaths:   driftPaths,
+		repairsTotal: repairsTotal,
+	}, nil
+}
+
+func (m *reconcilerMetrics) Drift(table, peer string, paths int) {
+	m.driftPaths.WithLabelValues(table, peer).Set(float64(paths))
+}
+
+func (m *reconcilerMetrics) Repaired(table, peer string, paths int) {
+	m.repairsTotal.WithLabelValues(table, peer).Add(float64(paths))
+}
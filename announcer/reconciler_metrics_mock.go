@@ -0,0 +1,23 @@
+package announcer
+
+import (
+	"github.com/stretchr/testify/mock"
+)
+
+var _ ReconcilerMetrics = (*ReconcilerMetricsMock)(nil)
+
+type ReconcilerMetricsMock struct {
+	mock.Mock
+}
+
+func NewReconcilerMetricsMock() *ReconcilerMetricsMock {
+	return &ReconcilerMetricsMock{}
+}
+
+func (m *ReconcilerMetricsMock) Drift(table, peer string, paths int) {
+	m.Called(table, peer, paths)
+}
+
+func (m *ReconcilerMetricsMock) Repaired(table, peer string, paths int) {
+	m.Called(table, peer, paths)
+}
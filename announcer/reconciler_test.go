@@ -0,0 +1,230 @@
+package announcer
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/server"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcilerGlobalRIB(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	srv := newTestBgpServer(t, 65999, "10.0.0.1", -1)
+
+	reg := NewRegistry(srv, SharePolicyAny)
+	a := New(Config{Name: "dns", Registry: reg, Routes: []Route{
+		{Prefix: "172.16.38.43/32", Communities: []string{"65000:100"}},
+		{Prefix: "2001:db8::43/128"},
+	}, NextHop: "10.0.0.1", NextHopIPv6: "2001:db8::1"})
+	_ = New(Config{Name: "http", Registry: reg, Routes: routesOf("172.16.38.44/32"), NextHop: "10.0.0.1"})
+
+	r.NoError(a.Announce(ctx))
+
+	metricsM := NewReconcilerMetricsMock()
+	defer metricsM.AssertExpectations(t)
+
+	rec := NewReconciler(reg, srv, metricsM, time.Second)
+
+	// no drift
+	metricsM.On("Drift", "global", "", 0).Return().Once()
+	metricsM.On("Repaired", "global", "", 0).Return().Once()
+	r.NoError(rec.reconcile(ctx))
+
+	// the path deleted behind the registry and unknown one are repaired
+	paths, err := a.(*announcer).newPathList(false)
+	r.NoError(err)
+	r.NoError(srv.DeletePath(ctx, &api.DeletePathRequest{Path: paths[0]}))
+
+	stray, err := New(Config{Name: "stray", Registry: NewRegistry(srv, SharePolicyAny), Routes: routesOf("172.16.38.45/32"), NextHop: "10.0.0.1"}).(*announcer).newPathList(false)
+	r.NoError(err)
+	_, err = srv.AddPath(ctx, &api.AddPathRequest{Path: stray[0]})
+	r.NoError(err)
+
+	metricsM.On("Drift", "global", "", 2).Return().Once()
+	metricsM.On("Repaired", "global", "", 2).Return().Once()
+	r.NoError(rec.reconcile(ctx))
+
+	global, err := rec.listGlobal(ctx)
+	r.NoError(err)
+	r.Len(global, 2)
+	r.Contains(global, "172.16.38.43/32")
+	r.Contains(global, "2001:db8::43/128")
+	r.True(samePath(paths[0], global["172.16.38.43/32"]))
+}
+
+func TestReconcilerGlobalRIBPartialRepair(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	// the paths are kept out of the server RIB by the mock so all of them
+	// are drifted
+	srv := newTestBgpServer(t, 65999, "10.0.0.1", -1)
+
+	goBgpM := newGoBGPMock()
+	defer goBgpM.AssertExpectations(t)
+
+	first := func(in string) bool {
+		return strings.Contains(in, `"172.16.38.43"`)
+	}
+	second := func(in string) bool {
+		return strings.Contains(in, `"172.16.38.44"`)
+	}
+
+	reg := NewRegistry(goBgpM, SharePolicyAny)
+	a := New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32", "172.16.38.44/32"), NextHop: "10.0.0.1"})
+
+	goBgpM.On("AddPath", mock.MatchedBy(first)).Return([]byte("1"), nil).Once()
+	goBgpM.On("AddPath", mock.MatchedBy(second)).Return([]byte("2"), nil).Once()
+	r.NoError(a.Announce(ctx))
+
+	goBgpM.On("AddPath", mock.MatchedBy(first)).Return([]byte("1"), nil).Once()
+	goBgpM.On("AddPath", mock.MatchedBy(second)).Return([]byte{}, errors.New("error")).Once()
+
+	metricsM := NewReconcilerMetricsMock()
+	defer metricsM.AssertExpectations(t)
+
+	metricsM.On("Drift", "global", "", 2).Return().Once()
+	metricsM.On("Repaired", "global", "", 1).Return().Once()
+
+	err := NewReconciler(reg, srv, metricsM, time.Second).reconcile(ctx)
+	r.EqualError(err, "error reconciling global RIB: change is not applied to 1 of 2 prefixes: 172.16.38.44/32: error")
+}
+
+func TestReconcilerAdjRIBOut(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	srv := newTestPeering(t)
+
+	reg := NewRegistry(srv, SharePolicyAny)
+	a := New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "127.0.0.1"})
+	r.NoError(a.Announce(ctx))
+
+	metricsM := NewReconcilerMetricsMock()
+	defer metricsM.AssertExpectations(t)
+
+	rec := NewReconciler(reg, srv, metricsM, time.Second)
+
+	metricsM.On("Drift", "global", "", 0).Return().Twice()
+	metricsM.On("Repaired", "global", "", 0).Return().Twice()
+	metricsM.On("Drift", "adj_out", "127.0.0.2", 0).Return().Once()
+	r.NoError(rec.reconcile(ctx))
+
+	// prefix filtered by the export policy is not the drift
+	r.NoError(srv.AddPolicy(ctx, &api.AddPolicyRequest{Policy: &api.Policy{
+		Name: "reject-all",
+		Statements: []*api.Statement{{
+			Name:    "reject-all",
+			Actions: &api.Actions{RouteAction: api.RouteAction_REJECT},
+		}},
+	}}))
+	r.NoError(srv.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{Assignment: &api.PolicyAssignment{
+		Name:          "global",
+		Direction:     api.PolicyDirection_EXPORT,
+		Policies:      []*api.Policy{{Name: "reject-all"}},
+		DefaultAction: api.RouteAction_ACCEPT,
+	}}))
+
+	metricsM.On("Drift", "adj_out", "127.0.0.2", 0).Return().Once()
+	r.NoError(rec.reconcile(ctx))
+
+	// prefix missing in adj-RIB-out is resent
+	rec = NewReconciler(reg, &emptyAdjOutRIB{BgpServer: srv}, metricsM, time.Second)
+
+	metricsM.On("Drift", "global", "", 0).Return().Once()
+	metricsM.On("Repaired", "global", "", 0).Return().Once()
+	metricsM.On("Drift", "adj_out", "127.0.0.2", 1).Return().Once()
+	metricsM.On("Repaired", "adj_out", "127.0.0.2", 1).Return().Once()
+	r.NoError(rec.reconcile(ctx))
+}
+
+// emptyAdjOutRIB hides adj-RIB-out contents of the server.
+type emptyAdjOutRIB struct {
+	*server.BgpServer
+}
+
+func (e *emptyAdjOutRIB) ListPath(ctx context.Context, r *api.ListPathRequest, fn func(*api.Destination)) error {
+	if r.GetTableType() == api.TableType_ADJ_OUT {
+		return nil
+	}
+	return e.BgpServer.ListPath(ctx, r, fn)
+}
+
+// newTestPeering returns the server peered with another one over loopback
+// addresses with the families enabled (IPv4 unicast if none are set).
+func newTestPeering(t *testing.T, families ...*api.Family) *server.BgpServer {
+	srv, _ := newTestPeers(t, families...)
+	return srv
+}
+
+// newTestPeers is newTestPeering returning the remote server as well.
+func newTestPeers(t *testing.T, families ...*api.Family) (*server.BgpServer, *server.BgpServer) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	port := freeTCPPort(t)
+
+	afiSafis := []*api.AfiSafi{}
+	for _, family := range families {
+		afiSafis = append(afiSafis, &api.AfiSafi{Config: &api.AfiSafiConfig{Family: family, Enabled: true}})
+	}
+
+	srv := newTestBgpServer(t, 65999, "127.0.0.1", -1)
+	remote := newTestBgpServer(t, 65000, "127.0.0.2", int32(port), "127.0.0.2")
+
+	r.NoError(srv.AddPeer(ctx, &api.AddPeerRequest{Peer: &api.Peer{
+		Conf:      &api.PeerConf{NeighborAddress: "127.0.0.2", PeerAsn: 65000},
+		Transport: &api.Transport{LocalAddress: "127.0.0.1", RemotePort: uint32(port)},
+		Timers:    &api.Timers{Config: &api.TimersConfig{ConnectRetry: 1}},
+		AfiSafis:  afiSafis,
+	}}))
+	r.NoError(remote.AddPeer(ctx, &api.AddPeerRequest{Peer: &api.Peer{
+		Conf:      &api.PeerConf{NeighborAddress: "127.0.0.1", PeerAsn: 65999},
+		Transport: &api.Transport{PassiveMode: true},
+		AfiSafis:  afiSafis,
+	}}))
+
+	r.Eventually(func() bool {
+		established := false
+		r.NoError(srv.ListPeer(ctx, &api.ListPeerRequest{}, func(p *api.Peer) {
+			established = p.GetState().GetSessionState() == api.PeerState_ESTABLISHED
+		}))
+		return established
+	}, 30*time.Second, 100*time.Millisecond)
+
+	return srv, remote
+}
+
+func newTestBgpServer(t *testing.T, asn uint32, routerID string, port int32, listenAddresses ...string) *server.BgpServer {
+	srv := server.NewBgpServer()
+	go srv.Serve()
+
+	require.NoError(t, srv.StartBgp(context.Background(), &api.StartBgpRequest{Global: &api.Global{
+		Asn:             asn,
+		RouterId:        routerID,
+		ListenPort:      port,
+		ListenAddresses: listenAddresses,
+	}}))
+	t.Cleanup(func() {
+		require.NoError(t, srv.StopBgp(context.Background(), &api.StopBgpRequest{}))
+	})
+
+	return srv
+}
+
+func freeTCPPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,393 @@
+package announcer
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	apb "google.golang.org/protobuf/types/known/anypb"
+)
+
+// SharePolicy defines when a prefix owned by several services is announced.
+type SharePolicy string
+
+const (
+	// SharePolicyAny keeps the prefix announced while at least one of its
+	// owners is healthy.
+	SharePolicyAny SharePolicy = "any"
+
+	// SharePolicyAll announces the prefix only while all of its owners are
+	// healthy and withdraws it as soon as any of them goes down.
+	SharePolicyAll SharePolicy = "all"
+)
+
+// Registry tracks which services want each prefix to be announced and
+// applies the changes to GoBGP so the prefix is withdrawn only when the
+// share policy says so.
+type Registry struct {
+	gobgp  GoBGPServer
+	policy SharePolicy
+
+	mutex    *sync.Mutex
+	prefixes map[string]*prefixState
+	draining bool
+}
+
+type prefixState struct {
+	owners    map[string]struct{}
+	wanted    map[string]wantedPath
+	announced *api.Path
+}
+
+// wantedPath is the path the owner wants to be announced for the prefix.
+type wantedPath struct {
+	path     *api.Path
+	degraded bool
+}
+
+func NewRegistry(gobgp GoBGPServer, policy SharePolicy) *Registry {
+	if policy == "" {
+		policy = SharePolicyAny
+	}
+
+	return &Registry{
+		gobgp:    gobgp,
+		policy:   policy,
+		mutex:    &sync.Mutex{},
+		prefixes: map[string]*prefixState{},
+	}
+}
+
+// Register marks owner as one of the services owning the prefix.
+func (r *Registry) Register(owner, prefix string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.state(prefix).owners[owner] = struct{}{}
+}
+
+// Announce marks the prefix as wanted by the owner with the given path and
+// announces it if the share policy allows. degraded tells the path is made
+// less preferred since the owner is degraded.
+func (r *Registry) Announce(ctx context.Context, owner, prefix string, path *api.Path, degraded bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	st := r.state(prefix)
+	if _, ok := st.owners[owner]; !ok {
+		return errors.Errorf("service `%s` is not registered as an owner of `%s`", owner, prefix)
+	}
+
+	st.wanted[owner] = wantedPath{path: path, degraded: degraded}
+
+	return r.apply(ctx, prefix, st)
+}
+
+// Withdraw marks the prefix as not wanted by the owner and withdraws it if
+// the share policy says so.
+func (r *Registry) Withdraw(ctx context.Context, owner, prefix string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	st := r.state(prefix)
+	delete(st.wanted, owner)
+
+	return r.apply(ctx, prefix, st)
+}
+
+// Drain re-announces all the announced prefixes with GRACEFUL_SHUTDOWN
+// community (RFC 8326) so the peers move the traffic away before the
+// prefixes are withdrawn. Changes made by the owners after the drain is
+// started are not applied anymore.
+func (r *Registry) Drain(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.draining = true
+
+	for prefix, st := range r.prefixes {
+		if st.announced == nil {
+			continue
+		}
+
+		path, err := withCommunity(st.announced, GracefulShutdownCommunity)
+		if err != nil {
+			return errors.Wrapf(err, "error adding graceful shutdown community to `%s`", prefix)
+		}
+
+		log.WithFields(log.Fields{
+			"prefix": prefix,
+		}).Debug("announcing prefix with graceful shutdown community")
+
+		if _, err := r.gobgp.AddPath(ctx, &api.AddPathRequest{
+			Path: path,
+		}); err != nil {
+			return err
+		}
+		st.announced = path
+	}
+
+	return nil
+}
+
+// WithdrawAll withdraws all the announced prefixes regardless of the
+// owners. Changes made by the owners afterwards are not applied anymore.
+func (r *Registry) WithdrawAll(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.draining = true
+
+	for prefix, st := range r.prefixes {
+		if st.announced == nil {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"prefix": prefix,
+		}).Debug("withdrawing prefix")
+
+		if err := r.gobgp.DeletePath(ctx, &api.DeletePathRequest{
+			Path: st.announced,
+		}); err != nil {
+			return err
+		}
+		st.announced = nil
+	}
+
+	return nil
+}
+
+// reconcile makes GoBGP global RIB match the desired state and returns the
+// amount of drifted prefixes. list is called with the registry locked so the
+// owners can't change the state while it's reconciled. All of the drifted
+// prefixes are repaired as far as possible, *PartialError with the outcome of
+// every drifted prefix is returned if some of them are failed.
+func (r *Registry) reconcile(ctx context.Context, list func() (map[string]*api.Path, error)) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	actual, err := list()
+	if err != nil {
+		return 0, err
+	}
+
+	results := []PrefixResult{}
+	failed := false
+	for prefix, st := range r.prefixes {
+		want := r.desired(st)
+		if r.draining {
+			want = st.announced
+		}
+
+		have, ok := actual[prefix]
+		delete(actual, prefix)
+
+		var err error
+		switch {
+		case want == nil && !ok:
+			continue
+		case want == nil:
+			log.WithFields(log.Fields{
+				"prefix": prefix,
+			}).Warn("prefix is announced while it must not, withdrawing")
+
+			err = r.gobgp.DeletePath(ctx, &api.DeletePathRequest{
+				Path: have,
+			})
+		case !ok || !samePath(want, have):
+			log.WithFields(log.Fields{
+				"prefix": prefix,
+			}).Warn("prefix is not announced as desired, announcing")
+
+			_, err = r.gobgp.AddPath(ctx, &api.AddPathRequest{
+				Path: want,
+			})
+		default:
+			st.announced = want
+			continue
+		}
+
+		results = append(results, PrefixResult{Prefix: prefix, Err: err})
+		if err != nil {
+			failed = true
+			continue
+		}
+		st.announced = want
+	}
+
+	for prefix, have := range actual {
+		log.WithFields(log.Fields{
+			"prefix": prefix,
+		}).Warn("unknown prefix is announced, withdrawing")
+
+		err := r.gobgp.DeletePath(ctx, &api.DeletePathRequest{
+			Path: have,
+		})
+		results = append(results, PrefixResult{Prefix: prefix, Err: err})
+		if err != nil {
+			failed = true
+		}
+	}
+
+	if failed {
+		return len(results), &PartialError{Results: results}
+	}
+	return len(results), nil
+}
+
+// announcedPaths returns the paths currently announced by prefixes.
+func (r *Registry) announcedPaths() map[string]*api.Path {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	out := map[string]*api.Path{}
+	for prefix, st := range r.prefixes {
+		if st.announced != nil {
+			out[prefix] = st.announced
+		}
+	}
+	return out
+}
+
+func (r *Registry) state(prefix string) *prefixState {
+	key := prefixKey(prefix)
+
+	st, ok := r.prefixes[key]
+	if !ok {
+		st = &prefixState{
+			owners: map[string]struct{}{},
+			wanted: map[string]wantedPath{},
+		}
+		r.prefixes[key] = st
+	}
+	return st
+}
+
+// desired returns the path which must be announced for the prefix or nil if
+// the prefix must be withdrawn. When several owners want the prefix the most
+// preferred path is used: the one of the healthy owner rather than of the
+// degraded one, then the one with the lowest MED, then the one of the first
+// owner in alphabetical order.
+func (r *Registry) desired(st *prefixState) *api.Path {
+	switch r.policy {
+	case SharePolicyAll:
+		if len(st.wanted) < len(st.owners) {
+			return nil
+		}
+	default:
+		if len(st.wanted) == 0 {
+			return nil
+		}
+	}
+
+	owners := make([]string, 0, len(st.wanted))
+	for owner := range st.wanted {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	best := st.wanted[owners[0]]
+	for _, owner := range owners[1:] {
+		w := st.wanted[owner]
+		switch {
+		case w.degraded != best.degraded:
+			if !w.degraded {
+				best = w
+			}
+		case pathMED(w.path) < pathMED(best.path):
+			best = w
+		}
+	}
+	return best.path
+}
+
+// pathMED returns MED of the path, paths without MED are treated as having
+// zero MED as GoBGP does.
+func pathMED(path *api.Path) uint32 {
+	med := &api.MultiExitDiscAttribute{}
+	for _, attr := range path.GetPattrs() {
+		if attr.MessageIs(med) && attr.UnmarshalTo(med) == nil {
+			return med.GetMed()
+		}
+	}
+	return 0
+}
+
+func (r *Registry) apply(ctx context.Context, prefix string, st *prefixState) error {
+	if r.draining {
+		return nil
+	}
+
+	path := r.desired(st)
+
+	if path == nil {
+		if st.announced == nil {
+			return nil
+		}
+
+		log.WithFields(log.Fields{
+			"prefix": prefix,
+			"policy": r.policy,
+		}).Debug("withdrawing prefix")
+
+		if err := r.gobgp.DeletePath(ctx, &api.DeletePathRequest{
+			Path: st.announced,
+		}); err != nil {
+			return err
+		}
+		st.announced = nil
+		return nil
+	}
+
+	if st.announced != nil && proto.Equal(st.announced, path) {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"prefix": prefix,
+		"policy": r.policy,
+	}).Debug("announcing prefix")
+
+	if _, err := r.gobgp.AddPath(ctx, &api.AddPathRequest{
+		Path: path,
+	}); err != nil {
+		return err
+	}
+	st.announced = path
+
+	return nil
+}
+
+func prefixKey(prefix string) string {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return prefix
+	}
+	return ipNet.String()
+}
+
+// samePath compares NLRI and attributes of the paths regardless of the
+// attributes order since GoBGP returns them sorted by type.
+func samePath(a, b *api.Path) bool {
+	if !proto.Equal(a.GetNlri(), b.GetNlri()) || len(a.GetPattrs()) != len(b.GetPattrs()) {
+		return false
+	}
+
+	attrs := map[string]*apb.Any{}
+	for _, attr := range a.GetPattrs() {
+		attrs[attr.GetTypeUrl()] = attr
+	}
+
+	for _, attr := range b.GetPattrs() {
+		if !proto.Equal(attrs[attr.GetTypeUrl()], attr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package announcer
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrySharePolicyAny(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	goBgpM := newGoBGPMock()
+	matcher := mock.MatchedBy(func(in string) bool {
+		return reProtoString.MatchString(in)
+	})
+
+	call1 := goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).Once()
+	goBgpM.On("DeletePath", matcher).Return(nil).NotBefore(call1).Once()
+
+	reg := NewRegistry(goBgpM, SharePolicyAny)
+	a1 := New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14"})
+	a2 := New(Config{Name: "http", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14"})
+
+	r.NoError(a1.Announce(ctx))
+	r.NoError(a2.Announce(ctx))
+	r.NoError(a1.Announce(ctx))
+
+	// http is still healthy so the prefix must stay announced
+	r.NoError(a1.Denounce(ctx))
+	goBgpM.AssertNotCalled(t, "DeletePath", matcher)
+
+	r.NoError(a2.Denounce(ctx))
+	r.NoError(a2.Denounce(ctx))
+
+	goBgpM.AssertExpectations(t)
+}
+
+func TestRegistrySharePolicyAll(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	goBgpM := newGoBGPMock()
+	matcher := mock.MatchedBy(func(in string) bool {
+		return reProtoString.MatchString(in)
+	})
+
+	reg := NewRegistry(goBgpM, SharePolicyAll)
+	a1 := New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14"})
+	a2 := New(Config{Name: "http", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14"})
+
+	// dns alone is not enough to announce the prefix
+	r.NoError(a1.Announce(ctx))
+	goBgpM.AssertNotCalled(t, "AddPath", matcher)
+
+	call1 := goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).Once()
+	goBgpM.On("DeletePath", matcher).Return(nil).NotBefore(call1).Once()
+
+	r.NoError(a2.Announce(ctx))
+	r.NoError(a1.Denounce(ctx))
+	r.NoError(a2.Denounce(ctx))
+
+	goBgpM.AssertExpectations(t)
+}
+
+func TestRegistrySharedPrefixPreference(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	goBgpM := newGoBGPMock()
+	defer goBgpM.AssertExpectations(t)
+
+	matcher := mock.MatchedBy(func(in string) bool {
+		return reProtoString.MatchString(in)
+	})
+	goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).Times(4)
+
+	reg := NewRegistry(goBgpM, SharePolicyAny)
+	dns := New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14", Degraded: Degraded{MED: 500}})
+	http := New(Config{Name: "http", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14"})
+
+	announcedMED := func() uint32 {
+		return pathMED(reg.prefixes["172.16.38.43/32"].announced)
+	}
+
+	r.NoError(dns.Degrade(ctx))
+	r.Equal(uint32(500), announcedMED())
+
+	// the path of the healthy owner is preferred to the degraded one
+	// regardless of the owners order
+	r.NoError(http.Announce(ctx))
+	r.Zero(announcedMED())
+
+	r.NoError(dns.(MEDSetter).SetMED(ctx, 50))
+	r.NoError(dns.Announce(ctx))
+	r.Zero(announcedMED())
+
+	// the path with the lowest MED is preferred among the healthy owners
+	r.NoError(http.(MEDSetter).SetMED(ctx, 100))
+	r.Equal(uint32(50), announcedMED())
+
+	r.NoError(http.Denounce(ctx))
+	r.Equal(uint32(50), announcedMED())
+
+	// the degraded path is announced once there's no healthy owner
+	r.NoError(dns.Degrade(ctx))
+	r.Equal(uint32(500), announcedMED())
+}
+
+func TestRegistryUnknownOwner(t *testing.T) {
+	r := require.New(t)
+
+	reg := NewRegistry(newGoBGPMock(), SharePolicyAny)
+	reg.Register("dns", "172.16.38.43/32")
+
+	err := reg.Announce(context.Background(), "http", "172.16.38.43/32", nil, false)
+	r.Error(err)
+	r.Equal("service `http` is not registered as an owner of `172.16.38.43/32`", err.Error())
+}
+
+func TestRegistryDrainAndWithdrawAll(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	goBgpM := newGoBGPMock()
+	matcher := mock.MatchedBy(func(in string) bool {
+		return reProtoString.MatchString(in)
+	})
+
+	announce := goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).Once()
+	drain := goBgpM.On("AddPath", matcher).Return([]byte("123456"), nil).NotBefore(announce).Once()
+	goBgpM.On("DeletePath", matcher).Return(nil).NotBefore(drain).Once()
+
+	reg := NewRegistry(goBgpM, SharePolicyAny)
+	a := New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "172.12.33.14"})
+	_ = New(Config{Name: "http", Registry: reg, Routes: routesOf("172.16.38.44/32"), NextHop: "172.12.33.14"})
+
+	r.NoError(a.Announce(ctx))
+	r.NoError(reg.Drain(ctx))
+
+	communities := &api.CommunitiesAttribute{}
+	for _, attr := range reg.prefixes["172.16.38.43/32"].announced.Pattrs {
+		if attr.MessageIs(communities) {
+			r.NoError(attr.UnmarshalTo(communities))
+		}
+	}
+	r.Equal([]uint32{GracefulShutdownCommunity}, communities.Communities)
+
+	// changes made during the drain are not applied
+	r.NoError(a.Denounce(ctx))
+
+	r.NoError(reg.WithdrawAll(ctx))
+	r.NoError(reg.WithdrawAll(ctx))
+
+	goBgpM.AssertExpectations(t)
+}
@@ -0,0 +1,161 @@
+package announcer
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/pkg/errors"
+	apb "google.golang.org/protobuf/types/known/anypb"
+)
+
+// VRF defines the VRF the routes are announced into. The routes are
+// announced as VPN routes (RFC 4364, RFC 4659) or as EVPN IP prefix routes
+// (RFC 9136) with the route distinguisher, MPLS label and export route
+// targets of the VRF.
+type VRF struct {
+	RD        string
+	ExportRTs []string
+	Label     uint32
+	EVPN      bool
+}
+
+// ParseRouteDistinguisher parses route distinguisher (RFC 4364) in
+// `ASN:value` or `IPv4:value` format. 4-byte ASN format is used for ASNs
+// not fitting into 16 bits.
+func ParseRouteDistinguisher(in string) (*apb.Any, error) {
+	parts := strings.Split(in, ":")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid route distinguisher `%s`: `admin:value` format expected", in)
+	}
+
+	if ip := net.ParseIP(parts[0]); ip != nil {
+		if ip.To4() == nil {
+			return nil, errors.Errorf("invalid route distinguisher `%s`: IPv4 address expected", in)
+		}
+
+		value, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("invalid route distinguisher `%s`: value must be 16-bit integer", in)
+		}
+
+		return apb.New(&api.RouteDistinguisherIPAddress{
+			Admin:    ip.String(),
+			Assigned: uint32(value),
+		})
+	}
+
+	asn, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("invalid route distinguisher `%s`: ASN must be 32-bit integer", in)
+	}
+
+	if asn > math.MaxUint16 {
+		value, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return nil, errors.Errorf("invalid route distinguisher `%s`: value must be 16-bit integer", in)
+		}
+
+		return apb.New(&api.RouteDistinguisherFourOctetASN{
+			Admin:    uint32(asn),
+			Assigned: uint32(value),
+		})
+	}
+
+	value, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("invalid route distinguisher `%s`: value must be 32-bit integer", in)
+	}
+
+	return apb.New(&api.RouteDistinguisherTwoOctetASN{
+		Admin:    uint32(asn),
+		Assigned: uint32(value),
+	})
+}
+
+func formatRouteDistinguisher(rd *apb.Any) (string, error) {
+	v, err := rd.UnmarshalNew()
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding route distinguisher")
+	}
+
+	switch v := v.(type) {
+	case *api.RouteDistinguisherTwoOctetASN:
+		return strconv.FormatUint(uint64(v.GetAdmin()), 10) + ":" + strconv.FormatUint(uint64(v.GetAssigned()), 10), nil
+	case *api.RouteDistinguisherIPAddress:
+		return v.GetAdmin() + ":" + strconv.FormatUint(uint64(v.GetAssigned()), 10), nil
+	case *api.RouteDistinguisherFourOctetASN:
+		return strconv.FormatUint(uint64(v.GetAdmin()), 10) + ":" + strconv.FormatUint(uint64(v.GetAssigned()), 10), nil
+	default:
+		return "", errors.Errorf("unsupported route distinguisher type `%s`", rd.GetTypeUrl())
+	}
+}
+
+// vrfPrefixKey returns the key the prefix announced into the VRF with the
+// route distinguisher is kept by in the registry.
+func vrfPrefixKey(rd, prefix string) string {
+	if v, err := ParseRouteDistinguisher(rd); err == nil {
+		if s, err := formatRouteDistinguisher(v); err == nil {
+			rd = s
+		}
+	}
+	return rd + ":" + prefixKey(prefix)
+}
+
+// newVRFReach returns the family, the NLRI and MP_REACH_NLRI attribute of
+// the prefix announced into the VRF.
+func (a *announcer) newVRFReach(prefix string, ipNet *net.IPNet) (*api.Family, *apb.Any, *apb.Any, error) {
+	nextHop, version, gateway := a.nextHop, "IPv4", "0.0.0.0"
+	afi := api.Family_AFI_IP
+	if ipNet.IP.To4() == nil {
+		nextHop, version, gateway = a.nextHopIPv6, "IPv6", "::"
+		afi = api.Family_AFI_IP6
+	}
+	if nextHop == "" {
+		return nil, nil, nil, errors.Errorf("no %s next hop is configured for `%s`", version, prefix)
+	}
+
+	rd, err := ParseRouteDistinguisher(a.vrf.RD)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	prefixLen, _ := ipNet.Mask.Size()
+
+	var family *api.Family
+	var nlri *apb.Any
+	if a.vrf.EVPN {
+		family = &api.Family{Afi: api.Family_AFI_L2VPN, Safi: api.Family_SAFI_EVPN}
+		nlri, err = apb.New(&api.EVPNIPPrefixRoute{
+			Rd:          rd,
+			Esi:         &api.EthernetSegmentIdentifier{},
+			IpPrefix:    ipNet.IP.String(),
+			IpPrefixLen: uint32(prefixLen),
+			GwAddress:   gateway,
+			Label:       a.vrf.Label,
+		})
+	} else {
+		family = &api.Family{Afi: afi, Safi: api.Family_SAFI_MPLS_VPN}
+		nlri, err = apb.New(&api.LabeledVPNIPAddressPrefix{
+			Labels:    []uint32{a.vrf.Label},
+			Rd:        rd,
+			Prefix:    ipNet.IP.String(),
+			PrefixLen: uint32(prefixLen),
+		})
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	reach, err := apb.New(&api.MpReachNLRIAttribute{
+		Family:   family,
+		NextHops: []string{nextHop},
+		Nlris:    []*apb.Any{nlri},
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return family, nlri, reach, nil
+}
@@ -0,0 +1,160 @@
+package announcer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRouteDistinguisher(t *testing.T) {
+	type testCase struct {
+		in       string
+		expected string
+		expError string
+	}
+
+	tcs := []testCase{
+		{in: "65000:100", expected: "65000:100"},
+		{in: "4200000000:100", expected: "4200000000:100"},
+		{in: "10.0.0.1:100", expected: "10.0.0.1:100"},
+		{in: "65000:0100", expected: "65000:100"},
+		{in: "65000", expError: "invalid route distinguisher `65000`: `admin:value` format expected"},
+		{in: "2001:db8::1:100", expError: "invalid route distinguisher `2001:db8::1:100`: `admin:value` format expected"},
+		{in: "4200000000:70000", expError: "invalid route distinguisher `4200000000:70000`: value must be 16-bit integer"},
+		{in: "10.0.0.1:70000", expError: "invalid route distinguisher `10.0.0.1:70000`: value must be 16-bit integer"},
+		{in: "customer:100", expError: "invalid route distinguisher `customer:100`: ASN must be 32-bit integer"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.in, func(t *testing.T) {
+			r := require.New(t)
+
+			rd, err := ParseRouteDistinguisher(tc.in)
+			if tc.expError != "" {
+				r.Error(err)
+				r.Equal(tc.expError, err.Error())
+				return
+			}
+			r.NoError(err)
+
+			s, err := formatRouteDistinguisher(rd)
+			r.NoError(err)
+			r.Equal(tc.expected, s)
+		})
+	}
+}
+
+func TestNewPathListVPN(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:        "test_service",
+		Registry:    NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes:      routesOf("172.16.38.43/32", "2001:db8::43/128"),
+		NextHop:     "172.12.33.14",
+		NextHopIPv6: "2001:db8::14",
+		VRF:         &VRF{RD: "65000:100", ExportRTs: []string{"65000:100", "65000:200"}, Label: 1000},
+	}).(*announcer)
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	r.Len(pp, 2)
+
+	r.Equal(api.Family_AFI_IP, pp[0].Family.Afi)
+	r.Equal(api.Family_SAFI_MPLS_VPN, pp[0].Family.Safi)
+	nlri := &api.LabeledVPNIPAddressPrefix{}
+	r.NoError(pp[0].Nlri.UnmarshalTo(nlri))
+	r.Equal("172.16.38.43", nlri.Prefix)
+	r.Equal(uint32(32), nlri.PrefixLen)
+	r.Equal([]uint32{1000}, nlri.Labels)
+
+	rd := &api.RouteDistinguisherTwoOctetASN{}
+	r.NoError(nlri.Rd.UnmarshalTo(rd))
+	r.Equal(uint32(65000), rd.Admin)
+	r.Equal(uint32(100), rd.Assigned)
+
+	mpReach := &api.MpReachNLRIAttribute{}
+	r.NoError(pp[0].Pattrs[1].UnmarshalTo(mpReach))
+	r.Equal([]string{"172.12.33.14"}, mpReach.NextHops)
+
+	extCommunities := &api.ExtendedCommunitiesAttribute{}
+	r.NoError(pp[0].Pattrs[2].UnmarshalTo(extCommunities))
+	r.Len(extCommunities.Communities, 2)
+
+	r.Equal(api.Family_AFI_IP6, pp[1].Family.Afi)
+	r.Equal(api.Family_SAFI_MPLS_VPN, pp[1].Family.Safi)
+	r.NoError(pp[1].Pattrs[1].UnmarshalTo(mpReach))
+	r.Equal([]string{"2001:db8::14"}, mpReach.NextHops)
+}
+
+func TestNewPathListEVPN(t *testing.T) {
+	r := require.New(t)
+
+	a := New(Config{
+		Name:     "test_service",
+		Registry: NewRegistry(newGoBGPMock(), SharePolicyAny),
+		Routes:   routesOf("172.16.38.43/32"),
+		NextHop:  "172.12.33.14",
+		VRF:      &VRF{RD: "10.0.0.1:100", ExportRTs: []string{"65000:100"}, Label: 1000, EVPN: true},
+	}).(*announcer)
+
+	pp, err := a.newPathList(false)
+	r.NoError(err)
+	r.Len(pp, 1)
+
+	r.Equal(api.Family_AFI_L2VPN, pp[0].Family.Afi)
+	r.Equal(api.Family_SAFI_EVPN, pp[0].Family.Safi)
+	nlri := &api.EVPNIPPrefixRoute{}
+	r.NoError(pp[0].Nlri.UnmarshalTo(nlri))
+	r.Equal("172.16.38.43", nlri.IpPrefix)
+	r.Equal(uint32(32), nlri.IpPrefixLen)
+	r.Equal("0.0.0.0", nlri.GwAddress)
+	r.Equal(uint32(1000), nlri.Label)
+
+	key, err := pathPrefix(pp[0])
+	r.NoError(err)
+	r.Equal("10.0.0.1:100:172.16.38.43/32", key)
+	r.Equal(key, a.prefixKey(a.routes[0]))
+}
+
+func TestVRFAdjRIBOut(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	vpn := &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_MPLS_VPN}
+	evpn := &api.Family{Afi: api.Family_AFI_L2VPN, Safi: api.Family_SAFI_EVPN}
+	srv := newTestPeering(t, vpn, evpn)
+
+	reg := NewRegistry(srv, SharePolicyAny)
+	for _, a := range []Announcer{
+		New(Config{Name: "dns", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "127.0.0.1", VRF: &VRF{RD: "65000:100", ExportRTs: []string{"65000:100"}, Label: 100}}),
+		New(Config{Name: "dns-evpn", Registry: reg, Routes: routesOf("172.16.38.43/32"), NextHop: "127.0.0.1", VRF: &VRF{RD: "65000:200", ExportRTs: []string{"65000:200"}, Label: 200, EVPN: true}}),
+	} {
+		r.NoError(a.Announce(ctx))
+	}
+
+	r.Eventually(func() bool {
+		count := 0
+		for _, family := range []*api.Family{vpn, evpn} {
+			r.NoError(srv.ListPath(ctx, &api.ListPathRequest{
+				TableType: api.TableType_ADJ_OUT,
+				Name:      "127.0.0.2",
+				Family:    family,
+			}, func(d *api.Destination) {
+				count += len(d.GetPaths())
+			}))
+		}
+		return count == 2
+	}, 10*time.Second, 100*time.Millisecond)
+
+	metricsM := NewReconcilerMetricsMock()
+	defer metricsM.AssertExpectations(t)
+
+	metricsM.On("Drift", "global", "", 0).Return().Once()
+	metricsM.On("Repaired", "global", "", 0).Return().Once()
+	metricsM.On("Drift", "adj_out", "127.0.0.2", 0).Return().Once()
+	r.NoError(NewReconciler(reg, srv, metricsM, time.Second).reconcile(ctx))
+}
@@ -0,0 +1,56 @@
+package bfd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Metrics interface {
+	SessionState(peer string, from, to State)
+}
+
+type metrics struct {
+	sessionState *prometheus.GaugeVec
+	sessionDown  *prometheus.CounterVec
+}
+
+func NewMetrics() (Metrics, error) {
+	m := newMetrics()
+	for _, c := range []prometheus.Collector{m.sessionState, m.sessionDown} {
+		if err := prometheus.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		sessionState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "anycastd",
+				Subsystem: "bfd",
+				Name:      "session_state",
+				Help:      "BFD session state 0=admin_down, 1=down, 2=init, 3=up",
+			},
+			[]string{"peer"},
+		),
+		sessionDown: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "anycastd",
+				Subsystem: "bfd",
+				Name:      "session_down_total",
+				Help:      "Amount of times BFD session went down from up state",
+			},
+			[]string{"peer"},
+		),
+	}
+}
+
+// SessionState reports the state of the session, the session going down is
+// counted only if it was up.
+func (m *metrics) SessionState(peer string, from, to State) {
+	m.sessionState.WithLabelValues(peer).Set(float64(to))
+	if from == StateUp && to == StateDown {
+		m.sessionDown.WithLabelValues(peer).Inc()
+	}
+}
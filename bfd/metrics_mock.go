@@ -0,0 +1,19 @@
+package bfd
+
+import (
+	"github.com/stretchr/testify/mock"
+)
+
+var _ Metrics = (*MetricsMock)(nil)
+
+type MetricsMock struct {
+	mock.Mock
+}
+
+func NewMetricsMock() *MetricsMock {
+	return &MetricsMock{}
+}
+
+func (m *MetricsMock) SessionState(peer string, from, to State) {
+	m.Called(peer, from, to)
+}
@@ -0,0 +1,24 @@
+package bfd
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsSessionDown(t *testing.T) {
+	r := require.New(t)
+
+	m := newMetrics()
+
+	m.SessionState("10.0.0.1", StateDown, StateInit)
+	m.SessionState("10.0.0.1", StateInit, StateDown)
+	m.SessionState("10.0.0.1", StateAdminDown, StateDown)
+	r.Equal(float64(StateDown), testutil.ToFloat64(m.sessionState.WithLabelValues("10.0.0.1")))
+	r.Zero(testutil.ToFloat64(m.sessionDown.WithLabelValues("10.0.0.1")))
+
+	m.SessionState("10.0.0.1", StateDown, StateUp)
+	m.SessionState("10.0.0.1", StateUp, StateDown)
+	r.Equal(float64(1), testutil.ToFloat64(m.sessionDown.WithLabelValues("10.0.0.1")))
+}
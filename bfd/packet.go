@@ -0,0 +1,130 @@
+package bfd
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	version      = 1
+	packetLength = 24
+)
+
+// Diagnostic codes as defined in RFC 5880 section 4.1.
+const (
+	diagNone                 uint8 = 0
+	diagControlDetectExpired uint8 = 1
+	diagNeighborSignaledDown uint8 = 3
+	diagAdminDown            uint8 = 7
+)
+
+const (
+	flagPoll        = 0x20
+	flagFinal       = 0x10
+	flagAuthPresent = 0x04
+	flagMultipoint  = 0x01
+	stateShift      = 6
+	diagMask        = 0x1f
+	versionShift    = 5
+)
+
+// packet is BFD Control packet (RFC 5880 section 4.1) without
+// authentication section.
+type packet struct {
+	Diag                      uint8
+	State                     State
+	Poll                      bool
+	Final                     bool
+	DetectMult                uint8
+	MyDiscriminator           uint32
+	YourDiscriminator         uint32
+	DesiredMinTxInterval      time.Duration
+	RequiredMinRxInterval     time.Duration
+	RequiredMinEchoRxInterval time.Duration
+}
+
+func (p *packet) marshal() []byte {
+	out := make([]byte, packetLength)
+
+	out[0] = version<<versionShift | p.Diag&diagMask
+
+	out[1] = byte(p.State) << stateShift
+	if p.Poll {
+		out[1] |= flagPoll
+	}
+	if p.Final {
+		out[1] |= flagFinal
+	}
+
+	out[2] = p.DetectMult
+	out[3] = packetLength
+
+	binary.BigEndian.PutUint32(out[4:8], p.MyDiscriminator)
+	binary.BigEndian.PutUint32(out[8:12], p.YourDiscriminator)
+	binary.BigEndian.PutUint32(out[12:16], toMicroseconds(p.DesiredMinTxInterval))
+	binary.BigEndian.PutUint32(out[16:20], toMicroseconds(p.RequiredMinRxInterval))
+	binary.BigEndian.PutUint32(out[20:24], toMicroseconds(p.RequiredMinEchoRxInterval))
+
+	return out
+}
+
+// unmarshalPacket decodes BFD Control packet and performs the reception
+// checks of RFC 5880 section 6.8.6 not depending on the session state.
+func unmarshalPacket(data []byte) (*packet, error) {
+	if len(data) < packetLength {
+		return nil, errors.Errorf("packet is too short: %d bytes", len(data))
+	}
+
+	if v := data[0] >> versionShift; v != version {
+		return nil, errors.Errorf("unsupported version: %d", v)
+	}
+
+	if l := int(data[3]); l < packetLength || l > len(data) {
+		return nil, errors.Errorf("invalid length: %d", l)
+	}
+
+	if data[1]&flagAuthPresent != 0 {
+		return nil, errors.New("authentication is not supported")
+	}
+
+	if data[1]&flagMultipoint != 0 {
+		return nil, errors.New("multipoint bit is set")
+	}
+
+	p := &packet{
+		Diag:                      data[0] & diagMask,
+		State:                     State(data[1] >> stateShift),
+		Poll:                      data[1]&flagPoll != 0,
+		Final:                     data[1]&flagFinal != 0,
+		DetectMult:                data[2],
+		MyDiscriminator:           binary.BigEndian.Uint32(data[4:8]),
+		YourDiscriminator:         binary.BigEndian.Uint32(data[8:12]),
+		DesiredMinTxInterval:      fromMicroseconds(binary.BigEndian.Uint32(data[12:16])),
+		RequiredMinRxInterval:     fromMicroseconds(binary.BigEndian.Uint32(data[16:20])),
+		RequiredMinEchoRxInterval: fromMicroseconds(binary.BigEndian.Uint32(data[20:24])),
+	}
+
+	if p.DetectMult == 0 {
+		return nil, errors.New("detect multiplier is zero")
+	}
+
+	if p.MyDiscriminator == 0 {
+		return nil, errors.New("my discriminator is zero")
+	}
+
+	if p.YourDiscriminator == 0 && p.State != StateDown && p.State != StateAdminDown {
+		return nil, errors.Errorf("your discriminator is zero in %s state", p.State)
+	}
+
+	return p, nil
+}
+
+func toMicroseconds(d time.Duration) uint32 {
+	return uint32(d / time.Microsecond)
+}
+
+func fromMicroseconds(v uint32) time.Duration {
+	return time.Duration(v) * time.Microsecond
+}
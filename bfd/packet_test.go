@@ -0,0 +1,102 @@
+package bfd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketMarshalUnmarshal(t *testing.T) {
+	r := require.New(t)
+
+	p := &packet{
+		Diag:                  diagControlDetectExpired,
+		State:                 StateUp,
+		Poll:                  true,
+		DetectMult:            3,
+		MyDiscriminator:       1,
+		YourDiscriminator:     2,
+		DesiredMinTxInterval:  300 * time.Millisecond,
+		RequiredMinRxInterval: time.Second,
+	}
+
+	data := p.marshal()
+	r.Equal([]byte{
+		0x21, 0xe0, 0x03, 0x18,
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x02,
+		0x00, 0x04, 0x93, 0xe0,
+		0x00, 0x0f, 0x42, 0x40,
+		0x00, 0x00, 0x00, 0x00,
+	}, data)
+
+	out, err := unmarshalPacket(data)
+	r.NoError(err)
+	r.Equal(p, out)
+}
+
+func TestUnmarshalPacketValidation(t *testing.T) {
+	valid := func() []byte {
+		return (&packet{
+			State:             StateUp,
+			DetectMult:        3,
+			MyDiscriminator:   1,
+			YourDiscriminator: 2,
+		}).marshal()
+	}
+
+	type testCase struct {
+		name     string
+		modify   func(data []byte) []byte
+		expError string
+	}
+
+	tcs := []testCase{
+		{
+			name:     "too short",
+			modify:   func(data []byte) []byte { return data[:20] },
+			expError: "packet is too short: 20 bytes",
+		},
+		{
+			name:     "unsupported version",
+			modify:   func(data []byte) []byte { data[0] = 0x40; return data },
+			expError: "unsupported version: 2",
+		},
+		{
+			name:     "length exceeds the payload",
+			modify:   func(data []byte) []byte { data[3] = 48; return data },
+			expError: "invalid length: 48",
+		},
+		{
+			name:     "authentication",
+			modify:   func(data []byte) []byte { data[1] |= flagAuthPresent; return data },
+			expError: "authentication is not supported",
+		},
+		{
+			name:     "zero detect multiplier",
+			modify:   func(data []byte) []byte { data[2] = 0; return data },
+			expError: "detect multiplier is zero",
+		},
+		{
+			name:     "zero my discriminator",
+			modify:   func(data []byte) []byte { data[7] = 0; return data },
+			expError: "my discriminator is zero",
+		},
+		{
+			name:     "zero your discriminator in up state",
+			modify:   func(data []byte) []byte { data[11] = 0; return data },
+			expError: "your discriminator is zero in Up state",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			_, err := unmarshalPacket(tc.modify(valid()))
+			r.Error(err)
+			r.Equal(tc.expError, err.Error())
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package bfd
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// DefaultPort is the UDP port single-hop BFD Control packets are sent
+	// to (RFC 5881 section 4).
+	DefaultPort = 3784
+
+	// ttl is the TTL set on the transmitted packets and expected on the
+	// received ones to ensure the peer is directly connected (RFC 5881
+	// section 5).
+	ttl = 255
+
+	sourcePortMin = 49152
+	sourcePortMax = 65535
+)
+
+// Server runs single-hop BFD sessions sourced from the local address.
+type Server struct {
+	localAddress net.IP
+	port         int
+
+	rx *net.UDPConn
+	tx *net.UDPConn
+
+	readTTL func(b []byte) (n, ttl int, src net.Addr, err error)
+
+	mutex    *sync.RWMutex
+	sessions map[uint32]*Session
+	peers    map[string]*Session
+}
+
+// NewServer creates the server listening for BFD Control packets on the
+// local address and port. The same port is used as the peers destination
+// port.
+func NewServer(localAddress string, port int) (*Server, error) {
+	ip := net.ParseIP(localAddress)
+	if ip == nil {
+		return nil, errors.Errorf("invalid local address `%s`", localAddress)
+	}
+
+	rx, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listening for BFD packets")
+	}
+
+	tx, err := listenSourcePort(ip)
+	if err != nil {
+		rx.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		localAddress: ip,
+		port:         port,
+		rx:           rx,
+		tx:           tx,
+		mutex:        &sync.RWMutex{},
+		sessions:     make(map[uint32]*Session),
+		peers:        make(map[string]*Session),
+	}
+
+	if err := s.setupTTL(); err != nil {
+		rx.Close()
+		tx.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// listenSourcePort binds the socket used to transmit packets to the random
+// port from the range required by RFC 5881 section 4.
+func listenSourcePort(ip net.IP) (*net.UDPConn, error) {
+	var lastErr error
+	for range 100 {
+		port := sourcePortMin + rand.IntN(sourcePortMax-sourcePortMin+1)
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, errors.Wrap(lastErr, "error binding BFD source port")
+}
+
+func (s *Server) setupTTL() error {
+	if s.localAddress.To4() != nil {
+		if err := ipv4.NewConn(s.tx).SetTTL(ttl); err != nil {
+			return errors.Wrap(err, "error setting TTL")
+		}
+
+		pc := ipv4.NewPacketConn(s.rx)
+		if err := pc.SetControlMessage(ipv4.FlagTTL, true); err != nil {
+			return errors.Wrap(err, "error enabling TTL control messages")
+		}
+
+		s.readTTL = func(b []byte) (int, int, net.Addr, error) {
+			n, cm, src, err := pc.ReadFrom(b)
+			if cm == nil {
+				return n, 0, src, err
+			}
+			return n, cm.TTL, src, err
+		}
+		return nil
+	}
+
+	if err := ipv6.NewConn(s.tx).SetHopLimit(ttl); err != nil {
+		return errors.Wrap(err, "error setting hop limit")
+	}
+
+	pc := ipv6.NewPacketConn(s.rx)
+	if err := pc.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+		return errors.Wrap(err, "error enabling hop limit control messages")
+	}
+
+	s.readTTL = func(b []byte) (int, int, net.Addr, error) {
+		n, cm, src, err := pc.ReadFrom(b)
+		if cm == nil {
+			return n, 0, src, err
+		}
+		return n, cm.HopLimit, src, err
+	}
+	return nil
+}
+
+// AddSession adds the session to the peer. Must be called before Run.
+func (s *Server) AddSession(cfg SessionConfig) (*Session, error) {
+	ip := net.ParseIP(cfg.PeerAddress)
+	if ip == nil {
+		return nil, errors.Errorf("invalid peer address `%s`", cfg.PeerAddress)
+	}
+
+	if (ip.To4() == nil) != (s.localAddress.To4() == nil) {
+		return nil, errors.Errorf("peer address `%s` and local address `%s` are of different address families", cfg.PeerAddress, s.localAddress)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.peers[ip.String()]; ok {
+		return nil, errors.Errorf("BFD session to `%s` already exists", cfg.PeerAddress)
+	}
+
+	var discriminator uint32
+	for discriminator == 0 || s.sessions[discriminator] != nil {
+		discriminator = rand.Uint32()
+	}
+
+	session := newSession(cfg, &net.UDPAddr{IP: ip, Port: s.port}, discriminator, s.send)
+	s.sessions[discriminator] = session
+	s.peers[ip.String()] = session
+
+	return session, nil
+}
+
+// Run runs the sessions until the context is cancelled. Peers are notified
+// the sessions are administratively down on exit.
+func (s *Server) Run(ctx context.Context) error {
+	wg := &sync.WaitGroup{}
+
+	s.mutex.RLock()
+	for _, session := range s.sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session.run(ctx)
+		}()
+	}
+	s.mutex.RUnlock()
+
+	go func() {
+		<-ctx.Done()
+		wg.Wait()
+
+		s.rx.Close()
+		s.tx.Close()
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		n, ttl, src, err := s.readTTL(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "error reading BFD packet")
+		}
+
+		s.handle(buf[:n], ttl, src)
+	}
+}
+
+func (s *Server) handle(data []byte, packetTTL int, src net.Addr) {
+	srcAddr, ok := src.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+
+	logger := log.WithFields(log.Fields{
+		"peer": srcAddr.IP.String(),
+	})
+
+	if packetTTL != ttl {
+		logger.Debugf("discarding BFD packet with TTL %d", packetTTL)
+		return
+	}
+
+	p, err := unmarshalPacket(data)
+	if err != nil {
+		logger.Debugf("discarding BFD packet: %s", err)
+		return
+	}
+
+	s.mutex.RLock()
+	var session *Session
+	if p.YourDiscriminator != 0 {
+		session = s.sessions[p.YourDiscriminator]
+	} else {
+		session = s.peers[srcAddr.IP.String()]
+	}
+	s.mutex.RUnlock()
+
+	if session == nil || !session.peer.IP.Equal(srcAddr.IP) {
+		logger.Debugf("discarding BFD packet: no session for discriminator %d", p.YourDiscriminator)
+		return
+	}
+
+	session.receive(p)
+}
+
+func (s *Server) send(peer *net.UDPAddr, data []byte) error {
+	_, err := s.tx.WriteToUDP(data, peer)
+	return err
+}
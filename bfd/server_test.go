@@ -0,0 +1,96 @@
+package bfd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServersOnLoopback(t *testing.T) {
+	r := require.New(t)
+
+	port := freePort(t)
+
+	srvA, err := NewServer("127.0.0.1", port)
+	r.NoError(err)
+
+	srvB, err := NewServer("127.0.0.2", port)
+	r.NoError(err)
+
+	mutex := &sync.Mutex{}
+	transitions := [][2]State{}
+
+	sessionA, err := srvA.AddSession(SessionConfig{
+		PeerAddress:           "127.0.0.2",
+		DesiredMinTxInterval:  50 * time.Millisecond,
+		RequiredMinRxInterval: 50 * time.Millisecond,
+		OnStateChange: func(from, to State) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			transitions = append(transitions, [2]State{from, to})
+		},
+	})
+	r.NoError(err)
+
+	_, err = srvA.AddSession(SessionConfig{PeerAddress: "127.0.0.2"})
+	r.Error(err)
+	r.Equal("BFD session to `127.0.0.2` already exists", err.Error())
+
+	sessionB, err := srvB.AddSession(SessionConfig{
+		PeerAddress:           "127.0.0.1",
+		DesiredMinTxInterval:  50 * time.Millisecond,
+		RequiredMinRxInterval: 50 * time.Millisecond,
+	})
+	r.NoError(err)
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+
+	errA := make(chan error, 1)
+	go func() { errA <- srvA.Run(ctxA) }()
+
+	errB := make(chan error, 1)
+	go func() { errB <- srvB.Run(ctxB) }()
+
+	r.Eventually(func() bool {
+		return sessionA.State() == StateUp && sessionB.State() == StateUp
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// sessions stay up on the fast transmit interval
+	time.Sleep(500 * time.Millisecond)
+	r.Equal(StateUp, sessionA.State())
+	r.Equal(StateUp, sessionB.State())
+
+	cancelB()
+	r.NoError(<-errB)
+
+	r.Eventually(func() bool {
+		return sessionA.State() == StateDown
+	}, time.Second, 10*time.Millisecond)
+
+	r.Equal(diagNeighborSignaledDown, sessionA.diag)
+
+	r.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(transitions) > 0 && transitions[len(transitions)-1] == [2]State{StateUp, StateDown}
+	}, time.Second, 10*time.Millisecond)
+
+	cancelA()
+	r.NoError(<-errA)
+}
+
+func freePort(t *testing.T) int {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
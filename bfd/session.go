@@ -0,0 +1,333 @@
+package bfd
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultDesiredMinTxInterval  = 300 * time.Millisecond
+	DefaultRequiredMinRxInterval = 300 * time.Millisecond
+	DefaultDetectMultiplier      = 3
+
+	// slowTxInterval is the minimal interval to transmit packets at while
+	// the session is not up (RFC 5880 section 6.8.3).
+	slowTxInterval = time.Second
+)
+
+// State is BFD session state.
+type State uint8
+
+const (
+	StateAdminDown State = 0
+	StateDown      State = 1
+	StateInit      State = 2
+	StateUp        State = 3
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAdminDown:
+		return "AdminDown"
+	case StateDown:
+		return "Down"
+	case StateInit:
+		return "Init"
+	case StateUp:
+		return "Up"
+	}
+	return "Unknown"
+}
+
+// SessionConfig defines single-hop BFD session to the peer. Zero intervals
+// and detect multiplier are set to the defaults.
+type SessionConfig struct {
+	PeerAddress           string
+	DesiredMinTxInterval  time.Duration
+	RequiredMinRxInterval time.Duration
+	DetectMultiplier      uint8
+
+	// OnStateChange is called on every session state transition. Calls are
+	// made sequentially in order the transitions happened.
+	OnStateChange func(from, to State)
+}
+
+// Session is asynchronous mode BFD session (RFC 5880).
+type Session struct {
+	peer   *net.UDPAddr
+	cfg    SessionConfig
+	sendFn func(*net.UDPAddr, []byte) error
+
+	mutex               *sync.Mutex
+	state               State
+	diag                uint8
+	localDiscriminator  uint32
+	remoteDiscriminator uint32
+	remoteMinRxInterval time.Duration
+	remoteMinTxInterval time.Duration
+	remoteDetectMult    uint8
+	poll                bool
+	detectTimer         *time.Timer
+	transitions         chan [2]State
+	reschedule          chan struct{}
+}
+
+func newSession(cfg SessionConfig, peer *net.UDPAddr, discriminator uint32, sendFn func(*net.UDPAddr, []byte) error) *Session {
+	if cfg.DesiredMinTxInterval == 0 {
+		cfg.DesiredMinTxInterval = DefaultDesiredMinTxInterval
+	}
+	if cfg.RequiredMinRxInterval == 0 {
+		cfg.RequiredMinRxInterval = DefaultRequiredMinRxInterval
+	}
+	if cfg.DetectMultiplier == 0 {
+		cfg.DetectMultiplier = DefaultDetectMultiplier
+	}
+
+	return &Session{
+		peer:   peer,
+		cfg:    cfg,
+		sendFn: sendFn,
+
+		mutex:               &sync.Mutex{},
+		state:               StateDown,
+		localDiscriminator:  discriminator,
+		remoteMinRxInterval: time.Microsecond,
+		transitions:         make(chan [2]State, 16),
+		reschedule:          make(chan struct{}, 1),
+	}
+}
+
+// State returns current session state.
+func (s *Session) State() State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state
+}
+
+func (s *Session) run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.notify(ctx)
+	}()
+
+	timer := time.NewTimer(s.txInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.shutdown()
+			wg.Wait()
+			return
+		case <-timer.C:
+			s.transmit(false)
+			timer.Reset(s.txInterval())
+		case <-s.reschedule:
+			timer.Reset(s.txInterval())
+		}
+	}
+}
+
+// notify calls OnStateChange for the queued transitions.
+func (s *Session) notify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-s.transitions:
+			if s.cfg.OnStateChange != nil {
+				s.cfg.OnStateChange(t[0], t[1])
+			}
+		}
+	}
+}
+
+// shutdown signals the peer the session is administratively down.
+func (s *Session) shutdown() {
+	s.mutex.Lock()
+	if s.detectTimer != nil {
+		s.detectTimer.Stop()
+	}
+	s.setState(StateAdminDown, diagAdminDown)
+	s.mutex.Unlock()
+
+	s.transmit(false)
+}
+
+// receive processes the received Control packet according to RFC 5880
+// section 6.8.6.
+func (s *Session) receive(p *packet) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state == StateAdminDown {
+		return
+	}
+
+	s.remoteDiscriminator = p.MyDiscriminator
+	s.remoteMinRxInterval = p.RequiredMinRxInterval
+	s.remoteMinTxInterval = p.DesiredMinTxInterval
+	s.remoteDetectMult = p.DetectMult
+
+	if p.Final {
+		s.poll = false
+	}
+
+	switch {
+	case p.State == StateAdminDown:
+		if s.state != StateDown {
+			s.setState(StateDown, diagNeighborSignaledDown)
+		}
+	case s.state == StateDown:
+		switch p.State {
+		case StateDown:
+			s.setState(StateInit, diagNone)
+		case StateInit:
+			s.setState(StateUp, diagNone)
+		}
+	case s.state == StateInit:
+		if p.State == StateInit || p.State == StateUp {
+			s.setState(StateUp, diagNone)
+		}
+	case s.state == StateUp:
+		if p.State == StateDown {
+			s.setState(StateDown, diagNeighborSignaledDown)
+		}
+	}
+
+	if s.state == StateInit || s.state == StateUp {
+		s.resetDetectTimer()
+	}
+
+	if p.Poll {
+		go s.transmit(true)
+	}
+}
+
+// expire is called when no packets are received within the detection time.
+func (s *Session) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state != StateInit && s.state != StateUp {
+		return
+	}
+
+	s.setState(StateDown, diagControlDetectExpired)
+	s.remoteDiscriminator = 0
+}
+
+// setState must be called with the mutex held.
+func (s *Session) setState(state State, diag uint8) {
+	if s.state == state {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"peer": s.peer.IP.String(),
+		"from": s.state.String(),
+		"to":   state.String(),
+		"diag": diag,
+	}).Debug("BFD session state changed")
+
+	wasUp := s.state == StateUp
+	from := s.state
+	s.state = state
+	s.diag = diag
+
+	// Advertised transmit interval depends on whether the session is up so
+	// Poll Sequence is initiated to let the peer know about the change.
+	// Packets are sent at the slow rate until the session is up so the
+	// pending transmission is rescheduled not to let the peer detection
+	// time expire.
+	if wasUp != (state == StateUp) {
+		s.poll = true
+
+		select {
+		case s.reschedule <- struct{}{}:
+		default:
+		}
+	}
+
+	select {
+	case s.transitions <- [2]State{from, state}:
+	default:
+		log.WithFields(log.Fields{
+			"peer": s.peer.IP.String(),
+		}).Warn("BFD state change notifications queue is full, dropping")
+	}
+}
+
+// resetDetectTimer must be called with the mutex held.
+func (s *Session) resetDetectTimer() {
+	d := time.Duration(s.remoteDetectMult) * max(s.cfg.RequiredMinRxInterval, s.remoteMinTxInterval)
+	if s.detectTimer == nil {
+		s.detectTimer = time.AfterFunc(d, s.expire)
+		return
+	}
+	s.detectTimer.Reset(d)
+}
+
+// desiredMinTxInterval must be called with the mutex held.
+func (s *Session) desiredMinTxInterval() time.Duration {
+	if s.state == StateUp {
+		return s.cfg.DesiredMinTxInterval
+	}
+	return max(s.cfg.DesiredMinTxInterval, slowTxInterval)
+}
+
+// txInterval returns jittered interval until the next periodic packet
+// (RFC 5880 section 6.8.7).
+func (s *Session) txInterval() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	interval := max(s.desiredMinTxInterval(), s.remoteMinRxInterval)
+	if s.remoteMinRxInterval == 0 {
+		// peer doesn't want to receive packets, just check again later
+		interval = slowTxInterval
+	}
+
+	// interval is reduced by 0-25% or by 10-25% with detect multiplier of 1
+	jitter := 0.25 * rand.Float64()
+	if s.cfg.DetectMultiplier == 1 {
+		jitter = 0.1 + 0.15*rand.Float64()
+	}
+
+	return time.Duration(float64(interval) * (1 - jitter))
+}
+
+func (s *Session) transmit(final bool) {
+	s.mutex.Lock()
+	if s.remoteMinRxInterval == 0 && !final {
+		s.mutex.Unlock()
+		return
+	}
+
+	p := &packet{
+		Diag:                  s.diag,
+		State:                 s.state,
+		Poll:                  s.poll && !final,
+		Final:                 final,
+		DetectMult:            s.cfg.DetectMultiplier,
+		MyDiscriminator:       s.localDiscriminator,
+		YourDiscriminator:     s.remoteDiscriminator,
+		DesiredMinTxInterval:  s.desiredMinTxInterval(),
+		RequiredMinRxInterval: s.cfg.RequiredMinRxInterval,
+	}
+	s.mutex.Unlock()
+
+	if err := s.sendFn(s.peer, p.marshal()); err != nil {
+		log.WithFields(log.Fields{
+			"peer": s.peer.IP.String(),
+		}).Warnf("error sending BFD packet: %s", err)
+	}
+}
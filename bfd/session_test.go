@@ -0,0 +1,163 @@
+package bfd
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSession(t *testing.T) (*Session, func() []*packet) {
+	mutex := &sync.Mutex{}
+	sent := []*packet{}
+
+	s := newSession(SessionConfig{
+		PeerAddress:           "127.0.0.2",
+		DesiredMinTxInterval:  10 * time.Millisecond,
+		RequiredMinRxInterval: 10 * time.Millisecond,
+	}, &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: DefaultPort}, 1, func(_ *net.UDPAddr, data []byte) error {
+		p, err := unmarshalPacket(data)
+		require.NoError(t, err)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		sent = append(sent, p)
+		return nil
+	})
+
+	return s, func() []*packet {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]*packet{}, sent...)
+	}
+}
+
+func TestSessionStateMachine(t *testing.T) {
+	r := require.New(t)
+
+	s, _ := newTestSession(t)
+	r.Equal(StateDown, s.State())
+
+	remote := &packet{
+		State:                 StateDown,
+		DetectMult:            3,
+		MyDiscriminator:       2,
+		DesiredMinTxInterval:  time.Second,
+		RequiredMinRxInterval: time.Second,
+	}
+
+	s.receive(remote)
+	r.Equal(StateInit, s.State())
+
+	remote.State = StateUp
+	remote.YourDiscriminator = 1
+	remote.DesiredMinTxInterval = 10 * time.Millisecond
+	s.receive(remote)
+	r.Equal(StateUp, s.State())
+
+	remote.State = StateDown
+	s.receive(remote)
+	r.Equal(StateDown, s.State())
+	r.Equal(diagNeighborSignaledDown, s.diag)
+
+	// Up state can't be reached directly from Down one
+	remote.State = StateUp
+	s.receive(remote)
+	r.Equal(StateDown, s.State())
+
+	remote.State = StateInit
+	s.receive(remote)
+	r.Equal(StateUp, s.State())
+
+	remote.State = StateAdminDown
+	s.receive(remote)
+	r.Equal(StateDown, s.State())
+
+	r.Equal([][2]State{
+		{StateDown, StateInit},
+		{StateInit, StateUp},
+		{StateUp, StateDown},
+		{StateDown, StateUp},
+		{StateUp, StateDown},
+	}, drainTransitions(s))
+}
+
+func TestSessionDetectionTimeExpired(t *testing.T) {
+	r := require.New(t)
+
+	s, _ := newTestSession(t)
+
+	s.receive(&packet{
+		State:                StateInit,
+		DetectMult:           3,
+		MyDiscriminator:      2,
+		YourDiscriminator:    1,
+		DesiredMinTxInterval: 10 * time.Millisecond,
+	})
+	r.Equal(StateUp, s.State())
+
+	r.Eventually(func() bool {
+		return s.State() == StateDown
+	}, time.Second, 5*time.Millisecond)
+
+	r.Equal(diagControlDetectExpired, s.diag)
+	r.Equal(uint32(0), s.remoteDiscriminator)
+}
+
+func TestSessionPollSequence(t *testing.T) {
+	r := require.New(t)
+
+	s, sent := newTestSession(t)
+
+	s.receive(&packet{
+		State:                 StateInit,
+		Poll:                  true,
+		DetectMult:            3,
+		MyDiscriminator:       2,
+		YourDiscriminator:     1,
+		DesiredMinTxInterval:  time.Second,
+		RequiredMinRxInterval: 10 * time.Millisecond,
+	})
+	r.Equal(StateUp, s.State())
+
+	// poll is answered with final immediately
+	r.Eventually(func() bool {
+		return len(sent()) == 1
+	}, time.Second, 5*time.Millisecond)
+	r.True(sent()[0].Final)
+	r.False(sent()[0].Poll)
+
+	// the session became up so poll sequence is initiated to advertise
+	// the fast transmit interval
+	s.transmit(false)
+	p := sent()[1]
+	r.True(p.Poll)
+	r.Equal(10*time.Millisecond, p.DesiredMinTxInterval)
+
+	s.receive(&packet{
+		State:                 StateUp,
+		Final:                 true,
+		DetectMult:            3,
+		MyDiscriminator:       2,
+		YourDiscriminator:     1,
+		DesiredMinTxInterval:  time.Second,
+		RequiredMinRxInterval: 10 * time.Millisecond,
+	})
+
+	s.transmit(false)
+	r.False(sent()[2].Poll)
+}
+
+func drainTransitions(s *Session) [][2]State {
+	out := [][2]State{}
+	for {
+		select {
+		case t := <-s.transitions:
+			out = append(out, t)
+		default:
+			return out
+		}
+	}
+}
@@ -16,6 +16,7 @@ var _ checkers.Checker = (*assigned_address)(nil)
 type assigned_address struct {
 	iface *string
 	ipv4  string
+	ipv6  string
 
 	interfaceCollector func() (map[string]string, error)
 }
@@ -31,9 +32,16 @@ func New(s spec) (checkers.Checker, error) {
 		return nil, err
 	}
 
+	ipv6 := ""
+	if s.IPv6 != "" {
+		// addresses are gathered in canonical form
+		ipv6 = net.ParseIP(s.IPv6).String()
+	}
+
 	return &assigned_address{
 		iface: s.Interface,
 		ipv4:  s.IPv4,
+		ipv6:  ipv6,
 
 		interfaceCollector: gatherInterfaces,
 	}, nil
@@ -63,13 +71,18 @@ func (d *assigned_address) Check(ctx context.Context) error {
 		"interfaces": ifaces,
 	}).Tracef("discovered interfaces")
 
-	v, ok := ifaces[d.ipv4]
+	address, family := d.ipv4, "IPv4"
+	if d.ipv6 != "" {
+		address, family = d.ipv6, "IPv6"
+	}
+
+	v, ok := ifaces[address]
 	if !ok {
-		return errors.New("no IPv4 address found on the system")
+		return errors.Errorf("no %s address found on the system", family)
 	}
 
 	if d.iface != nil && *d.iface != v {
-		return errors.New("Interface name is not matched for described IPv4 address")
+		return errors.Errorf("Interface name is not matched for described %s address", family)
 	}
 
 	return nil
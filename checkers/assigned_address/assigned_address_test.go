@@ -104,3 +104,42 @@ func TestCheckNotFoundIPv4Address(t *testing.T) {
 	r.Error(err)
 	r.Equal("no IPv4 address found on the system", err.Error())
 }
+
+func TestCheckIPv6(t *testing.T) {
+	r := require.New(t)
+
+	c, err := New(spec{
+		IPv6:      "2001:DB8:0::232",
+		Interface: ptr.String("test0"),
+	})
+	r.NoError(err)
+
+	c.(*assigned_address).interfaceCollector = func() (map[string]string, error) {
+		return map[string]string{
+			"127.0.0.232":   "test0",
+			"2001:db8::232": "test0",
+		}, nil
+	}
+
+	err = c.Check(context.Background())
+	r.NoError(err)
+}
+
+func TestCheckNotFoundIPv6Address(t *testing.T) {
+	r := require.New(t)
+
+	c, err := New(spec{
+		IPv6: "2001:db8::233",
+	})
+	r.NoError(err)
+
+	c.(*assigned_address).interfaceCollector = func() (map[string]string, error) {
+		return map[string]string{
+			"2001:db8::232": "test0",
+		}, nil
+	}
+
+	err = c.Check(context.Background())
+	r.Error(err)
+	r.Equal("no IPv6 address found on the system", err.Error())
+}
@@ -8,10 +8,16 @@ import (
 type spec struct {
 	Interface *string `json:"interface"`
 	IPv4      string  `json:"ipv4"`
+	IPv6      string  `json:"ipv6"`
 }
 
 func (s spec) Validate() error {
 	return validation.ValidateStruct(&s,
-		validation.Field(&s.IPv4, validation.Required, is.IPv4),
+		validation.Field(&s.IPv4, validation.When(s.IPv6 == "", validation.Required), is.IPv4),
+		validation.Field(&s.IPv6,
+			validation.When(s.IPv4 == "", validation.Required),
+			validation.When(s.IPv4 != "", validation.Empty.Error("must be blank when ipv4 is set")),
+			is.IPv6,
+		),
 	)
 }
@@ -43,10 +43,31 @@ func TestSpecValidation(t *testing.T) {
 			},
 			expError: errors.New("ipv4: must be a valid IPv4 address."),
 		},
+		{
+			name: "valid ipv6 spec",
+			in: spec{
+				IPv6: "2001:db8::33",
+			},
+		},
+		{
+			name: "invalid ipv6 address format",
+			in: spec{
+				IPv6: "127.0.0.33",
+			},
+			expError: errors.New("ipv6: must be a valid IPv6 address."),
+		},
+		{
+			name: "both ipv4 and ipv6 addresses",
+			in: spec{
+				IPv4: "127.0.0.33",
+				IPv6: "2001:db8::33",
+			},
+			expError: errors.New("ipv6: must be blank when ipv4 is set."),
+		},
 		{
 			name:     "empty spec",
 			in:       spec{},
-			expError: errors.New("ipv4: cannot be blank."),
+			expError: errors.New("ipv4: cannot be blank; ipv6: cannot be blank."),
 		},
 	}
 
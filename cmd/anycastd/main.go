@@ -2,17 +2,29 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	apipb "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/config/oc"
 	"github.com/osrg/gobgp/v3/pkg/server"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	th "github.com/teran/go-time"
+	"github.com/vishvananda/netlink"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/runityru/anycastd/announcer"
+	"github.com/runityru/anycastd/bfd"
 	"github.com/runityru/anycastd/checkers"
 	"github.com/runityru/anycastd/config"
 	"github.com/runityru/anycastd/service"
@@ -32,32 +44,671 @@ var (
 	buildTimestamp = "undefined"
 )
 
-// newPeer builds a gobgp peer definition. localAddress is set as the
-// transport local address so the BGP session is sourced from the configured
-// address instead of whatever the kernel picks by route lookup.
-func newPeer(peer config.Peer, localAddress string) *apipb.Peer {
+// families maps address family names used in configuration to the gobgp ones.
+var families = map[string]*apipb.Family{
+	"ipv4-unicast": {Afi: apipb.Family_AFI_IP, Safi: apipb.Family_SAFI_UNICAST},
+	"ipv6-unicast": {Afi: apipb.Family_AFI_IP6, Safi: apipb.Family_SAFI_UNICAST},
+	"ipv4-vpn":     {Afi: apipb.Family_AFI_IP, Safi: apipb.Family_SAFI_MPLS_VPN},
+	"ipv6-vpn":     {Afi: apipb.Family_AFI_IP6, Safi: apipb.Family_SAFI_MPLS_VPN},
+	"l2vpn-evpn":   {Afi: apipb.Family_AFI_L2VPN, Safi: apipb.Family_SAFI_EVPN},
+}
+
+// bmpPolicies maps BMP route monitoring policy names used in configuration to
+// the gobgp ones.
+var bmpPolicies = map[string]apipb.AddBmpRequest_MonitoringPolicy{
+	"":      apipb.AddBmpRequest_PRE,
+	"pre":   apipb.AddBmpRequest_PRE,
+	"post":  apipb.AddBmpRequest_POST,
+	"both":  apipb.AddBmpRequest_BOTH,
+	"local": apipb.AddBmpRequest_LOCAL,
+	"all":   apipb.AddBmpRequest_ALL,
+}
+
+// linkLocalNeighbor returns IPv6 link-local address of the only neighbor on
+// the interface with the zone set.
+var linkLocalNeighbor = oc.GetIPv6LinkLocalNeighborAddress
+
+// newPeer builds a gobgp peer definition. Local address of the same address
+// family as the peer is set as the transport local address so the BGP session
+// is sourced from the configured address instead of whatever the kernel picks
+// by route lookup. Zero timers are left for GoBGP to set its defaults, zero
+// local AS makes GoBGP use the global one.
+//
+// Interface peers are connected over IPv6 link-local addresses: the neighbor
+// address is looked up in the interface neighbor table since gobgp requires
+// it to add the peer, the local one is picked by gobgp. GoBGP advertises the
+// extended next hop capability (RFC 5549) for IPv4 families by itself.
+//
+// The peer is expected to be resolved against its peer group already. It's
+// not added to the gobgp peer group since gobgp overwrites the peer settings
+// with the group ones making per-peer overrides impossible.
+func newPeer(peer config.Peer, a config.Announcer) (*apipb.Peer, error) {
+	password, err := peer.AuthPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	neighborAddress := peer.RemoteAddress
+	localAddress := a.LocalAddressFor(peer.RemoteAddress)
+	if peer.Interface != "" {
+		neighborAddress, err = linkLocalNeighbor(peer.Interface)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error looking up neighbor of peer `%s` on `%s`", peer.Name, peer.Interface)
+		}
+		localAddress = ""
+	}
+
 	return &apipb.Peer{
 		Conf: &apipb.PeerConf{
-			NeighborAddress: peer.RemoteAddress,
-			PeerAsn:         peer.RemoteASN,
+			NeighborAddress:   neighborAddress,
+			NeighborInterface: peer.Interface,
+			PeerAsn:           peer.RemoteASN,
+			LocalAsn:          peer.LocalAS,
+			AuthPassword:      password,
 		},
 		EbgpMultihop: &apipb.EbgpMultihop{
-			Enabled:     peer.EnableMultihop,
+			Enabled:     peer.MultihopEnabled(),
 			MultihopTtl: peer.MultihopTTL,
 		},
+		Timers: newTimers(peer.HoldTime, peer.KeepaliveInterval, peer.ConnectRetry, peer.IdleHoldTimeAfterReset),
 		Transport: &apipb.Transport{
 			LocalAddress: localAddress,
+			PassiveMode:  peer.PassiveModeEnabled(),
+			RemotePort:   peer.RemotePort,
+		},
+		GracefulRestart: newGracefulRestart(a.GracefulRestart),
+		AfiSafis:        newAfiSafis(peer.EnabledFamilies(), a.GracefulRestart),
+	}, nil
+}
+
+// interfacePeerRetryInterval is the delay before the first retry to add the
+// interface peer, the delay is doubled after every failed attempt up to
+// interfacePeerMaxRetryInterval.
+var (
+	interfacePeerRetryInterval    = time.Second
+	interfacePeerMaxRetryInterval = time.Minute
+)
+
+// peerAdder is the part of gobgp server used to add the peers.
+type peerAdder interface {
+	AddPeer(ctx context.Context, r *apipb.AddPeerRequest) error
+}
+
+// addInterfacePeer adds the interface peer once its neighbor shows up in the
+// interface neighbor table, e.g. the link comes up after anycastd is started.
+// The failed attempts are logged and retried with backoff until the context is
+// done.
+func addInterfacePeer(ctx context.Context, pa peerAdder, peer config.Peer, a config.Announcer) {
+	delay := interfacePeerRetryInterval
+	for {
+		p, err := newPeer(peer, a)
+		if err == nil {
+			err = pa.AddPeer(ctx, &apipb.AddPeerRequest{
+				Peer: p,
+			})
+		}
+		if err == nil {
+			log.WithFields(log.Fields{
+				"peer":      peer.Name,
+				"interface": peer.Interface,
+			}).Infof("peer added with neighbor %s", p.Conf.NeighborAddress)
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"peer":      peer.Name,
+			"interface": peer.Interface,
+		}).Warnf("error adding peer, retrying in %s: %s", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, interfacePeerMaxRetryInterval)
+	}
+}
+
+// newPeerGroup builds a gobgp peer group definition.
+func newPeerGroup(group config.PeerGroup, a config.Announcer) (*apipb.PeerGroup, error) {
+	password, err := group.AuthPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	return &apipb.PeerGroup{
+		Conf: &apipb.PeerGroupConf{
+			PeerGroupName: group.Name,
+			PeerAsn:       group.RemoteASN,
+			AuthPassword:  password,
+		},
+		EbgpMultihop: &apipb.EbgpMultihop{
+			Enabled:     group.EnableMultihop,
+			MultihopTtl: group.MultihopTTL,
+		},
+		Timers: newTimers(group.HoldTime, group.KeepaliveInterval, group.ConnectRetry, group.IdleHoldTimeAfterReset),
+		Transport: &apipb.Transport{
+			PassiveMode: group.PassiveMode,
+			RemotePort:  group.RemotePort,
+		},
+		GracefulRestart: newGracefulRestart(a.GracefulRestart),
+		AfiSafis:        newAfiSafis(group.EnabledFamilies(), a.GracefulRestart),
+	}, nil
+}
+
+func newTimers(holdTime, keepaliveInterval, connectRetry, idleHoldTimeAfterReset th.Duration) *apipb.Timers {
+	return &apipb.Timers{
+		Config: &apipb.TimersConfig{
+			HoldTime:               uint64(holdTime.TimeDuration().Seconds()),
+			KeepaliveInterval:      uint64(keepaliveInterval.TimeDuration().Seconds()),
+			ConnectRetry:           uint64(connectRetry.TimeDuration().Seconds()),
+			IdleHoldTimeAfterReset: uint64(idleHoldTimeAfterReset.TimeDuration().Seconds()),
+		},
+	}
+}
+
+func newAfiSafis(names []string, gr config.GracefulRestart) []*apipb.AfiSafi {
+	afiSafis := []*apipb.AfiSafi{}
+	for _, family := range names {
+		afiSafi := &apipb.AfiSafi{
+			Config: &apipb.AfiSafiConfig{
+				Family:  families[family],
+				Enabled: true,
+			},
+		}
+
+		if gr.Enabled {
+			afiSafi.MpGracefulRestart = &apipb.MpGracefulRestart{
+				Config: &apipb.MpGracefulRestartConfig{Enabled: true},
+			}
+		}
+
+		if gr.LongLived.Enabled {
+			afiSafi.LongLivedGracefulRestart = &apipb.LongLivedGracefulRestart{
+				Config: &apipb.LongLivedGracefulRestartConfig{
+					Enabled:     true,
+					RestartTime: uint32(gr.LongLived.RestartTime.TimeDuration().Seconds()),
+				},
+			}
+		}
+
+		afiSafis = append(afiSafis, afiSafi)
+	}
+	return afiSafis
+}
+
+// newGracefulRestart builds gobgp graceful restart configuration shared by
+// the global and peer definitions.
+func newGracefulRestart(gr config.GracefulRestart) *apipb.GracefulRestart {
+	return &apipb.GracefulRestart{
+		Enabled:          gr.Enabled,
+		RestartTime:      uint32(gr.RestartTime.TimeDuration().Seconds()),
+		LonglivedEnabled: gr.LongLived.Enabled,
+	}
+}
+
+// newGlobal builds gobgp global configuration. BGP port is not listened
+// unless the listener is enabled or there are passive peers waiting for the
+// remote side to connect.
+func newGlobal(a config.Announcer) *apipb.Global {
+	global := &apipb.Global{
+		RouterId:   a.RouterID,
+		Asn:        a.LocalASN,
+		ListenPort: -1,
+
+		GracefulRestart: newGracefulRestart(a.GracefulRestart),
+	}
+
+	if a.Listener.Enabled {
+		global.ListenPort = 179
+		if a.Listener.Port != 0 {
+			global.ListenPort = int32(a.Listener.Port)
+		}
+		global.ListenAddresses = a.ListenAddresses()
+		return global
+	}
+
+	for _, peer := range a.ResolvedPeers() {
+		if peer.PassiveModeEnabled() {
+			global.ListenPort = 179
+			global.ListenAddresses = a.ListenAddresses()
+			break
+		}
+	}
+
+	return global
+}
+
+// newVRF builds a gobgp VRF definition. Service routes are announced into
+// the VRF by anycastd itself, gobgp VRF makes the routes with the import
+// route targets received from the peers imported into the VRF table.
+func newVRF(v config.VRF, id uint32) (*apipb.Vrf, error) {
+	rd, err := announcer.ParseRouteDistinguisher(v.RD)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &apipb.Vrf{
+		Name: v.Name,
+		Rd:   rd,
+		Id:   id,
+	}
+
+	for _, rt := range v.ImportRTs {
+		a, err := announcer.ParseExtendedCommunity("rt:" + rt)
+		if err != nil {
+			return nil, err
+		}
+		out.ImportRt = append(out.ImportRt, a)
+	}
+
+	for _, rt := range v.ExportRTs {
+		a, err := announcer.ParseExtendedCommunity("rt:" + rt)
+		if err != nil {
+			return nil, err
+		}
+		out.ExportRt = append(out.ExportRt, a)
+	}
+
+	return out, nil
+}
+
+// newBMPStation builds a gobgp BMP station registration request. Router ID
+// is reported as the system name unless it's set explicitly.
+func newBMPStation(st config.BMPStation, a config.Announcer) *apipb.AddBmpRequest {
+	sysName := st.SysName
+	if sysName == "" {
+		sysName = a.RouterID
+	}
+
+	return &apipb.AddBmpRequest{
+		Address:           st.Address,
+		Port:              st.Port,
+		Policy:            bmpPolicies[st.Policy],
+		StatisticsTimeout: int32(st.StatisticsInterval.TimeDuration().Seconds()),
+		SysName:           sysName,
+		SysDescr:          "anycastd " + appVersion,
+	}
+}
+
+// newMRTDump converts the MRT dump configuration.
+func newMRTDump(d config.MRTDump) announcer.MRTDump {
+	return announcer.MRTDump{
+		Updates:          d.Type == "updates",
+		FileName:         d.FileName,
+		DumpInterval:     d.DumpInterval.TimeDuration(),
+		RotationInterval: d.RotationInterval.TimeDuration(),
+		MaxSize:          int64(d.MaxSizeMB) << 20,
+	}
+}
+
+// newKernelConfig builds configuration of the announcer installing the
+// service routes into the kernel routing table.
+func newKernelConfig(svc config.Service, routes []config.Route, h announcer.KernelRouteHandler) announcer.KernelConfig {
+	return announcer.KernelConfig{
+		Name:           svc.Name,
+		Handler:        h,
+		Routes:         newRoutes(routes),
+		Type:           svc.Kernel.Type,
+		Interface:      svc.Kernel.Interface,
+		Table:          int(svc.Kernel.Table),
+		Protocol:       int(svc.Kernel.Protocol),
+		Metric:         int(svc.Kernel.Metric),
+		DegradedMetric: int(svc.Kernel.DegradedMetric),
+	}
+}
+
+// newBIRDConfig builds configuration of the announcer controlling the
+// protocols of BIRD instance.
+func newBIRDConfig(svc config.Service) announcer.BIRDConfig {
+	return announcer.BIRDConfig{
+		Name:             svc.Name,
+		Socket:           svc.BIRD.Socket,
+		Protocol:         svc.BIRD.Protocol,
+		DegradedProtocol: svc.BIRD.DegradedProtocol,
+		Timeout:          svc.BIRD.Timeout.TimeDuration(),
+	}
+}
+
+// newExaBGPConfig builds configuration of the announcer sending the routes of
+// the service to ExaBGP.
+func newExaBGPConfig(svc config.Service, routes []config.Route, e config.ExaBGP, api *announcer.ExaBGPAPI) announcer.ExaBGPConfig {
+	return announcer.ExaBGPConfig{
+		Name:     svc.Name,
+		API:      api,
+		Routes:   newRoutes(routes),
+		NextHop:  e.NextHop,
+		LocalASN: e.LocalASN,
+		Degraded: announcer.Degraded{
+			ASPathPrepend:    svc.Degraded.ASPathPrepend,
+			MED:              svc.Degraded.MED,
+			Communities:      svc.Degraded.Communities,
+			LargeCommunities: svc.Degraded.LargeCommunities,
 		},
 	}
 }
 
+// openExaBGPOutput opens ExaBGP named pipe the API commands are written to or
+// returns stdout if no pipe is set, i.e. anycastd is run as ExaBGP process.
+// The pipe is opened for reading as well so it doesn't block until ExaBGP
+// opens it and survives ExaBGP restarts.
+func openExaBGPOutput(pipe string) (io.Writer, error) {
+	if pipe == "" {
+		// ExaBGP acknowledges the commands via stdin of the process, the
+		// acknowledgements are dropped so they don't fill up the pipe
+		go func() {
+			_, _ = io.Copy(io.Discard, os.Stdin)
+		}()
+		return os.Stdout, nil
+	}
+
+	info, err := os.Stat(pipe)
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking up ExaBGP pipe")
+	}
+
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return nil, errors.Errorf("`%s` is not a named pipe", pipe)
+	}
+
+	f, err := os.OpenFile(pipe, os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening ExaBGP pipe")
+	}
+	return f, nil
+}
+
+// newDefinedSets builds gobgp defined sets referenced by the policies.
+func newDefinedSets(d config.DefinedSets) ([]*apipb.DefinedSet, error) {
+	sets := []*apipb.DefinedSet{}
+	for _, ps := range d.PrefixSets {
+		set := &apipb.DefinedSet{
+			DefinedType: apipb.DefinedType_PREFIX,
+			Name:        ps.Name,
+		}
+		for _, p := range ps.Prefixes {
+			_, ipNet, err := net.ParseCIDR(p.Prefix)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error parsing prefix of `%s` prefix set", ps.Name)
+			}
+
+			length, bits := ipNet.Mask.Size()
+			prefix := &apipb.Prefix{
+				IpPrefix:      ipNet.String(),
+				MaskLengthMin: uint32(length),
+				MaskLengthMax: uint32(length),
+			}
+			if p.MaskLengthMin != 0 || p.MaskLengthMax != 0 {
+				prefix.MaskLengthMin = max(p.MaskLengthMin, uint32(length))
+				prefix.MaskLengthMax = uint32(bits)
+				if p.MaskLengthMax != 0 {
+					prefix.MaskLengthMax = p.MaskLengthMax
+				}
+			}
+
+			set.Prefixes = append(set.Prefixes, prefix)
+		}
+		sets = append(sets, set)
+	}
+
+	for _, ns := range d.NeighborSets {
+		set := &apipb.DefinedSet{
+			DefinedType: apipb.DefinedType_NEIGHBOR,
+			Name:        ns.Name,
+		}
+		for _, n := range ns.Neighbors {
+			cidr, err := announcer.NeighborCIDR(n)
+			if err != nil {
+				return nil, err
+			}
+			set.List = append(set.List, cidr)
+		}
+		sets = append(sets, set)
+	}
+
+	for _, cs := range d.CommunitySets {
+		set := &apipb.DefinedSet{
+			DefinedType: apipb.DefinedType_COMMUNITY,
+			Name:        cs.Name,
+		}
+		for _, c := range cs.Communities {
+			community, err := formatCommunity(c)
+			if err != nil {
+				return nil, err
+			}
+			set.List = append(set.List, community)
+		}
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// matchTypes maps match types used in configuration to the gobgp ones.
+var matchTypes = map[string]apipb.MatchSet_Type{
+	"":       apipb.MatchSet_ANY,
+	"any":    apipb.MatchSet_ANY,
+	"all":    apipb.MatchSet_ALL,
+	"invert": apipb.MatchSet_INVERT,
+}
+
+// newPolicies builds gobgp policies. Statements are named after the policy
+// and their position in it. Matching routes are rejected or modified and
+// passed to the next statement. AS path is prepended with the local AS of
+// the session so it's not changed on iBGP sessions.
+func newPolicies(policies []config.Policy) ([]*apipb.Policy, error) {
+	out := []*apipb.Policy{}
+	for _, policy := range policies {
+		p := &apipb.Policy{Name: policy.Name}
+		for i, st := range policy.Statements {
+			conditions := &apipb.Conditions{}
+			if m := st.Conditions.PrefixSet; m != nil {
+				conditions.PrefixSet = &apipb.MatchSet{Name: m.Name, Type: matchTypes[m.Match]}
+			}
+			if m := st.Conditions.NeighborSet; m != nil {
+				conditions.NeighborSet = &apipb.MatchSet{Name: m.Name, Type: matchTypes[m.Match]}
+			}
+			if m := st.Conditions.CommunitySet; m != nil {
+				conditions.CommunitySet = &apipb.MatchSet{Name: m.Name, Type: matchTypes[m.Match]}
+			}
+
+			actions := &apipb.Actions{RouteAction: apipb.RouteAction_NONE}
+			if st.Actions.Reject {
+				actions.RouteAction = apipb.RouteAction_REJECT
+			}
+			if st.Actions.MED != nil {
+				actions.Med = &apipb.MedAction{
+					Type:  apipb.MedAction_REPLACE,
+					Value: int64(*st.Actions.MED),
+				}
+			}
+			if st.Actions.ASPathPrepend > 0 {
+				actions.AsPrepend = &apipb.AsPrependAction{
+					Repeat:      st.Actions.ASPathPrepend,
+					UseLeftMost: true,
+				}
+			}
+			if len(st.Actions.Communities) > 0 {
+				communities := []string{}
+				for _, c := range st.Actions.Communities {
+					community, err := formatCommunity(c)
+					if err != nil {
+						return nil, err
+					}
+					communities = append(communities, community)
+				}
+				actions.Community = &apipb.CommunityAction{
+					Type:        apipb.CommunityAction_ADD,
+					Communities: communities,
+				}
+			}
+			if len(st.Actions.LargeCommunities) > 0 {
+				actions.LargeCommunity = &apipb.CommunityAction{
+					Type:        apipb.CommunityAction_ADD,
+					Communities: st.Actions.LargeCommunities,
+				}
+			}
+
+			p.Statements = append(p.Statements, &apipb.Statement{
+				Name:       fmt.Sprintf("%s-%d", policy.Name, i),
+				Conditions: conditions,
+				Actions:    actions,
+			})
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// newPeerGroupPolicies limits the policies referenced by the peer groups to
+// the members of the groups: each of them is replaced by a copy per group
+// with the neighbor set of the group added to the statement conditions.
+// Policies of the groups without members are dropped.
+func newPeerGroupPolicies(a config.Announcer, policies []*apipb.Policy) ([]*apipb.DefinedSet, []*apipb.Policy, error) {
+	sets := []*apipb.DefinedSet{}
+	referenced := map[string]bool{}
+	groups := map[string][]string{}
+	for _, group := range a.PeerGroups {
+		if len(group.Policies) == 0 {
+			continue
+		}
+
+		set := &apipb.DefinedSet{
+			DefinedType: apipb.DefinedType_NEIGHBOR,
+			Name:        "anycastd-group-" + group.Name,
+		}
+		for _, n := range a.PeerGroupNeighbors(group.Name) {
+			cidr, err := announcer.NeighborCIDR(n)
+			if err != nil {
+				return nil, nil, err
+			}
+			set.List = append(set.List, cidr)
+		}
+
+		for _, name := range group.Policies {
+			referenced[name] = true
+		}
+
+		if len(set.List) == 0 {
+			continue
+		}
+
+		sets = append(sets, set)
+		for _, name := range group.Policies {
+			groups[name] = append(groups[name], group.Name)
+		}
+	}
+
+	out := []*apipb.Policy{}
+	for _, policy := range policies {
+		if !referenced[policy.Name] {
+			out = append(out, policy)
+			continue
+		}
+
+		for _, group := range groups[policy.Name] {
+			prefix := "anycastd-group-" + group + "-"
+			p := proto.Clone(policy).(*apipb.Policy)
+			p.Name = prefix + p.Name
+			for _, st := range p.Statements {
+				st.Name = prefix + st.Name
+				st.Conditions.NeighborSet = &apipb.MatchSet{
+					Type: apipb.MatchSet_ANY,
+					Name: "anycastd-group-" + group,
+				}
+			}
+			out = append(out, p)
+		}
+	}
+	return sets, out, nil
+}
+
+// formatCommunity returns the community in `ASN:value` form gobgp expects
+// with the well-known names resolved.
+func formatCommunity(in string) (string, error) {
+	v, err := announcer.ParseCommunity(in)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", v>>16, v&0xffff), nil
+}
+
+// peerSwitch is the part of gobgp server used to tear down BGP sessions
+// while BFD session is down.
+type peerSwitch interface {
+	EnablePeer(ctx context.Context, r *apipb.EnablePeerRequest) error
+	DisablePeer(ctx context.Context, r *apipb.DisablePeerRequest) error
+}
+
+// newBFDStateHandler reports BFD session state of the peer to metrics and
+// disables the BGP peer when BFD session goes down from up state if
+// teardown is enabled. The peer is enabled back once BFD session is up.
+func newBFDStateHandler(ctx context.Context, peer config.Peer, ps peerSwitch, m bfd.Metrics) func(from, to bfd.State) {
+	disabled := false
+
+	return func(from, to bfd.State) {
+		m.SessionState(peer.RemoteAddress, from, to)
+
+		logger := log.WithFields(log.Fields{
+			"peer": peer.Name,
+		})
+		logger.Infof("BFD session state changed: %s -> %s", from, to)
+
+		if !peer.BFD.TeardownSession {
+			return
+		}
+
+		switch {
+		case from == bfd.StateUp && to == bfd.StateDown:
+			if err := ps.DisablePeer(ctx, &apipb.DisablePeerRequest{
+				Address:       peer.RemoteAddress,
+				Communication: "BFD session is down",
+			}); err != nil {
+				logger.Warnf("error disabling peer on BFD session down: %s", err)
+				return
+			}
+			disabled = true
+		case to == bfd.StateUp && disabled:
+			if err := ps.EnablePeer(ctx, &apipb.EnablePeerRequest{
+				Address: peer.RemoteAddress,
+			}); err != nil {
+				logger.Warnf("error enabling peer on BFD session up: %s", err)
+				return
+			}
+			disabled = false
+		}
+	}
+}
+
+func newRoutes(routes []config.Route) []announcer.Route {
+	out := make([]announcer.Route, 0, len(routes))
+	for _, route := range routes {
+		out = append(out, announcer.Route{
+			Prefix:              route.Prefix,
+			Communities:         route.Communities,
+			LargeCommunities:    route.LargeCommunities,
+			ExtendedCommunities: route.ExtendedCommunities,
+		})
+	}
+	return out
+}
+
 type spec struct {
 	ConfigPath string    `envconfig:"CONFIG_PATH" default:"/config.yaml"`
 	LogLevel   log.Level `envconfig:"LOG_LEVEL" default:"WARN"`
 }
 
 func main() {
-	ctx := context.TODO()
+	ctx := context.Background()
+
+	// SIGUSR1 shuts anycastd down withdrawing the routes even if graceful
+	// restart is enabled, e.g. when the node is decommissioned
+	decommissionCtx, stopDecommission := signal.NotifyContext(ctx, syscall.SIGUSR1)
+	defer stopDecommission()
+
+	sigCtx, stop := signal.NotifyContext(decommissionCtx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	s := spec{}
 	envconfig.MustProcess("", &s)
@@ -75,38 +726,258 @@ func main() {
 
 	log.Infof("Initializing anycastd (%s @ %s) ...", appVersion, buildTimestamp)
 
-	g, _ := errgroup.WithContext(ctx)
+	// Services are stopped first on shutdown so they don't touch the routes
+	// while they're drained, the rest is stopped once BGP is stopped.
+	svcG, svcCtx := errgroup.WithContext(sigCtx)
+
+	bgCtx, bgCancel := context.WithCancel(ctx)
+	defer bgCancel()
+
+	g, gCtx := errgroup.WithContext(bgCtx)
+
+	var bgpSrv *server.BgpServer
+	var registry *announcer.Registry
+	if cfg.BGPEnabled() {
+		bgpSrv = startBGP(ctx, gCtx, g, cfg, lf, s.LogLevel)
+		registry = announcer.NewRegistry(bgpSrv, announcer.SharePolicy(cfg.Announcer.SharedRoutesPolicy))
+
+		reconcilerMetrics, err := announcer.NewReconcilerMetrics()
+		if err != nil {
+			panic(err)
+		}
+
+		reconciler := announcer.NewReconciler(registry, bgpSrv, reconcilerMetrics, cfg.Announcer.ReconcileInterval.TimeDuration())
+		svcG.Go(func() error {
+			return reconciler.Run(svcCtx)
+		})
+	}
+
+	metrics, err := service.NewMetrics(appVersion)
+	if err != nil {
+		panic(err)
+	}
+
+	// Routes installed outside of BGP are removed by their announcers on
+	// shutdown.
+	var netlinkHandle *netlink.Handle
+	var exaBGPAPI *announcer.ExaBGPAPI
+	external := []announcer.Announcer{}
+
+	log.Info("Starting service initialization ...")
+	for _, svcCfg := range cfg.Services {
+		log.Tracef("Initializing service %s ...", svcCfg.Name)
+
+		checks := []service.Checker{}
+		for _, check := range svcCfg.Checks {
+			log.WithFields(log.Fields{
+				"service": svcCfg.Name,
+				"check":   check.Kind,
+			}).Trace("registering check ...")
+
+			c, err := checkers.NewCheckerByKind(check.Kind, check.Spec)
+			if err != nil {
+				panic(err)
+			}
+
+			checks = append(checks, service.Checker{
+				Check:   c,
+				Group:   check.Group,
+				Degrade: check.OnFailure == "degrade",
+			})
+		}
+
+		var a announcer.Announcer
+		switch svcCfg.Backend {
+		case config.BackendKernel:
+			if netlinkHandle == nil {
+				netlinkHandle, err = netlink.NewHandle()
+				if err != nil {
+					panic(err)
+				}
+			}
+
+			a = announcer.NewKernel(newKernelConfig(svcCfg, cfg.ServiceRoutes(svcCfg), netlinkHandle))
+
+			// routes left by the previous run are removed until the
+			// checks pass
+			if err := a.Denounce(ctx); err != nil {
+				panic(err)
+			}
+			external = append(external, a)
+		case config.BackendBIRD:
+			a = announcer.NewBIRD(newBIRDConfig(svcCfg))
+
+			// protocols left enabled by the previous run are disabled
+			// until the checks pass
+			if err := a.Denounce(ctx); err != nil {
+				panic(err)
+			}
+			external = append(external, a)
+		case config.BackendExaBGP:
+			if exaBGPAPI == nil {
+				w, err := openExaBGPOutput(cfg.ExaBGP.Pipe)
+				if err != nil {
+					panic(err)
+				}
+				exaBGPAPI = announcer.NewExaBGPAPI(w)
+			}
+
+			a = announcer.NewExaBGP(newExaBGPConfig(svcCfg, cfg.ServiceRoutes(svcCfg), cfg.ExaBGP, exaBGPAPI))
+
+			// routes left by the previous run are withdrawn until the
+			// checks pass
+			if err := a.Denounce(ctx); err != nil {
+				panic(err)
+			}
+			external = append(external, a)
+		default:
+			var vrf *announcer.VRF
+			if v := cfg.ServiceVRF(svcCfg); v != nil {
+				vrf = &announcer.VRF{
+					RD:        v.RD,
+					ExportRTs: v.ExportRTs,
+					Label:     v.Label,
+					EVPN:      v.EVPN(),
+				}
+			}
+
+			a = announcer.New(announcer.Config{
+				Name:        svcCfg.Name,
+				Registry:    registry,
+				Routes:      newRoutes(cfg.ServiceRoutes(svcCfg)),
+				NextHop:     cfg.Announcer.LocalIPv4(),
+				NextHopIPv6: cfg.Announcer.LocalIPv6(),
+				Degraded: announcer.Degraded{
+					ASPathPrepend:    svcCfg.Degraded.ASPathPrepend,
+					MED:              svcCfg.Degraded.MED,
+					Communities:      svcCfg.Degraded.Communities,
+					LargeCommunities: svcCfg.Degraded.LargeCommunities,
+				},
+				ExtendedNextHop: cfg.Announcer.ExtendedNextHop(),
+				VRF:             vrf,
+			})
+		}
+
+		strategy, err := service.GetStrategy(svcCfg.Strategy, svcCfg.StrategyOptions)
+		if err != nil {
+			panic(err)
+		}
+
+		var medSource *service.MEDSource
+		if svcCfg.DynamicMED != nil {
+			buckets := []announcer.MEDBucket{}
+			for _, b := range svcCfg.DynamicMED.Buckets {
+				buckets = append(buckets, announcer.MEDBucket{
+					Above: b.Above.TimeDuration().Seconds(),
+					MED:   b.MED,
+				})
+			}
+
+			medSource = &service.MEDSource{
+				Check: svcCfg.DynamicMED.Check,
+				MED:   announcer.NewDynamicMED(buckets, svcCfg.DynamicMED.Hysteresis),
+			}
+		}
+
+		svc := service.New(svcCfg.Name, a, checks, svcCfg.CheckInterval.TimeDuration(), metrics, strategy, medSource)
+
+		svcG.Go(func() error {
+			return svc.Run(svcCtx)
+		})
+	}
+
+	if cfg.Metrics.Enabled {
+		log.Debug("metrics server is enabled, initializing ...")
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+
+		metricsSrv := &http.Server{
+			Addr:    cfg.Metrics.Address,
+			Handler: mux,
+		}
+
+		g.Go(func() error {
+			if err := metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+
+		g.Go(func() error {
+			<-gCtx.Done()
+			return metricsSrv.Shutdown(ctx)
+		})
+
+		if bgpSrv != nil {
+			amr := announcer.NewMetricsRepository(bgpSrv, cfg.Announcer.RouterID, cfg.Announcer.LocalASN)
+			if err := amr.Register(); err != nil {
+				panic(err)
+			}
 
+			g.Go(func() error {
+				return amr.Run(gCtx)
+			})
+		}
+	}
+
+	log.Infof("Initialization completed")
+
+	select {
+	case <-svcCtx.Done():
+	case <-gCtx.Done():
+	}
+
+	log.Info("Shutting down ...")
+	stop()
+
+	svcErr := svcG.Wait()
+
+	for _, a := range external {
+		if err := a.Denounce(ctx); err != nil {
+			log.Warnf("error removing routes: %s", err)
+		}
+	}
+
+	if bgpSrv != nil {
+		keepRoutes := cfg.Announcer.GracefulRestart.Enabled && decommissionCtx.Err() == nil
+		shutdown(ctx, registry, bgpSrv, cfg.Announcer.ShutdownDrainDelay.TimeDuration(), keepRoutes)
+	}
+
+	bgCancel()
+	if err := g.Wait(); err != nil {
+		panic(err)
+	}
+
+	if svcErr != nil {
+		panic(svcErr)
+	}
+
+	log.Info("Shutdown completed")
+}
+
+// startBGP starts GoBGP server with the peers, the export policies and BFD
+// sessions of the peers set up.
+func startBGP(ctx, gCtx context.Context, g *errgroup.Group, cfg *config.Config, lf log.Formatter, level log.Level) *server.BgpServer {
 	log.Trace("Initializing BGP server ...")
 	bgpSrv := server.NewBgpServer(server.LoggerOption(&announcer.Logger{Logger: &log.Logger{
 		Out:       os.Stderr,
 		Formatter: lf,
 		Hooks:     make(log.LevelHooks),
-		Level:     s.LogLevel,
+		Level:     level,
 	}}))
 
-	g.Go(func() error {
+	go func() {
 		log.Trace("Starting to serve GoBGP API")
 		bgpSrv.Serve()
-		return nil
-	})
+	}()
 
 	log.Trace("Starting BGP sessions ...")
 	if err := bgpSrv.StartBgp(ctx, &apipb.StartBgpRequest{
-		Global: &apipb.Global{
-			RouterId:   cfg.Announcer.RouterID,
-			Asn:        cfg.Announcer.LocalASN,
-			ListenPort: -1,
-		},
+		Global: newGlobal(cfg.Announcer),
 	}); err != nil {
 		panic(err)
 	}
-	defer func() {
-		err := bgpSrv.StopBgp(ctx, &apipb.StopBgpRequest{})
-		if err != nil {
-			log.Warnf("error stopping BGP session: %s", err)
-		}
-	}()
 
 	if err := bgpSrv.WatchEvent(context.Background(), &apipb.WatchEventRequest{
 		Peer: &apipb.WatchEventRequest_Peer{},
@@ -118,79 +989,237 @@ func main() {
 		panic(err)
 	}
 
-	for _, peer := range cfg.Announcer.Peers {
+	// BMP stations are added before the peers so the collectors see the
+	// sessions coming up
+	for _, st := range cfg.BMP.Stations {
+		if err := bgpSrv.AddBmp(ctx, newBMPStation(st, cfg.Announcer)); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, dump := range cfg.MRT.Dumps {
+		dumper := announcer.NewMRTDumper(bgpSrv, newMRTDump(dump))
+		if err := dumper.Enable(ctx); err != nil {
+			panic(err)
+		}
+
+		g.Go(func() error {
+			return dumper.Run(gCtx)
+		})
+	}
+
+	for _, group := range cfg.Announcer.DynamicPeerGroups() {
+		pg, err := newPeerGroup(group, cfg.Announcer)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := bgpSrv.AddPeerGroup(ctx, &apipb.AddPeerGroupRequest{
+			PeerGroup: pg,
+		}); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, n := range cfg.Announcer.DynamicNeighbors {
+		if err := bgpSrv.AddDynamicNeighbor(ctx, &apipb.AddDynamicNeighborRequest{
+			DynamicNeighbor: &apipb.DynamicNeighbor{
+				Prefix:    n.Prefix,
+				PeerGroup: n.PeerGroup,
+			},
+		}); err != nil {
+			panic(err)
+		}
+	}
+
+	for i, v := range cfg.Announcer.VRFs {
+		vrf, err := newVRF(v, uint32(i+1))
+		if err != nil {
+			panic(err)
+		}
+
+		if err := bgpSrv.AddVrf(ctx, &apipb.AddVrfRequest{
+			Vrf: vrf,
+		}); err != nil {
+			panic(err)
+		}
+	}
+
+	peers := cfg.Announcer.ResolvedPeers()
+	for _, peer := range peers {
+		// interface neighbor might be not known yet so the interface peers
+		// are added in background
+		if peer.Interface != "" {
+			g.Go(func() error {
+				addInterfacePeer(gCtx, bgpSrv, peer, cfg.Announcer)
+				return nil
+			})
+			continue
+		}
+
+		p, err := newPeer(peer, cfg.Announcer)
+		if err != nil {
+			panic(err)
+		}
+
 		err = bgpSrv.AddPeer(context.Background(), &apipb.AddPeerRequest{
-			Peer: newPeer(peer, cfg.Announcer.LocalAddress),
+			Peer: p,
 		})
 		if err != nil {
 			panic(err)
 		}
 	}
 
-	metrics, err := service.NewMetrics(appVersion)
+	selections := []announcer.PeerSelection{}
+	prepends := []uint32{}
+	for _, svcCfg := range cfg.Services {
+		if !svcCfg.BGP() {
+			continue
+		}
+		prepends = append(prepends, svcCfg.Degraded.ASPathPrepend)
+
+		prefixes := []string{}
+		for _, route := range cfg.ServiceRoutes(svcCfg) {
+			prefixes = append(prefixes, route.Prefix)
+		}
+
+		selections = append(selections, announcer.PeerSelection{
+			Service:   svcCfg.Name,
+			Prefixes:  prefixes,
+			Neighbors: cfg.ServiceNeighbors(svcCfg),
+		})
+	}
+
+	sets, peerSelectionPolicy, err := announcer.NewPeerSelectionPolicy(selections)
 	if err != nil {
 		panic(err)
 	}
 
-	log.Info("Starting service initialization ...")
-	for _, svcCfg := range cfg.Services {
-		log.Tracef("Initializing service %s ...", svcCfg.Name)
+	exportPolicies := []*apipb.Policy{}
+	if peerSelectionPolicy != nil {
+		exportPolicies = append(exportPolicies, peerSelectionPolicy)
+	}
 
-		checks := []service.Checker{}
-		for _, check := range svcCfg.Checks {
-			log.WithFields(log.Fields{
-				"service": svcCfg.Name,
-				"check":   check.Kind,
-			}).Trace("registering check ...")
+	overrides := []announcer.NextHopOverride{}
+	for _, peer := range peers {
+		if peer.NextHop != "" {
+			overrides = append(overrides, announcer.NextHopOverride{
+				Peer:     peer.Name,
+				Neighbor: peer.RemoteAddress,
+				NextHop:  peer.NextHop,
+			})
+		}
+	}
 
-			c, err := checkers.NewCheckerByKind(check.Kind, check.Spec)
+	nextHopSets, nextHopPolicy, err := announcer.NewNextHopPolicy(overrides)
+	if err != nil {
+		panic(err)
+	}
+	sets = append(sets, nextHopSets...)
+	if nextHopPolicy != nil {
+		exportPolicies = append(exportPolicies, nextHopPolicy)
+	}
+
+	prependSets, prependPolicy := announcer.NewDegradedPrependPolicy(prepends)
+	sets = append(sets, prependSets...)
+	if prependPolicy != nil {
+		exportPolicies = append(exportPolicies, prependPolicy)
+	}
+
+	definedSets, err := newDefinedSets(cfg.Announcer.DefinedSets)
+	if err != nil {
+		panic(err)
+	}
+	sets = append(sets, definedSets...)
+
+	policies, err := newPolicies(cfg.Announcer.Policies)
+	if err != nil {
+		panic(err)
+	}
+
+	groupSets, policies, err := newPeerGroupPolicies(cfg.Announcer, policies)
+	if err != nil {
+		panic(err)
+	}
+	sets = append(sets, groupSets...)
+	exportPolicies = append(exportPolicies, policies...)
+
+	if err := announcer.AddExportPolicies(ctx, bgpSrv, sets, exportPolicies); err != nil {
+		panic(err)
+	}
+
+	var bfdMetrics bfd.Metrics
+	bfdServers := map[string]*bfd.Server{}
+	for _, peer := range peers {
+		if peer.BFD == nil {
+			continue
+		}
+
+		if bfdMetrics == nil {
+			bfdMetrics, err = bfd.NewMetrics()
 			if err != nil {
 				panic(err)
 			}
-
-			checks = append(checks, service.Checker{Check: c, Group: check.Group})
 		}
 
-		a := announcer.New(announcer.Config{
-			GoBGP:    bgpSrv,
-			Prefixes: cfg.Announcer.Routes,
-			NextHop:  cfg.Announcer.LocalAddress,
-			LocalASN: cfg.Announcer.LocalASN,
-		})
+		localAddress := cfg.Announcer.LocalAddressFor(peer.RemoteAddress)
+		bfdSrv, ok := bfdServers[localAddress]
+		if !ok {
+			bfdSrv, err = bfd.NewServer(localAddress, bfd.DefaultPort)
+			if err != nil {
+				panic(err)
+			}
+			bfdServers[localAddress] = bfdSrv
+		}
 
-		strategy, err := service.GetStrategy(svcCfg.Strategy, svcCfg.StrategyOptions)
-		if err != nil {
+		if _, err := bfdSrv.AddSession(bfd.SessionConfig{
+			PeerAddress:           peer.RemoteAddress,
+			DesiredMinTxInterval:  peer.BFD.DesiredMinTxInterval.TimeDuration(),
+			RequiredMinRxInterval: peer.BFD.RequiredMinRxInterval.TimeDuration(),
+			DetectMultiplier:      peer.BFD.DetectMultiplier,
+			OnStateChange:         newBFDStateHandler(gCtx, peer, bgpSrv, bfdMetrics),
+		}); err != nil {
 			panic(err)
 		}
+	}
 
-		svc := service.New(svcCfg.Name, a, checks, svcCfg.CheckInterval.TimeDuration(), metrics, strategy)
-
+	for _, bfdSrv := range bfdServers {
 		g.Go(func() error {
-			return svc.Run(ctx)
+			return bfdSrv.Run(gCtx)
 		})
 	}
 
-	if cfg.Metrics.Enabled {
-		log.Debug("metrics server is enabled, initializing ...")
+	return bgpSrv
+}
 
-		g.Go(func() error {
-			http.Handle("/metrics", promhttp.Handler())
-			return http.ListenAndServe(cfg.Metrics.Address, nil)
-		})
+// shutdown moves the traffic away from the node before stopping BGP: the
+// routes are re-announced with GRACEFUL_SHUTDOWN community (RFC 8326),
+// withdrawn after the drain delay and then BGP sessions are closed.
+//
+// With keepRoutes the routes are left announced and BGP is not stopped since
+// Cease NOTIFICATION ends graceful restart (RFC 4724, RFC 8538), the sessions
+// are closed without NOTIFICATION on exit so the peers keep the routes as
+// stale ones until anycastd is back.
+func shutdown(ctx context.Context, registry *announcer.Registry, bgpSrv *server.BgpServer, drainDelay time.Duration, keepRoutes bool) {
+	if keepRoutes {
+		log.Info("keeping the routes announced for graceful restart")
+		return
+	}
 
-		amr := announcer.NewMetricsRepository(bgpSrv, cfg.Announcer.RouterID, cfg.Announcer.LocalASN)
-		if err := amr.Register(); err != nil {
-			panic(err)
+	if drainDelay > 0 {
+		if err := registry.Drain(ctx); err != nil {
+			log.Warnf("error draining routes: %s", err)
 		}
 
-		g.Go(func() error {
-			return amr.Run(ctx)
-		})
+		log.Infof("waiting %s for the traffic to drain ...", drainDelay)
+		time.Sleep(drainDelay)
 	}
 
-	log.Infof("Initialization completed")
+	if err := registry.WithdrawAll(ctx); err != nil {
+		log.Warnf("error withdrawing routes: %s", err)
+	}
 
-	if err := g.Wait(); err != nil {
-		panic(err)
+	if err := bgpSrv.StopBgp(ctx, &apipb.StopBgpRequest{}); err != nil {
+		log.Warnf("error stopping BGP session: %s", err)
 	}
 }
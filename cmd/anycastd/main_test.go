@@ -1,28 +1,904 @@
 package main
 
 import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
+	apipb "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/server"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	th "github.com/teran/go-time"
 
+	"github.com/runityru/anycastd/announcer"
+	"github.com/runityru/anycastd/bfd"
 	"github.com/runityru/anycastd/config"
 )
 
 func TestNewPeer(t *testing.T) {
 	r := require.New(t)
 
-	p := newPeer(config.Peer{
+	p, err := newPeer(config.Peer{
 		Name:           "test-peer",
 		RemoteAddress:  "10.0.0.1",
 		RemoteASN:      65000,
-		EnableMultihop: true,
+		LocalAS:        65100,
+		EnableMultihop: boolPtr(true),
 		MultihopTTL:    2,
-	}, "10.0.0.2")
+	}, config.Announcer{
+		LocalAddress:     "10.0.0.2",
+		LocalAddressIPv6: "2001:db8::2",
+	})
+	r.NoError(err)
 
 	r.Equal("10.0.0.1", p.Conf.NeighborAddress)
 	r.Equal(uint32(65000), p.Conf.PeerAsn)
+	r.Equal(uint32(65100), p.Conf.LocalAsn)
 	r.True(p.EbgpMultihop.Enabled)
 	r.Equal(uint32(2), p.EbgpMultihop.MultihopTtl)
 	r.NotNil(p.Transport)
 	r.Equal("10.0.0.2", p.Transport.LocalAddress)
+	r.Len(p.AfiSafis, 2)
+	r.Equal(apipb.Family_AFI_IP, p.AfiSafis[0].Config.Family.Afi)
+	r.Equal(apipb.Family_AFI_IP6, p.AfiSafis[1].Config.Family.Afi)
+}
+
+func TestNewPeerIPv6(t *testing.T) {
+	r := require.New(t)
+
+	p, err := newPeer(config.Peer{
+		Name:          "test-peer",
+		RemoteAddress: "2001:db8::1",
+		RemoteASN:     65000,
+		Families:      []string{"ipv6-unicast"},
+	}, config.Announcer{
+		LocalAddress:     "10.0.0.2",
+		LocalAddressIPv6: "2001:db8::2",
+	})
+	r.NoError(err)
+
+	r.Equal("2001:db8::1", p.Conf.NeighborAddress)
+	r.Equal("2001:db8::2", p.Transport.LocalAddress)
+	r.Len(p.AfiSafis, 1)
+	r.Equal(apipb.Family_AFI_IP6, p.AfiSafis[0].Config.Family.Afi)
+	r.Equal(apipb.Family_SAFI_UNICAST, p.AfiSafis[0].Config.Family.Safi)
+	r.True(p.AfiSafis[0].Config.Enabled)
+}
+
+func TestNewPeerInterface(t *testing.T) {
+	r := require.New(t)
+
+	defer func(fn func(string) (string, error)) { linkLocalNeighbor = fn }(linkLocalNeighbor)
+	linkLocalNeighbor = func(ifname string) (string, error) {
+		if ifname != "eth1" {
+			return "", errors.New("no ipv6 link-local neighbor found")
+		}
+		return "fe80::1%eth1", nil
+	}
+
+	p, err := newPeer(config.Peer{
+		Name:      "test-peer",
+		Interface: "eth1",
+		RemoteASN: 65000,
+	}, config.Announcer{
+		LocalAddress: "2001:db8::2",
+	})
+	r.NoError(err)
+
+	r.Equal("fe80::1%eth1", p.Conf.NeighborAddress)
+	r.Equal("eth1", p.Conf.NeighborInterface)
+	r.Empty(p.Transport.LocalAddress)
+	r.Len(p.AfiSafis, 2)
+	r.Equal(apipb.Family_AFI_IP, p.AfiSafis[0].Config.Family.Afi)
+	r.Equal(apipb.Family_AFI_IP6, p.AfiSafis[1].Config.Family.Afi)
+
+	_, err = newPeer(config.Peer{
+		Name:      "test-peer",
+		Interface: "eth2",
+		RemoteASN: 65000,
+	}, config.Announcer{
+		LocalAddress: "2001:db8::2",
+	})
+	r.Error(err)
+	r.Equal("error looking up neighbor of peer `test-peer` on `eth2`: no ipv6 link-local neighbor found", err.Error())
+}
+
+type peerAdderMock struct {
+	mock.Mock
+}
+
+func (m *peerAdderMock) AddPeer(_ context.Context, r *apipb.AddPeerRequest) error {
+	args := m.Called(r.Peer.Conf.NeighborAddress)
+	return args.Error(0)
+}
+
+func TestAddInterfacePeer(t *testing.T) {
+	r := require.New(t)
+
+	defer func(d, m time.Duration) {
+		interfacePeerRetryInterval, interfacePeerMaxRetryInterval = d, m
+	}(interfacePeerRetryInterval, interfacePeerMaxRetryInterval)
+	interfacePeerRetryInterval, interfacePeerMaxRetryInterval = time.Millisecond, 2*time.Millisecond
+
+	lookups := 0
+	defer func(fn func(string) (string, error)) { linkLocalNeighbor = fn }(linkLocalNeighbor)
+	linkLocalNeighbor = func(ifname string) (string, error) {
+		lookups++
+		if lookups < 3 {
+			return "", errors.New("no ipv6 link-local neighbor found")
+		}
+		return "fe80::1%eth1", nil
+	}
+
+	paM := &peerAdderMock{}
+	defer paM.AssertExpectations(t)
+
+	paM.On("AddPeer", "fe80::1%eth1").Return(errors.New("peer already exists")).Once()
+	paM.On("AddPeer", "fe80::1%eth1").Return(nil).Once()
+
+	peer := config.Peer{
+		Name:      "test-peer",
+		Interface: "eth1",
+		RemoteASN: 65000,
+	}
+
+	addInterfacePeer(context.Background(), paM, peer, config.Announcer{})
+	r.Equal(4, lookups)
+
+	// the attempts stop once the context is done
+	linkLocalNeighbor = func(ifname string) (string, error) {
+		return "", errors.New("no ipv6 link-local neighbor found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	addInterfacePeer(ctx, paM, peer, config.Announcer{})
+	r.Error(ctx.Err())
+}
+
+func TestNewPeerTimers(t *testing.T) {
+	r := require.New(t)
+
+	p, err := newPeer(config.Peer{
+		Name:                   "leaf",
+		RemoteAddress:          "10.0.0.1",
+		RemoteASN:              65000,
+		HoldTime:               th.Duration(9 * time.Second),
+		KeepaliveInterval:      th.Duration(3 * time.Second),
+		ConnectRetry:           th.Duration(5 * time.Second),
+		IdleHoldTimeAfterReset: th.Duration(10 * time.Second),
+		PassiveMode:            boolPtr(true),
+		RemotePort:             1179,
+	}, config.Announcer{LocalAddress: "10.0.0.2"})
+	r.NoError(err)
+
+	r.Equal(uint64(9), p.Timers.Config.HoldTime)
+	r.Equal(uint64(3), p.Timers.Config.KeepaliveInterval)
+	r.Equal(uint64(5), p.Timers.Config.ConnectRetry)
+	r.Equal(uint64(10), p.Timers.Config.IdleHoldTimeAfterReset)
+	r.True(p.Transport.PassiveMode)
+	r.Equal(uint32(1179), p.Transport.RemotePort)
+}
+
+func TestNewPeerGroup(t *testing.T) {
+	r := require.New(t)
+
+	pg, err := newPeerGroup(config.PeerGroup{
+		Name:              "tor",
+		RemoteASN:         65000,
+		Families:          []string{"ipv4-unicast"},
+		Password:          "secret",
+		HoldTime:          th.Duration(9 * time.Second),
+		KeepaliveInterval: th.Duration(3 * time.Second),
+	}, config.Announcer{LocalAddress: "10.0.0.2"})
+	r.NoError(err)
+
+	r.Equal("tor", pg.Conf.PeerGroupName)
+	r.Equal(uint32(65000), pg.Conf.PeerAsn)
+	r.Equal("secret", pg.Conf.AuthPassword)
+	r.Equal(uint64(9), pg.Timers.Config.HoldTime)
+	r.Equal(uint64(3), pg.Timers.Config.KeepaliveInterval)
+	r.Len(pg.AfiSafis, 1)
+	r.Equal(apipb.Family_AFI_IP, pg.AfiSafis[0].Config.Family.Afi)
+}
+
+func TestNewGlobal(t *testing.T) {
+	r := require.New(t)
+
+	a := config.Announcer{
+		RouterID:         "10.3.3.3",
+		LocalAddress:     "10.0.0.2",
+		LocalAddressIPv6: "2001:db8::2",
+		LocalASN:         65999,
+		Peers: []config.Peer{
+			{Name: "leaf1", RemoteAddress: "10.0.0.1"},
+		},
+	}
+
+	g := newGlobal(a)
+	r.Equal("10.3.3.3", g.RouterId)
+	r.Equal(uint32(65999), g.Asn)
+	r.Equal(int32(-1), g.ListenPort)
+	r.Empty(g.ListenAddresses)
+
+	a.Peers = append(a.Peers, config.Peer{Name: "leaf2", RemoteAddress: "10.0.0.3", PassiveMode: boolPtr(true)})
+
+	g = newGlobal(a)
+	r.Equal(int32(179), g.ListenPort)
+	r.Equal([]string{"10.0.0.2", "2001:db8::2"}, g.ListenAddresses)
+
+	a.Listener = config.Listener{Enabled: true, Port: 1179, Addresses: []string{"10.0.0.5"}}
+
+	g = newGlobal(a)
+	r.Equal(int32(1179), g.ListenPort)
+	r.Equal([]string{"10.0.0.5"}, g.ListenAddresses)
+}
+
+func TestNewPeerPassword(t *testing.T) {
+	r := require.New(t)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	r.NoError(os.WriteFile(passwordFile, []byte("from-file\n"), 0o600))
+
+	t.Setenv("ANYCASTD_TEST_PEER_PASSWORD", "from-env")
+
+	type testCase struct {
+		name        string
+		peer        config.Peer
+		expPassword string
+		expError    error
+	}
+
+	tcs := []testCase{
+		{
+			name:        "inline password",
+			peer:        config.Peer{Name: "p1", RemoteAddress: "10.0.0.1", Password: "inline"},
+			expPassword: "inline",
+		},
+		{
+			name:        "password file",
+			peer:        config.Peer{Name: "p1", RemoteAddress: "10.0.0.1", PasswordFile: passwordFile},
+			expPassword: "from-file",
+		},
+		{
+			name:        "password environment variable",
+			peer:        config.Peer{Name: "p1", RemoteAddress: "10.0.0.1", PasswordEnv: "ANYCASTD_TEST_PEER_PASSWORD"},
+			expPassword: "from-env",
+		},
+		{
+			name:     "unset environment variable",
+			peer:     config.Peer{Name: "p1", RemoteAddress: "10.0.0.1", PasswordEnv: "ANYCASTD_TEST_PEER_PASSWORD_UNSET"},
+			expError: errors.New("environment variable `ANYCASTD_TEST_PEER_PASSWORD_UNSET` with password for peer `p1` is not set"),
+		},
+		{
+			name:        "no password",
+			peer:        config.Peer{Name: "p1", RemoteAddress: "10.0.0.1"},
+			expPassword: "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			p, err := newPeer(tc.peer, config.Announcer{LocalAddress: "10.0.0.2"})
+			if tc.expError != nil {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.expPassword, p.Conf.AuthPassword)
+		})
+	}
+}
+
+func TestNewPeerGracefulRestart(t *testing.T) {
+	r := require.New(t)
+
+	a := config.Announcer{
+		RouterID:     "10.3.3.3",
+		LocalAddress: "10.0.0.2",
+		LocalASN:     65999,
+		GracefulRestart: config.GracefulRestart{
+			Enabled:     true,
+			RestartTime: th.Duration(120 * time.Second),
+			LongLived: config.LongLivedGracefulRestart{
+				Enabled:     true,
+				RestartTime: th.Duration(time.Hour),
+			},
+		},
+	}
+
+	p, err := newPeer(config.Peer{
+		Name:          "leaf",
+		RemoteAddress: "10.0.0.1",
+		RemoteASN:     65000,
+		Families:      []string{"ipv4-unicast"},
+	}, a)
+	r.NoError(err)
+
+	r.True(p.GracefulRestart.Enabled)
+	r.Equal(uint32(120), p.GracefulRestart.RestartTime)
+	r.True(p.GracefulRestart.LonglivedEnabled)
+	r.Len(p.AfiSafis, 1)
+	r.True(p.AfiSafis[0].MpGracefulRestart.Config.Enabled)
+	r.True(p.AfiSafis[0].LongLivedGracefulRestart.Config.Enabled)
+	r.Equal(uint32(3600), p.AfiSafis[0].LongLivedGracefulRestart.Config.RestartTime)
+
+	g := newGlobal(a)
+	r.True(g.GracefulRestart.Enabled)
+	r.Equal(uint32(120), g.GracefulRestart.RestartTime)
+
+	a.GracefulRestart = config.GracefulRestart{}
+
+	p, err = newPeer(config.Peer{
+		Name:          "leaf",
+		RemoteAddress: "10.0.0.1",
+		RemoteASN:     65000,
+	}, a)
+	r.NoError(err)
+
+	r.False(p.GracefulRestart.Enabled)
+	r.Nil(p.AfiSafis[0].MpGracefulRestart)
+	r.Nil(p.AfiSafis[0].LongLivedGracefulRestart)
+}
+
+func TestShutdownGracefulRestart(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	r.NoError(err)
+	port := l.Addr().(*net.TCPAddr).Port
+	r.NoError(l.Close())
+
+	a := config.Announcer{
+		RouterID:        "127.0.0.1",
+		LocalAddress:    "127.0.0.1",
+		LocalASN:        65999,
+		GracefulRestart: config.GracefulRestart{Enabled: true, RestartTime: th.Duration(120 * time.Second)},
+	}
+
+	srv := server.NewBgpServer()
+	go srv.Serve()
+	r.NoError(srv.StartBgp(ctx, &apipb.StartBgpRequest{Global: newGlobal(a)}))
+	defer srv.StopBgp(ctx, &apipb.StopBgpRequest{})
+
+	remote := server.NewBgpServer()
+	go remote.Serve()
+	r.NoError(remote.StartBgp(ctx, &apipb.StartBgpRequest{Global: &apipb.Global{
+		Asn:             65000,
+		RouterId:        "127.0.0.2",
+		ListenPort:      int32(port),
+		ListenAddresses: []string{"127.0.0.2"},
+		GracefulRestart: newGracefulRestart(a.GracefulRestart),
+	}}))
+	defer remote.StopBgp(ctx, &apipb.StopBgpRequest{})
+
+	p, err := newPeer(config.Peer{
+		Name:          "leaf",
+		RemoteAddress: "127.0.0.2",
+		RemoteASN:     65000,
+		RemotePort:    uint32(port),
+		ConnectRetry:  th.Duration(time.Second),
+		Families:      []string{"ipv4-unicast"},
+	}, a)
+	r.NoError(err)
+	r.NoError(srv.AddPeer(ctx, &apipb.AddPeerRequest{Peer: p}))
+	r.NoError(remote.AddPeer(ctx, &apipb.AddPeerRequest{Peer: &apipb.Peer{
+		Conf:            &apipb.PeerConf{NeighborAddress: "127.0.0.1", PeerAsn: 65999},
+		Transport:       &apipb.Transport{PassiveMode: true},
+		GracefulRestart: newGracefulRestart(a.GracefulRestart),
+		AfiSafis:        newAfiSafis([]string{"ipv4-unicast"}, a.GracefulRestart),
+	}}))
+
+	registry := announcer.NewRegistry(srv, announcer.SharePolicyAny)
+	r.NoError(announcer.New(announcer.Config{
+		Name:     "dns",
+		Registry: registry,
+		Routes:   []announcer.Route{{Prefix: "172.16.38.43/32"}},
+		NextHop:  "127.0.0.1",
+	}).Announce(ctx))
+
+	received := func() int {
+		n := 0
+		r.NoError(remote.ListPath(ctx, &apipb.ListPathRequest{
+			TableType: apipb.TableType_GLOBAL,
+			Family:    &apipb.Family{Afi: apipb.Family_AFI_IP, Safi: apipb.Family_SAFI_UNICAST},
+		}, func(d *apipb.Destination) {
+			n += len(d.GetPaths())
+		}))
+		return n
+	}
+	r.Eventually(func() bool { return received() == 1 }, 30*time.Second, 100*time.Millisecond)
+
+	// neither withdrawal nor Cease is sent so the paths are kept by the peer
+	// until the sessions are closed on exit
+	shutdown(ctx, registry, srv, 0, true)
+	r.Never(func() bool { return received() != 1 }, time.Second, 100*time.Millisecond)
+
+	established := false
+	r.NoError(srv.ListPeer(ctx, &apipb.ListPeerRequest{}, func(p *apipb.Peer) {
+		established = p.GetState().GetSessionState() == apipb.PeerState_ESTABLISHED
+	}))
+	r.True(established)
+
+	// decommission withdraws the routes
+	shutdown(ctx, registry, srv, 0, false)
+	r.Eventually(func() bool { return received() == 0 }, 30*time.Second, 100*time.Millisecond)
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+type peerSwitchMock struct {
+	mock.Mock
+}
+
+func (m *peerSwitchMock) EnablePeer(_ context.Context, r *apipb.EnablePeerRequest) error {
+	args := m.Called(r.Address)
+	return args.Error(0)
+}
+
+func (m *peerSwitchMock) DisablePeer(_ context.Context, r *apipb.DisablePeerRequest) error {
+	args := m.Called(r.Address)
+	return args.Error(0)
+}
+
+func TestBFDStateHandler(t *testing.T) {
+	peer := config.Peer{
+		Name:          "leaf",
+		RemoteAddress: "10.0.0.1",
+		RemoteASN:     65000,
+		BFD:           &config.BFD{TeardownSession: true},
+	}
+
+	psM := &peerSwitchMock{}
+	defer psM.AssertExpectations(t)
+
+	mM := bfd.NewMetricsMock()
+	defer mM.AssertExpectations(t)
+
+	mM.On("SessionState", "10.0.0.1", bfd.StateDown, bfd.StateInit).Return().Once()
+	mM.On("SessionState", "10.0.0.1", bfd.StateInit, bfd.StateDown).Return().Once()
+	mM.On("SessionState", "10.0.0.1", bfd.StateDown, bfd.StateUp).Return().Twice()
+	mM.On("SessionState", "10.0.0.1", bfd.StateUp, bfd.StateDown).Return().Once()
+
+	disable := psM.On("DisablePeer", "10.0.0.1").Return(nil).Once()
+	psM.On("EnablePeer", "10.0.0.1").Return(nil).NotBefore(disable).Once()
+
+	h := newBFDStateHandler(context.Background(), peer, psM, mM)
+
+	// session coming up for the first time doesn't touch the peer
+	h(bfd.StateDown, bfd.StateInit)
+	h(bfd.StateInit, bfd.StateDown)
+	h(bfd.StateDown, bfd.StateUp)
+
+	h(bfd.StateUp, bfd.StateDown)
+	h(bfd.StateDown, bfd.StateUp)
+}
+
+func TestNewPolicies(t *testing.T) {
+	r := require.New(t)
+
+	med := uint32(100)
+	a := config.Announcer{
+		LocalASN: 65999,
+		DefinedSets: config.DefinedSets{
+			PrefixSets: []config.PrefixSet{
+				{Name: "vips", Prefixes: []config.PolicyPrefix{
+					{Prefix: "10.0.0.128/32"},
+					{Prefix: "10.1.0.0/16", MaskLengthMin: 24},
+				}},
+			},
+			NeighborSets: []config.NeighborSet{
+				{Name: "edge", Neighbors: []string{"10.0.0.253", "2001:db8::/64"}},
+			},
+			CommunitySets: []config.CommunitySet{
+				{Name: "blackhole", Communities: []string{"blackhole", "65000:666"}},
+			},
+		},
+		Policies: []config.Policy{
+			{Name: "edge", Statements: []config.Statement{
+				{
+					Conditions: config.PolicyConditions{
+						PrefixSet:   &config.MatchSet{Name: "vips"},
+						NeighborSet: &config.MatchSet{Name: "edge", Match: "invert"},
+					},
+					Actions: config.PolicyActions{
+						MED:              &med,
+						ASPathPrepend:    2,
+						Communities:      []string{"no-export"},
+						LargeCommunities: []string{"65999:1:2"},
+					},
+				},
+				{
+					Conditions: config.PolicyConditions{
+						CommunitySet: &config.MatchSet{Name: "blackhole", Match: "all"},
+					},
+					Actions: config.PolicyActions{Reject: true},
+				},
+			}},
+		},
+	}
+
+	sets, err := newDefinedSets(a.DefinedSets)
+	r.NoError(err)
+	r.Equal([]*apipb.DefinedSet{
+		{DefinedType: apipb.DefinedType_PREFIX, Name: "vips", Prefixes: []*apipb.Prefix{
+			{IpPrefix: "10.0.0.128/32", MaskLengthMin: 32, MaskLengthMax: 32},
+			{IpPrefix: "10.1.0.0/16", MaskLengthMin: 24, MaskLengthMax: 32},
+		}},
+		{DefinedType: apipb.DefinedType_NEIGHBOR, Name: "edge", List: []string{"10.0.0.253/32", "2001:db8::/64"}},
+		{DefinedType: apipb.DefinedType_COMMUNITY, Name: "blackhole", List: []string{"65535:666", "65000:666"}},
+	}, sets)
+
+	policies, err := newPolicies(a.Policies)
+	r.NoError(err)
+	r.Len(policies, 1)
+	r.Equal([]*apipb.Statement{
+		{
+			Name: "edge-0",
+			Conditions: &apipb.Conditions{
+				PrefixSet:   &apipb.MatchSet{Name: "vips", Type: apipb.MatchSet_ANY},
+				NeighborSet: &apipb.MatchSet{Name: "edge", Type: apipb.MatchSet_INVERT},
+			},
+			Actions: &apipb.Actions{
+				RouteAction:    apipb.RouteAction_NONE,
+				Med:            &apipb.MedAction{Type: apipb.MedAction_REPLACE, Value: 100},
+				AsPrepend:      &apipb.AsPrependAction{Repeat: 2, UseLeftMost: true},
+				Community:      &apipb.CommunityAction{Type: apipb.CommunityAction_ADD, Communities: []string{"65535:65281"}},
+				LargeCommunity: &apipb.CommunityAction{Type: apipb.CommunityAction_ADD, Communities: []string{"65999:1:2"}},
+			},
+		},
+		{
+			Name: "edge-1",
+			Conditions: &apipb.Conditions{
+				CommunitySet: &apipb.MatchSet{Name: "blackhole", Type: apipb.MatchSet_ALL},
+			},
+			Actions: &apipb.Actions{RouteAction: apipb.RouteAction_REJECT},
+		},
+	}, policies[0].Statements)
+
+	srv := server.NewBgpServer()
+	go srv.Serve()
+	r.NoError(srv.StartBgp(context.Background(), &apipb.StartBgpRequest{Global: &apipb.Global{
+		Asn:        65999,
+		RouterId:   "10.3.3.3",
+		ListenPort: -1,
+	}}))
+	defer srv.StopBgp(context.Background(), &apipb.StopBgpRequest{})
+
+	r.NoError(announcer.AddExportPolicies(context.Background(), srv, sets, policies))
+}
+
+func TestNewPeerGroupPolicies(t *testing.T) {
+	r := require.New(t)
+
+	med := uint32(100)
+	a := config.Announcer{
+		LocalASN: 65999,
+		PeerGroups: []config.PeerGroup{
+			{Name: "tor", RemoteASN: 65000, Policies: []string{"backup"}},
+			{Name: "spine", RemoteASN: 65100, Policies: []string{"backup"}},
+			{Name: "edge", RemoteASN: 65200, Policies: []string{"backup"}},
+		},
+		Peers: []config.Peer{
+			{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"},
+			{Name: "spine1", PeerGroup: "spine", RemoteAddress: "10.0.0.254"},
+		},
+		DynamicNeighbors: []config.DynamicNeighbor{{Prefix: "10.0.2.0/24", PeerGroup: "tor"}},
+		Policies: []config.Policy{
+			{Name: "backup", Statements: []config.Statement{{Actions: config.PolicyActions{MED: &med}}}},
+			{Name: "all", Statements: []config.Statement{{Actions: config.PolicyActions{Communities: []string{"no-export"}}}}},
+		},
+	}
+
+	policies, err := newPolicies(a.Policies)
+	r.NoError(err)
+
+	sets, policies, err := newPeerGroupPolicies(a, policies)
+	r.NoError(err)
+	r.Equal([]*apipb.DefinedSet{
+		{DefinedType: apipb.DefinedType_NEIGHBOR, Name: "anycastd-group-tor", List: []string{"10.0.0.252/32", "10.0.2.0/24"}},
+		{DefinedType: apipb.DefinedType_NEIGHBOR, Name: "anycastd-group-spine", List: []string{"10.0.0.254/32"}},
+	}, sets)
+
+	// the group without members gets no copy and the policy is not applied
+	// to the rest of the peers
+	r.Len(policies, 3)
+	r.Equal("anycastd-group-tor-backup", policies[0].Name)
+	r.Equal("anycastd-group-tor-backup-0", policies[0].Statements[0].Name)
+	r.Equal(&apipb.MatchSet{Type: apipb.MatchSet_ANY, Name: "anycastd-group-tor"}, policies[0].Statements[0].Conditions.NeighborSet)
+	r.Equal(&apipb.MedAction{Type: apipb.MedAction_REPLACE, Value: 100}, policies[0].Statements[0].Actions.Med)
+	r.Equal("anycastd-group-spine-backup", policies[1].Name)
+	r.Equal(&apipb.MatchSet{Type: apipb.MatchSet_ANY, Name: "anycastd-group-spine"}, policies[1].Statements[0].Conditions.NeighborSet)
+	r.Equal("all", policies[2].Name)
+	r.Nil(policies[2].Statements[0].Conditions.NeighborSet)
+
+	srv := server.NewBgpServer()
+	go srv.Serve()
+	r.NoError(srv.StartBgp(context.Background(), &apipb.StartBgpRequest{Global: &apipb.Global{
+		Asn:        65999,
+		RouterId:   "10.3.3.3",
+		ListenPort: -1,
+	}}))
+	defer srv.StopBgp(context.Background(), &apipb.StopBgpRequest{})
+
+	r.NoError(announcer.AddExportPolicies(context.Background(), srv, sets, policies))
+}
+
+func TestNewVRF(t *testing.T) {
+	r := require.New(t)
+
+	v, err := newVRF(config.VRF{
+		Name:      "customer",
+		RD:        "65000:100",
+		ImportRTs: []string{"65000:100", "10.0.0.1:100"},
+		ExportRTs: []string{"65000:100"},
+	}, 1)
+	r.NoError(err)
+	r.Equal("customer", v.Name)
+	r.Equal(uint32(1), v.Id)
+	r.Len(v.ImportRt, 2)
+	r.Len(v.ExportRt, 1)
+
+	srv := server.NewBgpServer()
+	go srv.Serve()
+	r.NoError(srv.StartBgp(context.Background(), &apipb.StartBgpRequest{Global: &apipb.Global{
+		Asn:        65999,
+		RouterId:   "10.0.0.1",
+		ListenPort: -1,
+	}}))
+	defer srv.StopBgp(context.Background(), &apipb.StopBgpRequest{})
+
+	r.NoError(srv.AddVrf(context.Background(), &apipb.AddVrfRequest{Vrf: v}))
+
+	names := []string{}
+	r.NoError(srv.ListVrf(context.Background(), &apipb.ListVrfRequest{}, func(v *apipb.Vrf) {
+		names = append(names, v.Name)
+	}))
+	r.Equal([]string{"customer"}, names)
+}
+
+func TestNewPeerVPNFamilies(t *testing.T) {
+	r := require.New(t)
+
+	p, err := newPeer(config.Peer{
+		Name:          "test-peer",
+		RemoteAddress: "10.0.0.1",
+		RemoteASN:     65000,
+		Families:      []string{"ipv4-vpn", "ipv6-vpn", "l2vpn-evpn"},
+	}, config.Announcer{
+		LocalAddress: "10.0.0.2",
+	})
+	r.NoError(err)
+
+	r.Len(p.AfiSafis, 3)
+	r.Equal(apipb.Family_AFI_IP, p.AfiSafis[0].Config.Family.Afi)
+	r.Equal(apipb.Family_SAFI_MPLS_VPN, p.AfiSafis[0].Config.Family.Safi)
+	r.Equal(apipb.Family_AFI_IP6, p.AfiSafis[1].Config.Family.Afi)
+	r.Equal(apipb.Family_SAFI_MPLS_VPN, p.AfiSafis[1].Config.Family.Safi)
+	r.Equal(apipb.Family_AFI_L2VPN, p.AfiSafis[2].Config.Family.Afi)
+	r.Equal(apipb.Family_SAFI_EVPN, p.AfiSafis[2].Config.Family.Safi)
+}
+
+func TestNewBMPStation(t *testing.T) {
+	r := require.New(t)
+
+	req := newBMPStation(config.BMPStation{
+		Address:            "10.0.0.100",
+		Port:               5000,
+		Policy:             "local",
+		StatisticsInterval: th.Duration(time.Minute),
+	}, config.Announcer{RouterID: "10.3.3.3"})
+	r.Equal("10.0.0.100", req.Address)
+	r.Equal(uint32(5000), req.Port)
+	r.Equal(apipb.AddBmpRequest_LOCAL, req.Policy)
+	r.Equal(int32(60), req.StatisticsTimeout)
+	r.Equal("10.3.3.3", req.SysName)
+
+	req = newBMPStation(config.BMPStation{
+		Address: "10.0.0.100",
+		SysName: "node1",
+	}, config.Announcer{RouterID: "10.3.3.3"})
+	r.Equal(apipb.AddBmpRequest_PRE, req.Policy)
+	r.Equal("node1", req.SysName)
+}
+
+func TestBMPStationInitiation(t *testing.T) {
+	r := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	defer l.Close()
+
+	srv := server.NewBgpServer()
+	go srv.Serve()
+	r.NoError(srv.StartBgp(context.Background(), &apipb.StartBgpRequest{Global: &apipb.Global{
+		Asn:        65999,
+		RouterId:   "10.0.0.1",
+		ListenPort: -1,
+	}}))
+	defer srv.StopBgp(context.Background(), &apipb.StopBgpRequest{})
+
+	port := l.Addr().(*net.TCPAddr).Port
+	r.NoError(srv.AddBmp(context.Background(), newBMPStation(config.BMPStation{
+		Address: "127.0.0.1",
+		Port:    uint32(port),
+		Policy:  "post",
+	}, config.Announcer{RouterID: "10.0.0.1"})))
+
+	stations := []string{}
+	r.NoError(srv.ListBmp(context.Background(), &apipb.ListBmpRequest{}, func(st *apipb.ListBmpResponse_BmpStation) {
+		stations = append(stations, st.GetConf().GetAddress())
+	}))
+	r.Equal([]string{"127.0.0.1"}, stations)
+
+	conn, err := l.Accept()
+	r.NoError(err)
+	defer conn.Close()
+
+	r.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+
+	// common header: version, message length and message type
+	hdr := make([]byte, 6)
+	_, err = io.ReadFull(conn, hdr)
+	r.NoError(err)
+	r.Equal(byte(3), hdr[0])
+	r.Equal(byte(4), hdr[5], "initiation message is expected first")
+
+	body := make([]byte, binary.BigEndian.Uint32(hdr[1:5])-6)
+	_, err = io.ReadFull(conn, body)
+	r.NoError(err)
+	r.Contains(string(body), "10.0.0.1")
+	r.Contains(string(body), "anycastd "+appVersion)
+}
+
+func TestNewMRTDump(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(announcer.MRTDump{
+		Updates:          true,
+		FileName:         "/var/lib/anycastd/updates.20060102.1504.mrt",
+		RotationInterval: time.Hour,
+		MaxSize:          100 << 20,
+	}, newMRTDump(config.MRTDump{
+		Type:             "updates",
+		FileName:         "/var/lib/anycastd/updates.20060102.1504.mrt",
+		RotationInterval: th.Duration(time.Hour),
+		MaxSizeMB:        100,
+	}))
+
+	r.Equal(announcer.MRTDump{
+		FileName:     "/var/lib/anycastd/table.mrt",
+		DumpInterval: 5 * time.Minute,
+	}, newMRTDump(config.MRTDump{
+		Type:         "table",
+		FileName:     "/var/lib/anycastd/table.mrt",
+		DumpInterval: th.Duration(5 * time.Minute),
+	}))
+}
+
+func TestNewKernelConfig(t *testing.T) {
+	r := require.New(t)
+
+	kc := newKernelConfig(config.Service{
+		Name: "dns",
+		Kernel: &config.Kernel{
+			Type:           "local",
+			Table:          100,
+			Protocol:       200,
+			Metric:         10,
+			DegradedMetric: 500,
+		},
+	}, []config.Route{{Prefix: "10.0.0.53/32"}}, nil)
+
+	r.Equal(announcer.KernelConfig{
+		Name:           "dns",
+		Routes:         []announcer.Route{{Prefix: "10.0.0.53/32"}},
+		Type:           "local",
+		Table:          100,
+		Protocol:       200,
+		Metric:         10,
+		DegradedMetric: 500,
+	}, kc)
+}
+
+func TestNewBIRDConfig(t *testing.T) {
+	r := require.New(t)
+
+	bc := newBIRDConfig(config.Service{
+		Name: "dns",
+		BIRD: &config.BIRD{
+			Socket:           "/run/bird/bird.ctl",
+			Protocol:         "anycast_dns",
+			DegradedProtocol: "anycast_dns_degraded",
+			Timeout:          th.Duration(3 * time.Second),
+		},
+	})
+
+	r.Equal(announcer.BIRDConfig{
+		Name:             "dns",
+		Socket:           "/run/bird/bird.ctl",
+		Protocol:         "anycast_dns",
+		DegradedProtocol: "anycast_dns_degraded",
+		Timeout:          3 * time.Second,
+	}, bc)
+}
+
+func TestNewExaBGPConfig(t *testing.T) {
+	r := require.New(t)
+
+	api := announcer.NewExaBGPAPI(io.Discard)
+	ec := newExaBGPConfig(config.Service{
+		Name: "dns",
+		Degraded: config.Degraded{
+			ASPathPrepend: 2,
+			MED:           500,
+			Communities:   []string{"no-export"},
+		},
+	}, []config.Route{{Prefix: "10.0.0.53/32"}}, config.ExaBGP{NextHop: "10.0.0.1", LocalASN: 65999}, api)
+
+	r.Equal(announcer.ExaBGPConfig{
+		Name:     "dns",
+		API:      api,
+		Routes:   []announcer.Route{{Prefix: "10.0.0.53/32"}},
+		NextHop:  "10.0.0.1",
+		LocalASN: 65999,
+		Degraded: announcer.Degraded{
+			ASPathPrepend: 2,
+			MED:           500,
+			Communities:   []string{"no-export"},
+		},
+	}, ec)
+}
+
+func TestOpenExaBGPOutput(t *testing.T) {
+	r := require.New(t)
+
+	w, err := openExaBGPOutput("")
+	r.NoError(err)
+	r.Equal(os.Stdout, w)
+
+	pipe := filepath.Join(t.TempDir(), "exabgp.in")
+	r.NoError(syscall.Mkfifo(pipe, 0o600))
+
+	// the pipe is opened without waiting for the reader
+	w, err = openExaBGPOutput(pipe)
+	r.NoError(err)
+	defer w.(io.Closer).Close()
+
+	api := announcer.NewExaBGPAPI(w)
+	r.NoError(api.Send("announce route 10.0.0.53/32 next-hop self"))
+
+	f, err := os.Open(pipe)
+	r.NoError(err)
+	defer f.Close()
+
+	buf := make([]byte, 64)
+	n, err := f.Read(buf)
+	r.NoError(err)
+	r.Equal("announce route 10.0.0.53/32 next-hop self\n", string(buf[:n]))
+
+	regular := filepath.Join(t.TempDir(), "exabgp.in")
+	r.NoError(os.WriteFile(regular, nil, 0o600))
+
+	_, err = openExaBGPOutput(regular)
+	r.EqualError(err, "`"+regular+"` is not a named pipe")
+
+	_, err = openExaBGPOutput(filepath.Join(t.TempDir(), "missing"))
+	r.ErrorContains(err, "error looking up ExaBGP pipe")
 }
@@ -2,9 +2,14 @@ package config
 
 import (
 	"encoding/json"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -12,80 +17,1201 @@ import (
 	"github.com/pkg/errors"
 	th "github.com/teran/go-time"
 	yaml "gopkg.in/yaml.v3"
+
+	"github.com/runityru/anycastd/announcer"
 )
 
-var isCIDR = validation.NewStringRuleWithError(govalidator.IsCIDR, validation.NewError("validation_is_cidr", "must be a valid CIDR"))
+var (
+	// birdSymbolRe matches unquoted BIRD symbol names
+	birdSymbolRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	isBIRDSymbol = validation.NewStringRuleWithError(func(in string) bool {
+		return birdSymbolRe.MatchString(in)
+	}, validation.NewError("validation_is_bird_symbol", "must be a valid BIRD symbol name"))
+
+	isCIDR = validation.NewStringRuleWithError(govalidator.IsCIDR, validation.NewError("validation_is_cidr", "must be a valid CIDR"))
+
+	isCommunity = validation.NewStringRuleWithError(func(in string) bool {
+		_, err := announcer.ParseCommunity(in)
+		return err == nil
+	}, validation.NewError("validation_is_community", "must be a valid community"))
+
+	isLargeCommunity = validation.NewStringRuleWithError(func(in string) bool {
+		_, err := announcer.ParseLargeCommunity(in)
+		return err == nil
+	}, validation.NewError("validation_is_large_community", "must be a valid large community"))
+
+	isExtendedCommunity = validation.NewStringRuleWithError(func(in string) bool {
+		_, err := announcer.ParseExtendedCommunity(in)
+		return err == nil
+	}, validation.NewError("validation_is_extended_community", "must be a valid extended community"))
+
+	isRouteDistinguisher = validation.NewStringRuleWithError(func(in string) bool {
+		_, err := announcer.ParseRouteDistinguisher(in)
+		return err == nil
+	}, validation.NewError("validation_is_route_distinguisher", "must be a valid route distinguisher"))
+
+	isRouteTarget = validation.NewStringRuleWithError(func(in string) bool {
+		_, err := announcer.ParseExtendedCommunity("rt:" + in)
+		return err == nil
+	}, validation.NewError("validation_is_route_target", "must be a valid route target"))
+
+	isIPOrCIDR = validation.NewStringRuleWithError(func(in string) bool {
+		return govalidator.IsIP(in) || govalidator.IsCIDR(in)
+	}, validation.NewError("validation_is_ip_or_cidr", "must be a valid IP address or CIDR"))
+
+	// isNotReserved ensures the name doesn't clash with the names of the
+	// defined sets and the policies generated by anycastd.
+	isNotReserved = validation.NewStringRuleWithError(func(in string) bool {
+		return !strings.HasPrefix(in, "anycastd-")
+	}, validation.NewError("validation_is_not_reserved", "must not start with `anycastd-`"))
+)
 
 var (
 	_ validation.Validatable = (*Config)(nil)
 	_ validation.Validatable = (*Announcer)(nil)
+	_ validation.Validatable = (*Route)(nil)
+	_ validation.Validatable = (*CommunityAttributes)(nil)
 	_ validation.Validatable = (*Service)(nil)
 	_ validation.Validatable = (*Metrics)(nil)
 	_ validation.Validatable = (*Check)(nil)
+	_ validation.Validatable = (*Degraded)(nil)
+	_ validation.Validatable = (*DynamicMED)(nil)
 	_ validation.Validatable = (*Peer)(nil)
+	_ validation.Validatable = (*PeerGroup)(nil)
+	_ validation.Validatable = (*Listener)(nil)
+	_ validation.Validatable = (*DynamicNeighbor)(nil)
+	_ validation.Validatable = (*DefinedSets)(nil)
+	_ validation.Validatable = (*PrefixSet)(nil)
+	_ validation.Validatable = (*PolicyPrefix)(nil)
+	_ validation.Validatable = (*NeighborSet)(nil)
+	_ validation.Validatable = (*CommunitySet)(nil)
+	_ validation.Validatable = (*Policy)(nil)
+	_ validation.Validatable = (*Statement)(nil)
+	_ validation.Validatable = (*PolicyActions)(nil)
+	_ validation.Validatable = (*VRF)(nil)
+	_ validation.Validatable = (*BMP)(nil)
+	_ validation.Validatable = (*BMPStation)(nil)
+	_ validation.Validatable = (*MRT)(nil)
+	_ validation.Validatable = (*MRTDump)(nil)
+	_ validation.Validatable = (*Kernel)(nil)
+	_ validation.Validatable = (*BIRD)(nil)
+	_ validation.Validatable = (*BFD)(nil)
+	_ validation.Validatable = (*GracefulRestart)(nil)
+	_ validation.Validatable = (*LongLivedGracefulRestart)(nil)
 )
 
+// CommunityAttributes are BGP communities attached to the announced routes.
+type CommunityAttributes struct {
+	Communities         []string `json:"communities"`
+	LargeCommunities    []string `json:"large_communities"`
+	ExtendedCommunities []string `json:"extended_communities"`
+}
+
+func (c CommunityAttributes) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Communities, validation.Each(isCommunity)),
+		validation.Field(&c.LargeCommunities, validation.Each(isLargeCommunity)),
+		validation.Field(&c.ExtendedCommunities, validation.Each(isExtendedCommunity)),
+	)
+}
+
+// merge returns union of the communities preserving the order they're set.
+func (c CommunityAttributes) merge(in CommunityAttributes) CommunityAttributes {
+	return CommunityAttributes{
+		Communities:         appendUnique(slices.Clone(c.Communities), in.Communities...),
+		LargeCommunities:    appendUnique(slices.Clone(c.LargeCommunities), in.LargeCommunities...),
+		ExtendedCommunities: appendUnique(slices.Clone(c.ExtendedCommunities), in.ExtendedCommunities...),
+	}
+}
+
+// Route is a prefix to announce. Could be set either as CIDR string or as an
+// object with the prefix and route-specific attributes.
+type Route struct {
+	CommunityAttributes
+
+	Prefix string `json:"prefix"`
+}
+
+func (r *Route) UnmarshalJSON(data []byte) error {
+	var prefix string
+	if err := json.Unmarshal(data, &prefix); err == nil {
+		*r = Route{Prefix: prefix}
+		return nil
+	}
+
+	type route Route
+	return json.Unmarshal(data, (*route)(r))
+}
+
+func (r Route) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.CommunityAttributes),
+		validation.Field(&r.Prefix, validation.Required, isCIDR),
+	)
+}
+
 type Announcer struct {
-	RouterID     string   `json:"router_id"`
-	LocalAddress string   `json:"local_address"`
-	LocalASN     uint32   `json:"local_asn"`
-	Routes       []string `json:"routes"`
-	Peers        []Peer   `json:"peers"`
+	CommunityAttributes
+
+	RouterID           string  `json:"router_id"`
+	LocalAddress       string  `json:"local_address"`
+	LocalAddressIPv6   string  `json:"local_address_ipv6"`
+	LocalASN           uint32  `json:"local_asn"`
+	Routes             []Route `json:"routes"`
+	SharedRoutesPolicy string  `json:"shared_routes_policy"`
+	Peers              []Peer  `json:"peers"`
+
+	PeerGroups       []PeerGroup       `json:"peer_groups"`
+	Listener         Listener          `json:"listener"`
+	DynamicNeighbors []DynamicNeighbor `json:"dynamic_neighbors"`
+	DefinedSets      DefinedSets       `json:"defined_sets"`
+	Policies         []Policy          `json:"policies"`
+	VRFs             []VRF             `json:"vrfs"`
+
+	GracefulRestart    GracefulRestart `json:"graceful_restart"`
+	ShutdownDrainDelay th.Duration     `json:"shutdown_drain_delay"`
+	ReconcileInterval  th.Duration     `json:"reconcile_interval"`
 }
 
 func (a Announcer) Validate() error {
 	return validation.ValidateStruct(&a,
 		validation.Field(&a.RouterID, validation.Required, is.IPv4),
-		validation.Field(&a.LocalAddress, validation.Required, is.IPv4),
+		validation.Field(&a.LocalAddress, validation.Required, is.IP),
+		validation.Field(&a.LocalAddressIPv6, is.IPv6),
 		validation.Field(&a.LocalASN, validation.Required),
-		validation.Field(&a.Routes, validation.Required, validation.Each(isCIDR)),
-		validation.Field(&a.Peers, validation.Required),
+		validation.Field(&a.CommunityAttributes),
+		validation.Field(&a.Routes),
+		validation.Field(&a.SharedRoutesPolicy, validation.In("any", "all")),
+		validation.Field(&a.Peers, validation.Required, validation.By(uniqueNames(a.Peers, func(p Peer) string { return p.Name })), validation.By(a.validatePeerFamilies), validation.By(a.validatePeerGroupReferences)),
+		validation.Field(&a.PeerGroups, validation.By(uniqueNames(a.PeerGroups, func(g PeerGroup) string { return g.Name })), validation.By(a.validatePeerGroupPolicies)),
+		validation.Field(&a.Listener),
+		validation.Field(&a.DynamicNeighbors, validation.By(a.validateDynamicNeighbors)),
+		validation.Field(&a.DefinedSets),
+		validation.Field(&a.Policies, validation.By(uniqueNames(a.Policies, func(p Policy) string { return p.Name })), validation.By(a.validatePolicies)),
+		validation.Field(&a.VRFs, validation.By(uniqueNames(a.VRFs, func(v VRF) string { return v.Name })), validation.By(a.validateVRFDistinguishers)),
+		validation.Field(&a.GracefulRestart),
+	)
+}
+
+// LocalIPv4 returns local IPv4 address used as BGP session source and next
+// hop for IPv4 routes or empty string if there's no one.
+func (a Announcer) LocalIPv4() string {
+	if ip := net.ParseIP(a.LocalAddress); ip != nil && ip.To4() != nil {
+		return a.LocalAddress
+	}
+	return ""
+}
+
+// LocalIPv6 returns local IPv6 address used as BGP session source and next
+// hop for IPv6 routes or empty string if there's no one.
+func (a Announcer) LocalIPv6() string {
+	if a.LocalAddressIPv6 != "" {
+		return a.LocalAddressIPv6
+	}
+	if ip := net.ParseIP(a.LocalAddress); ip != nil && ip.To4() == nil {
+		return a.LocalAddress
+	}
+	return ""
+}
+
+// LocalAddressFor returns local address of the same address family as addr.
+func (a Announcer) LocalAddressFor(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+
+	if ip.To4() != nil {
+		return a.LocalIPv4()
+	}
+	return a.LocalIPv6()
+}
+
+// ExtendedNextHop tells whether IPv4 routes could be announced over IPv6
+// next hop (RFC 5549) which is the case when there are interface peers.
+func (a Announcer) ExtendedNextHop() bool {
+	for _, peer := range a.Peers {
+		if peer.Interface != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Announcer) validatePeerFamilies(any) error {
+	for _, peer := range a.Peers {
+		if net.ParseIP(peer.RemoteAddress) == nil {
+			// address format is validated by the peer rules, interface
+			// peers are connected over IPv6 link-local addresses
+			continue
+		}
+
+		if a.LocalAddressFor(peer.RemoteAddress) == "" {
+			return errors.Errorf("peer `%s`: no local address of the same address family is configured", peer.Name)
+		}
+	}
+	return nil
+}
+
+// ResolvedPeers returns the peers with the settings not set on the peer
+// itself taken from its peer group.
+func (a Announcer) ResolvedPeers() []Peer {
+	out := make([]Peer, 0, len(a.Peers))
+	for _, peer := range a.Peers {
+		if group, ok := a.peerGroup(peer.PeerGroup); ok {
+			peer = group.apply(peer)
+		}
+		out = append(out, peer)
+	}
+	return out
+}
+
+// DynamicPeerGroups returns the peer groups the dynamic neighbors get their
+// settings from. Peers referencing the groups are resolved by ResolvedPeers
+// so only these groups are needed in GoBGP.
+func (a Announcer) DynamicPeerGroups() []PeerGroup {
+	out := []PeerGroup{}
+	for _, group := range a.PeerGroups {
+		if slices.ContainsFunc(a.DynamicNeighbors, func(n DynamicNeighbor) bool { return n.PeerGroup == group.Name }) {
+			out = append(out, group)
+		}
+	}
+	return out
+}
+
+func (a Announcer) peerGroup(name string) (PeerGroup, bool) {
+	for _, group := range a.PeerGroups {
+		if name != "" && group.Name == name {
+			return group, true
+		}
+	}
+	return PeerGroup{}, false
+}
+
+// validatePeerGroupReferences ensures the referenced peer groups exist and
+// the peers are still valid with the settings taken from the groups.
+func (a Announcer) validatePeerGroupReferences(any) error {
+	for _, peer := range a.Peers {
+		if peer.PeerGroup == "" {
+			continue
+		}
+
+		group, ok := a.peerGroup(peer.PeerGroup)
+		if !ok {
+			return errors.Errorf("peer `%s`: peer group `%s` is not defined", peer.Name, peer.PeerGroup)
+		}
+
+		resolved := group.apply(peer)
+		resolved.PeerGroup = ""
+		if err := resolved.Validate(); err != nil {
+			return errors.Errorf("peer `%s`: %s", peer.Name, strings.TrimSuffix(err.Error(), "."))
+		}
+	}
+	return nil
+}
+
+// validatePeerGroupPolicies ensures the policies of the peer groups are
+// defined and could be limited to the group members by the neighbor set.
+func (a Announcer) validatePeerGroupPolicies(any) error {
+	for _, group := range a.PeerGroups {
+		for _, name := range group.Policies {
+			idx := slices.IndexFunc(a.Policies, func(p Policy) bool { return p.Name == name })
+			if idx < 0 {
+				return errors.Errorf("peer group `%s`: policy `%s` is not defined", group.Name, name)
+			}
+
+			for i, st := range a.Policies[idx].Statements {
+				if st.Conditions.NeighborSet != nil {
+					return errors.Errorf("peer group `%s`: policy `%s` statement %d: neighbor set is not supported for peer group policies", group.Name, name, i)
+				}
+			}
+		}
+
+		if len(group.Policies) == 0 {
+			continue
+		}
+
+		for _, peer := range a.Peers {
+			if peer.PeerGroup == group.Name && peer.Interface != "" {
+				return errors.Errorf("peer group `%s` has interface peer `%s`, policies are not supported for interface peers", group.Name, peer.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// PeerGroupNeighbors returns addresses of the members of the peer group and
+// the prefixes of its dynamic neighbors.
+func (a Announcer) PeerGroupNeighbors(name string) []string {
+	out := []string{}
+	for _, peer := range a.Peers {
+		if peer.PeerGroup == name && peer.Interface == "" {
+			out = append(out, peer.RemoteAddress)
+		}
+	}
+
+	for _, n := range a.DynamicNeighbors {
+		if n.PeerGroup == name {
+			out = append(out, n.Prefix)
+		}
+	}
+	return out
+}
+
+// validateDynamicNeighbors ensures the sessions from the dynamic neighbors
+// could be accepted and get their settings from the existing peer groups.
+func (a Announcer) validateDynamicNeighbors(any) error {
+	if len(a.DynamicNeighbors) > 0 && !a.Listener.Enabled {
+		return errors.New("listener must be enabled to accept sessions from dynamic neighbors")
+	}
+
+	for _, n := range a.DynamicNeighbors {
+		if n.PeerGroup == "" {
+			// required fields are validated by the dynamic neighbor rules
+			continue
+		}
+
+		group, ok := a.peerGroup(n.PeerGroup)
+		if !ok {
+			return errors.Errorf("dynamic neighbor `%s`: peer group `%s` is not defined", n.Prefix, n.PeerGroup)
+		}
+
+		if group.RemoteASN == 0 {
+			return errors.Errorf("dynamic neighbor `%s`: peer group `%s` has no remote_asn", n.Prefix, n.PeerGroup)
+		}
+	}
+	return nil
+}
+
+// ListenAddresses returns the addresses to accept BGP sessions on.
+func (a Announcer) ListenAddresses() []string {
+	if len(a.Listener.Addresses) > 0 {
+		return a.Listener.Addresses
+	}
+
+	out := []string{}
+	for _, addr := range []string{a.LocalIPv4(), a.LocalIPv6()} {
+		if addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// Listener makes anycastd accept BGP sessions from the routers. Local
+// addresses and the default BGP port are used unless set explicitly.
+type Listener struct {
+	Enabled   bool     `json:"enabled"`
+	Port      uint32   `json:"port"`
+	Addresses []string `json:"addresses"`
+}
+
+func (l Listener) Validate() error {
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.Port, validation.Max(uint32(65535))),
+		validation.Field(&l.Addresses, validation.Each(is.IP)),
+	)
+}
+
+// DynamicNeighbor accepts BGP sessions from any router of the prefix with
+// the settings of the peer group.
+type DynamicNeighbor struct {
+	Prefix    string `json:"prefix"`
+	PeerGroup string `json:"peer_group"`
+}
+
+func (d DynamicNeighbor) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Prefix, validation.Required, isCIDR),
+		validation.Field(&d.PeerGroup, validation.Required),
+	)
+}
+
+// validatePolicies ensures the policy conditions reference the defined sets
+// of the appropriate types.
+func (a Announcer) validatePolicies(any) error {
+	for _, policy := range a.Policies {
+		for i, st := range policy.Statements {
+			c := st.Conditions
+			if c.PrefixSet != nil && !slices.ContainsFunc(a.DefinedSets.PrefixSets, func(s PrefixSet) bool { return s.Name == c.PrefixSet.Name }) {
+				return errors.Errorf("policy `%s` statement %d: prefix set `%s` is not defined", policy.Name, i, c.PrefixSet.Name)
+			}
+			if c.NeighborSet != nil && !slices.ContainsFunc(a.DefinedSets.NeighborSets, func(s NeighborSet) bool { return s.Name == c.NeighborSet.Name }) {
+				return errors.Errorf("policy `%s` statement %d: neighbor set `%s` is not defined", policy.Name, i, c.NeighborSet.Name)
+			}
+			if c.CommunitySet != nil && !slices.ContainsFunc(a.DefinedSets.CommunitySets, func(s CommunitySet) bool { return s.Name == c.CommunitySet.Name }) {
+				return errors.Errorf("policy `%s` statement %d: community set `%s` is not defined", policy.Name, i, c.CommunitySet.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// DefinedSets are the named sets of prefixes, neighbors and communities the
+// policy conditions refer to.
+type DefinedSets struct {
+	PrefixSets    []PrefixSet    `json:"prefix_sets"`
+	NeighborSets  []NeighborSet  `json:"neighbor_sets"`
+	CommunitySets []CommunitySet `json:"community_sets"`
+}
+
+func (d DefinedSets) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.PrefixSets, validation.By(uniqueNames(d.PrefixSets, func(s PrefixSet) string { return s.Name }))),
+		validation.Field(&d.NeighborSets, validation.By(uniqueNames(d.NeighborSets, func(s NeighborSet) string { return s.Name }))),
+		validation.Field(&d.CommunitySets, validation.By(uniqueNames(d.CommunitySets, func(s CommunitySet) string { return s.Name }))),
+	)
+}
+
+// PrefixSet is the set of prefixes of the same address family.
+type PrefixSet struct {
+	Name     string         `json:"name"`
+	Prefixes []PolicyPrefix `json:"prefixes"`
+}
+
+func (p PrefixSet) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required, isNotReserved),
+		validation.Field(&p.Prefixes, validation.Required, validation.By(func(any) error {
+			families := map[bool]struct{}{}
+			for _, prefix := range p.Prefixes {
+				if ip, _, err := net.ParseCIDR(prefix.Prefix); err == nil {
+					families[ip.To4() != nil] = struct{}{}
+				}
+			}
+			if len(families) > 1 {
+				return errors.New("must not mix IPv4 and IPv6 prefixes")
+			}
+			return nil
+		})),
+	)
+}
+
+// PolicyPrefix matches the prefix with the mask length in the range. Could be
+// set either as CIDR string matching the exact prefix or as an object.
+type PolicyPrefix struct {
+	Prefix        string `json:"prefix"`
+	MaskLengthMin uint32 `json:"mask_length_min"`
+	MaskLengthMax uint32 `json:"mask_length_max"`
+}
+
+func (p *PolicyPrefix) UnmarshalJSON(data []byte) error {
+	var prefix string
+	if err := json.Unmarshal(data, &prefix); err == nil {
+		*p = PolicyPrefix{Prefix: prefix}
+		return nil
+	}
+
+	type policyPrefix PolicyPrefix
+	return json.Unmarshal(data, (*policyPrefix)(p))
+}
+
+func (p PolicyPrefix) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Prefix, validation.Required, isCIDR),
+		validation.Field(&p.MaskLengthMin, validation.Max(uint32(128))),
+		validation.Field(&p.MaskLengthMax, validation.Max(uint32(128)), validation.When(p.MaskLengthMax != 0, validation.Min(p.MaskLengthMin).Error("must be no less than mask_length_min"))),
+	)
+}
+
+// NeighborSet is the set of neighbor addresses and prefixes.
+type NeighborSet struct {
+	Name      string   `json:"name"`
+	Neighbors []string `json:"neighbors"`
+}
+
+func (n NeighborSet) Validate() error {
+	return validation.ValidateStruct(&n,
+		validation.Field(&n.Name, validation.Required, isNotReserved),
+		validation.Field(&n.Neighbors, validation.Required, validation.Each(isIPOrCIDR)),
+	)
+}
+
+// CommunitySet is the set of BGP communities.
+type CommunitySet struct {
+	Name        string   `json:"name"`
+	Communities []string `json:"communities"`
+}
+
+func (c CommunitySet) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Name, validation.Required, isNotReserved),
+		validation.Field(&c.Communities, validation.Required, validation.Each(isCommunity)),
+	)
+}
+
+// Policy is the list of statements evaluated in order against the exported
+// routes.
+type Policy struct {
+	Name       string      `json:"name"`
+	Statements []Statement `json:"statements"`
+}
+
+func (p Policy) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required, isNotReserved),
+		validation.Field(&p.Statements, validation.Required),
+	)
+}
+
+// Statement applies the actions to the routes matching all of the
+// conditions. Statement without conditions matches every route.
+type Statement struct {
+	Conditions PolicyConditions `json:"conditions"`
+	Actions    PolicyActions    `json:"actions"`
+}
+
+func (s Statement) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Conditions),
+		validation.Field(&s.Actions),
+	)
+}
+
+// PolicyConditions refer to the defined sets the route must match.
+type PolicyConditions struct {
+	PrefixSet    *MatchSet `json:"prefix_set"`
+	NeighborSet  *MatchSet `json:"neighbor_set"`
+	CommunitySet *MatchSet `json:"community_set"`
+}
+
+func (c PolicyConditions) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.PrefixSet, validation.By(matchSetRule("any", "invert"))),
+		validation.Field(&c.NeighborSet, validation.By(matchSetRule("any", "invert"))),
+		validation.Field(&c.CommunitySet, validation.By(matchSetRule("any", "all", "invert"))),
+	)
+}
+
+// MatchSet refers to the defined set by name. Match is `any` by default,
+// `invert` matches the routes not in the set and `all` (community sets only)
+// requires all of the set communities on the route. Could be set either as
+// the set name or as an object.
+type MatchSet struct {
+	Name  string `json:"name"`
+	Match string `json:"match"`
+}
+
+func (m *MatchSet) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*m = MatchSet{Name: name}
+		return nil
+	}
+
+	type matchSet MatchSet
+	return json.Unmarshal(data, (*matchSet)(m))
+}
+
+func matchSetRule(matches ...any) func(any) error {
+	return func(v any) error {
+		m, ok := v.(*MatchSet)
+		if !ok {
+			return errors.Errorf("unexpected type: %T", v)
+		}
+
+		if m == nil {
+			return nil
+		}
+
+		return validation.ValidateStruct(m,
+			validation.Field(&m.Name, validation.Required),
+			validation.Field(&m.Match, validation.In(matches...)),
+		)
+	}
+}
+
+// PolicyActions modify or reject the matching routes. Evaluation continues
+// with the next statement unless the route is rejected.
+type PolicyActions struct {
+	MED              *uint32  `json:"med"`
+	ASPathPrepend    uint32   `json:"as_path_prepend"`
+	Communities      []string `json:"communities"`
+	LargeCommunities []string `json:"large_communities"`
+	Reject           bool     `json:"reject"`
+}
+
+func (p PolicyActions) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.ASPathPrepend, validation.Max(uint32(32))),
+		validation.Field(&p.Communities, validation.Each(isCommunity)),
+		validation.Field(&p.LargeCommunities, validation.Each(isLargeCommunity)),
+	)
+}
+
+func uniqueNames[T any](items []T, name func(T) string) func(any) error {
+	return func(any) error {
+		seen := map[string]struct{}{}
+		for _, item := range items {
+			if _, ok := seen[name(item)]; ok {
+				return errors.Errorf("`%s` is defined more than once", name(item))
+			}
+			seen[name(item)] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// VRF defines the VRF the service routes could be announced into.
+type VRF struct {
+	Name      string   `json:"name"`
+	RD        string   `json:"rd"`
+	ImportRTs []string `json:"import_rts"`
+	ExportRTs []string `json:"export_rts"`
+	Label     uint32   `json:"label"`
+	Family    string   `json:"family"`
+}
+
+func (v VRF) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Name, validation.Required),
+		validation.Field(&v.RD, validation.Required, isRouteDistinguisher),
+		validation.Field(&v.ImportRTs, validation.Each(isRouteTarget)),
+		validation.Field(&v.ExportRTs, validation.Required, validation.Each(isRouteTarget)),
+		validation.Field(&v.Label, validation.Max(uint32(1<<20-1))),
+		validation.Field(&v.Family, validation.In("vpn", "evpn")),
+	)
+}
+
+// EVPN tells whether the routes are announced as EVPN IP prefix routes
+// rather than VPN routes.
+func (v VRF) EVPN() bool {
+	return v.Family == "evpn"
+}
+
+func (a Announcer) vrf(name string) (VRF, bool) {
+	for _, v := range a.VRFs {
+		if name != "" && v.Name == name {
+			return v, true
+		}
+	}
+	return VRF{}, false
+}
+
+func (a Announcer) validateVRFDistinguishers(any) error {
+	seen := map[string]string{}
+	for _, v := range a.VRFs {
+		if other, ok := seen[v.RD]; ok {
+			return errors.Errorf("vrf `%s`: route distinguisher `%s` is already used by vrf `%s`", v.Name, v.RD, other)
+		}
+		seen[v.RD] = v.Name
+	}
+	return nil
+}
+
+// GracefulRestart enables BGP graceful restart (RFC 4724) so the peers keep
+// the announced routes while anycastd is restarting. Zero restart time is
+// set by GoBGP to the hold time.
+type GracefulRestart struct {
+	Enabled     bool                     `json:"enabled"`
+	RestartTime th.Duration              `json:"restart_time"`
+	LongLived   LongLivedGracefulRestart `json:"long_lived"`
+}
+
+func (g GracefulRestart) Validate() error {
+	return validation.ValidateStruct(&g,
+		validation.Field(&g.RestartTime, validation.By(isWholeSeconds), validation.Max(th.Duration(4095*time.Second)).Error("must be no greater than 4095s")),
+		validation.Field(&g.LongLived, validation.By(func(any) error {
+			if g.LongLived.Enabled && !g.Enabled {
+				return errors.New("requires graceful restart to be enabled")
+			}
+			return nil
+		})),
+	)
+}
+
+// LongLivedGracefulRestart enables long-lived graceful restart
+// (RFC 9494) keeping the routes as stale ones for the restart time after
+// the regular graceful restart timer expires.
+type LongLivedGracefulRestart struct {
+	Enabled     bool        `json:"enabled"`
+	RestartTime th.Duration `json:"restart_time"`
+}
+
+func (l LongLivedGracefulRestart) Validate() error {
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.RestartTime, validation.When(l.Enabled, validation.Required), validation.By(isWholeSeconds), validation.Max(th.Duration(16777215*time.Second)).Error("must be no greater than 16777215s")),
 	)
 }
 
 type Check struct {
-	Kind  string          `json:"kind"`
-	Spec  json.RawMessage `json:"spec"`
-	Group string          `json:"group"`
+	Kind      string          `json:"kind"`
+	Spec      json.RawMessage `json:"spec"`
+	Group     string          `json:"group"`
+	OnFailure string          `json:"on_failure"`
 }
 
 func (c Check) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.Kind, validation.Required),
 		validation.Field(&c.Spec, validation.Required),
+		validation.Field(&c.OnFailure, validation.In("withdraw", "degrade")),
+	)
+}
+
+// Degraded defines attributes making the service routes less preferred while
+// the service is degraded.
+type Degraded struct {
+	ASPathPrepend    uint32   `json:"as_path_prepend"`
+	MED              uint32   `json:"med"`
+	Communities      []string `json:"communities"`
+	LargeCommunities []string `json:"large_communities"`
+}
+
+func (d Degraded) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.ASPathPrepend, validation.Max(uint32(32))),
+		validation.Field(&d.Communities, validation.Each(isCommunity)),
+		validation.Field(&d.LargeCommunities, validation.Each(isLargeCommunity)),
 	)
 }
 
+// DefaultPeerFamilies is the list of address families enabled on the peer
+// when no families are set explicitly.
+var DefaultPeerFamilies = []string{"ipv4-unicast", "ipv6-unicast"}
+
+// peerFamilies is the list of address families could be enabled on the peer.
+var peerFamilies = []any{"ipv4-unicast", "ipv6-unicast", "ipv4-vpn", "ipv6-vpn", "l2vpn-evpn"}
+
 type Peer struct {
-	Name           string `json:"name"`
-	RemoteAddress  string `json:"remote_address"`
-	RemoteASN      uint32 `json:"remote_asn"`
-	EnableMultihop bool   `json:"enable_multihop"`
-	MultihopTTL    uint32 `json:"multihop_ttl"`
+	Name           string   `json:"name"`
+	PeerGroup      string   `json:"peer_group"`
+	RemoteAddress  string   `json:"remote_address"`
+	Interface      string   `json:"interface"`
+	RemoteASN      uint32   `json:"remote_asn"`
+	LocalAS        uint32   `json:"local_as"`
+	NextHop        string   `json:"next_hop"`
+	EnableMultihop *bool    `json:"enable_multihop"`
+	MultihopTTL    uint32   `json:"multihop_ttl"`
+	Families       []string `json:"families"`
+	Password       string   `json:"password"`
+	PasswordFile   string   `json:"password_file"`
+	PasswordEnv    string   `json:"password_env"`
+
+	HoldTime               th.Duration `json:"hold_time"`
+	KeepaliveInterval      th.Duration `json:"keepalive_interval"`
+	ConnectRetry           th.Duration `json:"connect_retry"`
+	IdleHoldTimeAfterReset th.Duration `json:"idle_hold_time_after_reset"`
+	PassiveMode            *bool       `json:"passive_mode"`
+	RemotePort             uint32      `json:"remote_port"`
+
+	BFD *BFD `json:"bfd"`
 }
 
 func (p Peer) Validate() error {
 	return validation.ValidateStruct(&p,
 		validation.Field(&p.Name, validation.Required),
-		validation.Field(&p.RemoteAddress, validation.Required, is.IPv4),
-		validation.Field(&p.RemoteASN, validation.Required),
-		validation.Field(&p.MultihopTTL, validation.When(p.EnableMultihop, validation.Min(uint32(1)))),
+		validation.Field(&p.RemoteAddress, validation.When(p.Interface == "", validation.Required), validation.When(p.Interface != "", validation.Empty.Error("must be blank when interface is set")), is.IP),
+		validation.Field(&p.RemoteASN, validation.When(p.PeerGroup == "", validation.Required)),
+		validation.Field(&p.NextHop, validation.When(p.Interface != "", validation.Empty.Error("is not supported for interface peers")), validation.When(p.vpnFamilies(), validation.Empty.Error("is not supported for VPN and EVPN families")), is.IP),
+		validation.Field(&p.EnableMultihop, validation.When(p.Interface != "", validation.Empty.Error("is not supported for interface peers"))),
+		validation.Field(&p.MultihopTTL, validation.When(p.MultihopEnabled(), validation.Min(uint32(1)))),
+		validation.Field(&p.Families, validation.Each(validation.In(peerFamilies...))),
+		validation.Field(&p.PasswordFile, validation.When(p.Password != "", validation.Empty.Error("must be blank when password is set"))),
+		validation.Field(&p.PasswordEnv, validation.When(p.Password != "" || p.PasswordFile != "", validation.Empty.Error("must be blank when password or password_file is set"))),
+		validation.Field(&p.HoldTime, validation.By(isWholeSeconds), validation.When(p.HoldTime != 0, validation.Min(th.Duration(3*time.Second)).Error("must be no less than 3s"))),
+		validation.Field(&p.KeepaliveInterval, validation.By(isWholeSeconds), validation.When(p.HoldTime != 0 && p.KeepaliveInterval != 0, validation.Max(p.HoldTime).Exclusive().Error("must be less than hold_time"))),
+		validation.Field(&p.ConnectRetry, validation.By(isWholeSeconds)),
+		validation.Field(&p.IdleHoldTimeAfterReset, validation.By(isWholeSeconds)),
+		validation.Field(&p.PassiveMode, validation.When(p.Interface != "", validation.Empty.Error("is not supported for interface peers"))),
+		validation.Field(&p.RemotePort, validation.Max(uint32(65535))),
+		validation.Field(&p.BFD, validation.When(p.MultihopEnabled(), validation.Nil.Error("is not supported for multihop peers")), validation.When(p.Interface != "", validation.Nil.Error("is not supported for interface peers"))),
+	)
+}
+
+// AuthPassword returns TCP MD5 password for the peer read from the
+// configuration, the file or the environment variable whichever is set.
+func (p Peer) AuthPassword() (string, error) {
+	return authPassword("peer", p.Name, p.Password, p.PasswordFile, p.PasswordEnv)
+}
+
+// MultihopEnabled tells whether eBGP multihop is enabled on the peer.
+func (p Peer) MultihopEnabled() bool {
+	return p.EnableMultihop != nil && *p.EnableMultihop
+}
+
+// PassiveModeEnabled tells whether anycastd waits for the peer to connect.
+func (p Peer) PassiveModeEnabled() bool {
+	return p.PassiveMode != nil && *p.PassiveMode
+}
+
+// EnabledFamilies returns address families to enable on the peer.
+func (p Peer) EnabledFamilies() []string {
+	return enabledFamilies(p.Families)
+}
+
+// vpnFamilies tells whether VPN or EVPN families are enabled on the peer,
+// next hop export policy matches unicast routes only.
+func (p Peer) vpnFamilies() bool {
+	return slices.ContainsFunc(p.EnabledFamilies(), func(f string) bool {
+		return f != "ipv4-unicast" && f != "ipv6-unicast"
+	})
+}
+
+// PeerGroup defines the settings shared by the peers referencing the group.
+// Settings set on the peer itself take precedence over the group ones.
+type PeerGroup struct {
+	Name           string   `json:"name"`
+	RemoteASN      uint32   `json:"remote_asn"`
+	EnableMultihop bool     `json:"enable_multihop"`
+	MultihopTTL    uint32   `json:"multihop_ttl"`
+	Families       []string `json:"families"`
+	Password       string   `json:"password"`
+	PasswordFile   string   `json:"password_file"`
+	PasswordEnv    string   `json:"password_env"`
+
+	HoldTime               th.Duration `json:"hold_time"`
+	KeepaliveInterval      th.Duration `json:"keepalive_interval"`
+	ConnectRetry           th.Duration `json:"connect_retry"`
+	IdleHoldTimeAfterReset th.Duration `json:"idle_hold_time_after_reset"`
+	PassiveMode            bool        `json:"passive_mode"`
+	RemotePort             uint32      `json:"remote_port"`
+
+	// Policies are the names of announcer policies applied to the routes
+	// announced to the members of the group only.
+	Policies []string `json:"policies"`
+}
+
+func (g PeerGroup) Validate() error {
+	return validation.ValidateStruct(&g,
+		validation.Field(&g.Name, validation.Required),
+		validation.Field(&g.MultihopTTL, validation.When(g.EnableMultihop, validation.Min(uint32(1)))),
+		validation.Field(&g.Families, validation.Each(validation.In(peerFamilies...))),
+		validation.Field(&g.PasswordFile, validation.When(g.Password != "", validation.Empty.Error("must be blank when password is set"))),
+		validation.Field(&g.PasswordEnv, validation.When(g.Password != "" || g.PasswordFile != "", validation.Empty.Error("must be blank when password or password_file is set"))),
+		validation.Field(&g.HoldTime, validation.By(isWholeSeconds), validation.When(g.HoldTime != 0, validation.Min(th.Duration(3*time.Second)).Error("must be no less than 3s"))),
+		validation.Field(&g.KeepaliveInterval, validation.By(isWholeSeconds), validation.When(g.HoldTime != 0 && g.KeepaliveInterval != 0, validation.Max(g.HoldTime).Exclusive().Error("must be less than hold_time"))),
+		validation.Field(&g.ConnectRetry, validation.By(isWholeSeconds)),
+		validation.Field(&g.IdleHoldTimeAfterReset, validation.By(isWholeSeconds)),
+		validation.Field(&g.RemotePort, validation.Max(uint32(65535))),
+	)
+}
+
+// AuthPassword returns TCP MD5 password for the peer group read from the
+// configuration, the file or the environment variable whichever is set.
+func (g PeerGroup) AuthPassword() (string, error) {
+	return authPassword("peer group", g.Name, g.Password, g.PasswordFile, g.PasswordEnv)
+}
+
+// EnabledFamilies returns address families to enable on the peer group.
+func (g PeerGroup) EnabledFamilies() []string {
+	return enabledFamilies(g.Families)
+}
+
+// apply returns the peer with the settings not set on the peer taken from
+// the group. Password is taken from the group only if the peer has no
+// password source at all.
+func (g PeerGroup) apply(p Peer) Peer {
+	if p.RemoteASN == 0 {
+		p.RemoteASN = g.RemoteASN
+	}
+	if p.EnableMultihop == nil && g.EnableMultihop {
+		p.EnableMultihop = &g.EnableMultihop
+	}
+	if p.MultihopTTL == 0 {
+		p.MultihopTTL = g.MultihopTTL
+	}
+	if len(p.Families) == 0 {
+		p.Families = g.Families
+	}
+	if p.Password == "" && p.PasswordFile == "" && p.PasswordEnv == "" {
+		p.Password, p.PasswordFile, p.PasswordEnv = g.Password, g.PasswordFile, g.PasswordEnv
+	}
+	if p.HoldTime == 0 {
+		p.HoldTime = g.HoldTime
+	}
+	if p.KeepaliveInterval == 0 {
+		p.KeepaliveInterval = g.KeepaliveInterval
+	}
+	if p.ConnectRetry == 0 {
+		p.ConnectRetry = g.ConnectRetry
+	}
+	if p.IdleHoldTimeAfterReset == 0 {
+		p.IdleHoldTimeAfterReset = g.IdleHoldTimeAfterReset
+	}
+	if p.PassiveMode == nil && g.PassiveMode {
+		p.PassiveMode = &g.PassiveMode
+	}
+	if p.RemotePort == 0 {
+		p.RemotePort = g.RemotePort
+	}
+	return p
+}
+
+func authPassword(kind, name, password, passwordFile, passwordEnv string) (string, error) {
+	switch {
+	case passwordFile != "":
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading password file for %s `%s`", kind, name)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case passwordEnv != "":
+		v, ok := os.LookupEnv(passwordEnv)
+		if !ok {
+			return "", errors.Errorf("environment variable `%s` with password for %s `%s` is not set", passwordEnv, kind, name)
+		}
+		return v, nil
+	default:
+		return password, nil
+	}
+}
+
+func enabledFamilies(families []string) []string {
+	if len(families) > 0 {
+		return families
+	}
+	return DefaultPeerFamilies
+}
+
+// BFD defines single-hop BFD session to the peer. Zero values are set to
+// the defaults of the bfd package.
+type BFD struct {
+	DesiredMinTxInterval  th.Duration `json:"desired_min_tx_interval"`
+	RequiredMinRxInterval th.Duration `json:"required_min_rx_interval"`
+	DetectMultiplier      uint8       `json:"detect_multiplier"`
+	TeardownSession       bool        `json:"teardown_session"`
+}
+
+func (b BFD) Validate() error {
+	return validation.ValidateStruct(&b,
+		validation.Field(&b.DesiredMinTxInterval, validation.When(b.DesiredMinTxInterval != 0, validation.Min(th.Duration(10*time.Millisecond)).Error("must be no less than 10ms"))),
+		validation.Field(&b.RequiredMinRxInterval, validation.When(b.RequiredMinRxInterval != 0, validation.Min(th.Duration(10*time.Millisecond)).Error("must be no less than 10ms"))),
+	)
+}
+
+// MEDBucket sets MED for the measured check durations starting from Above.
+type MEDBucket struct {
+	Above th.Duration `json:"above"`
+	MED   uint32      `json:"med"`
+}
+
+// DynamicMED defines how MED of the service routes is computed from the
+// check duration.
+type DynamicMED struct {
+	Check      string      `json:"check"`
+	Hysteresis float64     `json:"hysteresis"`
+	Buckets    []MEDBucket `json:"buckets"`
+}
+
+func (d DynamicMED) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Hysteresis, validation.Min(0.0), validation.Max(0.9)),
+		validation.Field(&d.Buckets, validation.Required, validation.By(func(any) error {
+			for i := 1; i < len(d.Buckets); i++ {
+				if d.Buckets[i].Above <= d.Buckets[i-1].Above {
+					return errors.New("must be sorted by `above` in ascending order")
+				}
+			}
+			return nil
+		})),
 	)
 }
 
 type Service struct {
+	CommunityAttributes
+
 	Name            string          `json:"name"`
 	CheckInterval   th.Duration     `json:"check_interval"`
 	Strategy        string          `json:"strategy"`
 	StrategyOptions json.RawMessage `json:"strategy_options"`
 	Checks          []Check         `json:"checks"`
+	Routes          []Route         `json:"routes"`
+	Degraded        Degraded        `json:"degraded"`
+	DynamicMED      *DynamicMED     `json:"dynamic_med"`
+	Peers           []string        `json:"peers"`
+	PeerGroups      []string        `json:"peer_groups"`
+	VRF             string          `json:"vrf"`
+	Backend         string          `json:"backend"`
+	Kernel          *Kernel         `json:"kernel"`
+	BIRD            *BIRD           `json:"bird"`
 }
 
 func (s Service) Validate() error {
 	return validation.ValidateStruct(&s,
+		validation.Field(&s.CommunityAttributes),
 		validation.Field(&s.Name, validation.Required),
 		validation.Field(&s.CheckInterval, validation.Required),
 		validation.Field(&s.Checks, validation.Required),
+		validation.Field(&s.Routes),
+		validation.Field(&s.Degraded),
+		validation.Field(&s.DynamicMED),
+		validation.Field(&s.Backend, validation.In(BackendBGP, BackendKernel, BackendBIRD, BackendExaBGP)),
+		validation.Field(&s.Kernel,
+			validation.When(s.Backend == BackendKernel, validation.Required),
+			validation.When(s.Backend != BackendKernel, validation.Nil.Error("is supported for kernel backend only")),
+		),
+		validation.Field(&s.BIRD,
+			validation.When(s.Backend == BackendBIRD, validation.Required),
+			validation.When(s.Backend != BackendBIRD, validation.Nil.Error("is supported for bird backend only")),
+		),
+	)
+}
+
+// BGP reports whether the service routes are announced via BGP.
+func (s Service) BGP() bool {
+	return s.Backend == "" || s.Backend == BackendBGP
+}
+
+const (
+	BackendBGP    = "bgp"
+	BackendKernel = "kernel"
+	BackendBIRD   = "bird"
+	BackendExaBGP = "exabgp"
+)
+
+// BIRD defines the protocols of BIRD instance enabled and disabled via its
+// control socket instead of announcing the service routes via BGP.
+type BIRD struct {
+	Socket           string      `json:"socket"`
+	Protocol         string      `json:"protocol"`
+	DegradedProtocol string      `json:"degraded_protocol"`
+	Timeout          th.Duration `json:"timeout"`
+}
+
+func (b BIRD) Validate() error {
+	return validation.ValidateStruct(&b,
+		validation.Field(&b.Protocol, validation.Required, isBIRDSymbol),
+		validation.Field(&b.DegradedProtocol, isBIRDSymbol, validation.NotIn(b.Protocol).Error("must differ from protocol")),
+	)
+}
+
+// ExaBGP defines the output of ExaBGP API commands announcing the routes of
+// the services with exabgp backend.
+type ExaBGP struct {
+	Pipe     string `json:"pipe"`
+	NextHop  string `json:"next_hop"`
+	LocalASN uint32 `json:"local_asn"`
+}
+
+func (e ExaBGP) Validate() error {
+	return validation.ValidateStruct(&e,
+		validation.Field(&e.NextHop, validation.When(e.NextHop != announcer.DefaultExaBGPNextHop, is.IP.Error("must be either `self` or a valid IP address"))),
+	)
+}
+
+// Kernel defines the kernel routes the service routes are installed as
+// instead of being announced via BGP.
+type Kernel struct {
+	Type           string `json:"type"`
+	Interface      string `json:"interface"`
+	Table          uint32 `json:"table"`
+	Protocol       uint32 `json:"protocol"`
+	Metric         uint32 `json:"metric"`
+	DegradedMetric uint32 `json:"degraded_metric"`
+}
+
+func (k Kernel) Validate() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.Type, validation.In(announcer.KernelRouteUnicast, announcer.KernelRouteBlackhole, announcer.KernelRouteLocal)),
+		validation.Field(&k.Interface,
+			validation.When(k.Type == "" || k.Type == announcer.KernelRouteUnicast, validation.Required),
+			validation.When(k.Type == announcer.KernelRouteBlackhole, validation.Empty.Error("must be blank for blackhole routes")),
+		),
+		validation.Field(&k.Table, validation.Max(uint32(1<<31-1))),
+		validation.Field(&k.Protocol,
+			validation.NotIn(uint32(1), uint32(2), uint32(3)).Error("must not be a reserved protocol"),
+			validation.NotIn(uint32(4)).Error("must not be static, the routes added by the administrator would be removed"),
+			validation.Max(uint32(255)),
+		),
+		validation.Field(&k.Metric, validation.Max(uint32(1<<31-1))),
+		validation.Field(&k.DegradedMetric, validation.Max(uint32(1<<31-1))),
+	)
+}
+
+// DefaultBMPPort is the port of the BMP station used when none is set.
+const DefaultBMPPort = 11019
+
+// BMP defines the BMP (RFC 7854) stations the BGP state is exported to.
+type BMP struct {
+	Stations []BMPStation `json:"stations"`
+}
+
+func (b BMP) Validate() error {
+	return validation.ValidateStruct(&b,
+		validation.Field(&b.Stations, validation.By(b.validateUniqueStations)),
+	)
+}
+
+func (b BMP) validateUniqueStations(any) error {
+	seen := map[string]bool{}
+	for _, st := range b.Stations {
+		port := st.Port
+		if port == 0 {
+			port = DefaultBMPPort
+		}
+
+		key := net.JoinHostPort(st.Address, strconv.FormatUint(uint64(port), 10))
+		if seen[key] {
+			return errors.Errorf("station `%s` is defined more than once", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// BMPStation is the BMP collector anycastd connects to. Policy selects the
+// RIBs the routes are monitored from: `pre` (Adj-RIB-In before the import
+// policy, default), `post` (Adj-RIB-In after the import policy), `both`,
+// `local` (Local RIB) or `all`.
+type BMPStation struct {
+	Address            string      `json:"address"`
+	Port               uint32      `json:"port"`
+	Policy             string      `json:"policy"`
+	StatisticsInterval th.Duration `json:"statistics_interval"`
+	SysName            string      `json:"sys_name"`
+}
+
+func (s BMPStation) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Address, validation.Required, is.Host),
+		validation.Field(&s.Port, validation.Max(uint32(65535))),
+		validation.Field(&s.Policy, validation.In("pre", "post", "both", "local", "all")),
+		validation.Field(&s.StatisticsInterval, validation.By(isWholeSeconds), validation.Max(th.Duration(65535*time.Second)).Error("must be no greater than 65535s")),
+	)
+}
+
+// MRT defines the MRT (RFC 6396) dumps written by GoBGP.
+type MRT struct {
+	Dumps []MRTDump `json:"dumps"`
+}
+
+func (m MRT) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Dumps, validation.By(uniqueNames(m.Dumps, func(d MRTDump) string { return d.FileName }))),
+	)
+}
+
+// MRTDump is a single MRT dump. Type is `updates` (BGP4MP messages) or
+// `table` (TABLE_DUMP_V2 snapshots of the global RIB), FileName is the Go
+// time layout the file name is formatted with on rotation. MaxSizeMB only
+// takes effect on the interval rotation since GoBGP can't reopen the file in
+// between, so RotationInterval is limited to bound the overgrowth.
+type MRTDump struct {
+	Type             string      `json:"type"`
+	FileName         string      `json:"file_name"`
+	DumpInterval     th.Duration `json:"dump_interval"`
+	RotationInterval th.Duration `json:"rotation_interval"`
+	MaxSizeMB        uint32      `json:"max_size_mb"`
+}
+
+func (d MRTDump) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Type, validation.Required, validation.In("updates", "table")),
+		validation.Field(&d.FileName, validation.Required),
+		validation.Field(&d.DumpInterval,
+			validation.By(isWholeSeconds),
+			validation.When(d.DumpInterval != 0, validation.Min(th.Duration(time.Minute)).Error("must be no less than 60s")),
+			validation.When(d.Type == "updates", validation.Empty.Error("is not supported for updates dumps")),
+		),
+		validation.Field(&d.RotationInterval,
+			validation.By(isWholeSeconds),
+			validation.When(d.RotationInterval != 0, validation.Min(th.Duration(time.Minute)).Error("must be no less than 60s")),
+			validation.When(d.Type == "table" && d.DumpInterval != 0, validation.Empty.Error("cannot be set together with dump_interval")),
+			validation.When(d.MaxSizeMB != 0, validation.Max(th.Duration(time.Hour)).Error("must be no greater than 1h with max_size_mb")),
+		),
+		validation.Field(&d.MaxSizeMB, validation.When(d.Type == "table", validation.Empty.Error("is supported for updates dumps only"))),
 	)
 }
 
@@ -104,17 +1230,270 @@ func (m Metrics) Validate() error {
 type Config struct {
 	Announcer Announcer `json:"announcer"`
 	Services  []Service `json:"services"`
+	ExaBGP    ExaBGP    `json:"exabgp"`
+	BMP       BMP       `json:"bmp"`
+	MRT       MRT       `json:"mrt"`
 	Metrics   Metrics   `json:"metrics"`
 }
 
 func (c *Config) Validate() error {
 	return validation.ValidateStruct(c,
-		validation.Field(&c.Announcer, validation.Required),
-		validation.Field(&c.Services, validation.Required),
+		validation.Field(&c.Announcer, validation.Skip.When(!c.BGPEnabled()), validation.Required),
+		validation.Field(&c.Services, validation.Required, validation.By(uniqueNames(c.Services, func(s Service) string { return s.Name })), validation.By(c.validateServiceRoutes), validation.By(c.validateServicePeers), validation.By(c.validateServiceVRFs), validation.By(c.validateServiceBackends)),
+		validation.Field(&c.ExaBGP, validation.By(c.validateExaBGP)),
+		validation.Field(&c.BMP),
+		validation.Field(&c.MRT),
 		validation.Field(&c.Metrics, validation.Required),
 	)
 }
 
+// ServiceRoutes returns the routes owned by the service: its own routes list
+// or the global announcer routes when the service doesn't define any.
+// Communities of each route are merged with the announcer-wide and
+// service-wide ones.
+func (c *Config) ServiceRoutes(s Service) []Route {
+	routes := s.Routes
+	if len(routes) == 0 {
+		routes = c.Announcer.Routes
+	}
+
+	out := make([]Route, 0, len(routes))
+	for _, route := range routes {
+		out = append(out, Route{
+			CommunityAttributes: c.Announcer.CommunityAttributes.
+				merge(s.CommunityAttributes).
+				merge(route.CommunityAttributes),
+			Prefix: route.Prefix,
+		})
+	}
+	return out
+}
+
+// validateServiceRoutes ensures every service owns at least one route and
+// doesn't list the same route twice. Routes shared between services are
+// allowed and handled according to the shared routes policy.
+func (c *Config) validateServiceRoutes(any) error {
+	for _, svc := range c.Services {
+		if svc.Backend == BackendBIRD {
+			// the routes are defined in BIRD configuration
+			continue
+		}
+
+		routes := c.ServiceRoutes(svc)
+		if len(routes) == 0 {
+			return errors.Errorf("service `%s` has no routes: neither service nor announcer routes are defined", svc.Name)
+		}
+
+		seen := map[string]struct{}{}
+		for _, route := range routes {
+			ip, ipNet, err := net.ParseCIDR(route.Prefix)
+			if err != nil {
+				// CIDR format is validated by the field rules
+				continue
+			}
+
+			nextHop := c.Announcer.LocalAddressFor(ip.String())
+			if nextHop == "" && ip.To4() != nil && c.Announcer.ExtendedNextHop() {
+				nextHop = c.Announcer.LocalIPv6()
+			}
+
+			if nextHop == "" && svc.BGP() {
+				return errors.Errorf("route `%s` of `%s` service: no local address of the same address family is configured", route.Prefix, svc.Name)
+			}
+
+			if _, ok := seen[ipNet.String()]; ok {
+				return errors.Errorf("route `%s` is listed more than once in `%s` service", route.Prefix, svc.Name)
+			}
+			seen[ipNet.String()] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// ServiceNeighbors returns addresses and prefixes of the peers the service
+// routes are announced to: the peers listed in the service, the members of
+// the listed peer groups and the dynamic neighbor ranges of the groups. Nil
+// is returned when the service doesn't limit the peers.
+func (c *Config) ServiceNeighbors(s Service) []string {
+	if len(s.Peers) == 0 && len(s.PeerGroups) == 0 {
+		return nil
+	}
+
+	out := []string{}
+	for _, peer := range c.Announcer.Peers {
+		if peer.Interface != "" {
+			// rejected by validation since the link-local address of
+			// the peer is not known in advance
+			continue
+		}
+
+		if slices.Contains(s.Peers, peer.Name) || (peer.PeerGroup != "" && slices.Contains(s.PeerGroups, peer.PeerGroup)) {
+			out = append(out, peer.RemoteAddress)
+		}
+	}
+
+	for _, n := range c.Announcer.DynamicNeighbors {
+		if slices.Contains(s.PeerGroups, n.PeerGroup) {
+			out = append(out, n.Prefix)
+		}
+	}
+	return out
+}
+
+// validateServicePeers ensures the peers and peer groups the services are
+// limited to are defined.
+func (c *Config) validateServicePeers(any) error {
+	for _, svc := range c.Services {
+		for _, name := range svc.Peers {
+			idx := slices.IndexFunc(c.Announcer.Peers, func(p Peer) bool { return p.Name == name })
+			if idx < 0 {
+				return errors.Errorf("service `%s`: peer `%s` is not defined", svc.Name, name)
+			}
+
+			if c.Announcer.Peers[idx].Interface != "" {
+				return errors.Errorf("service `%s`: peer `%s` is an interface peer, limiting routes to interface peers is not supported", svc.Name, name)
+			}
+		}
+
+		for _, name := range svc.PeerGroups {
+			if _, ok := c.Announcer.peerGroup(name); !ok {
+				return errors.Errorf("service `%s`: peer group `%s` is not defined", svc.Name, name)
+			}
+
+			for _, peer := range c.Announcer.Peers {
+				if peer.PeerGroup == name && peer.Interface != "" {
+					return errors.Errorf("service `%s`: peer group `%s` has interface peer `%s`, limiting routes to interface peers is not supported", svc.Name, name, peer.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// BGPEnabled reports whether BGP is used: unless every service installs its
+// routes via other backend. Announcer section is not used otherwise.
+func (c *Config) BGPEnabled() bool {
+	if len(c.Services) == 0 {
+		return true
+	}
+
+	for _, svc := range c.Services {
+		if svc.BGP() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExaBGP ensures local ASN is set if it's prepended to AS path of
+// the degraded routes announced by ExaBGP.
+func (c *Config) validateExaBGP(any) error {
+	if c.ExaBGP.LocalASN != 0 {
+		return nil
+	}
+
+	for _, svc := range c.Services {
+		if svc.Backend == BackendExaBGP && svc.Degraded.ASPathPrepend > 0 {
+			return errors.Errorf("local_asn is required for AS path prepend of `%s` service", svc.Name)
+		}
+	}
+	return nil
+}
+
+// validateServiceBackends ensures the services not announcing the routes via
+// BGP don't use BGP-only features and don't share the routes or BIRD
+// protocols since there's nothing to arbitrate them outside of BGP.
+func (c *Config) validateServiceBackends(any) error {
+	owners := map[string]string{}
+	protocols := map[string]string{}
+	for _, svc := range c.Services {
+		if svc.Backend == BackendBIRD && svc.BIRD != nil {
+			for _, p := range []string{svc.BIRD.Protocol, svc.BIRD.DegradedProtocol} {
+				if p == "" {
+					continue
+				}
+
+				if owner, ok := protocols[p]; ok && owner != svc.Name {
+					return errors.Errorf("BIRD protocol `%s` is controlled by `%s` and `%s` services", p, owner, svc.Name)
+				}
+				protocols[p] = svc.Name
+			}
+		}
+
+		if svc.Backend != BackendBIRD {
+			for _, route := range c.ServiceRoutes(svc) {
+				_, ipNet, err := net.ParseCIDR(route.Prefix)
+				if err != nil {
+					continue
+				}
+				key := ipNet.String()
+
+				if owner, ok := owners[key]; ok && (!svc.BGP() || !c.service(owner).BGP()) {
+					return errors.Errorf("route `%s` is owned by `%s` and `%s` services, sharing routes is supported for BGP backend only", route.Prefix, owner, svc.Name)
+				}
+				owners[key] = svc.Name
+			}
+		}
+
+		if svc.BGP() {
+			continue
+		}
+
+		switch {
+		case len(svc.Peers) > 0 || len(svc.PeerGroups) > 0:
+			return errors.Errorf("service `%s`: limiting routes to peers is not supported for %s backend", svc.Name, svc.Backend)
+		case svc.VRF != "":
+			return errors.Errorf("service `%s`: vrf is not supported for %s backend", svc.Name, svc.Backend)
+		case svc.DynamicMED != nil && svc.Backend != BackendExaBGP:
+			return errors.Errorf("service `%s`: dynamic MED is not supported for %s backend", svc.Name, svc.Backend)
+		}
+	}
+	return nil
+}
+
+func (c *Config) service(name string) Service {
+	for _, svc := range c.Services {
+		if svc.Name == name {
+			return svc
+		}
+	}
+	return Service{}
+}
+
+// ServiceVRF returns the VRF the service routes are announced into or nil if
+// they're announced into the global routing table.
+func (c *Config) ServiceVRF(s Service) *VRF {
+	if v, ok := c.Announcer.vrf(s.VRF); ok {
+		return &v
+	}
+	return nil
+}
+
+// validateServiceVRFs ensures the VRFs the services announce the routes
+// into are defined.
+func (c *Config) validateServiceVRFs(any) error {
+	for _, svc := range c.Services {
+		if svc.VRF == "" {
+			continue
+		}
+
+		v, ok := c.Announcer.vrf(svc.VRF)
+		if !ok {
+			return errors.Errorf("service `%s`: vrf `%s` is not defined", svc.Name, svc.VRF)
+		}
+
+		// prefix sets of GoBGP policies match unicast routes only
+		if len(svc.Peers) > 0 || len(svc.PeerGroups) > 0 {
+			kind := "VPN"
+			if v.EVPN() {
+				kind = "EVPN"
+			}
+			return errors.Errorf("service `%s`: limiting %s routes to peers is not supported", svc.Name, kind)
+		}
+	}
+	return nil
+}
+
 func NewFromFile(filename string) (*Config, error) {
 	cfg := &Config{}
 
@@ -130,6 +1509,9 @@ func NewFromFile(filename string) (*Config, error) {
 		type intermediate struct {
 			Announcer map[string]any `yaml:"announcer"`
 			Services  []any          `yaml:"services"`
+			ExaBGP    map[string]any `yaml:"exabgp"`
+			BMP       map[string]any `yaml:"bmp"`
+			MRT       map[string]any `yaml:"mrt"`
 			Metrics   map[string]any `yaml:"metrics"`
 		}
 
@@ -156,3 +1538,26 @@ func NewFromFile(filename string) (*Config, error) {
 
 	return cfg, cfg.Validate()
 }
+
+// isWholeSeconds ensures the duration could be passed to GoBGP which accepts
+// timers in seconds.
+func isWholeSeconds(v any) error {
+	d, ok := v.(th.Duration)
+	if !ok {
+		return errors.Errorf("unexpected type: %T", v)
+	}
+
+	if d.TimeDuration()%time.Second != 0 {
+		return errors.New("must be a whole number of seconds")
+	}
+	return nil
+}
+
+func appendUnique(dst []string, in ...string) []string {
+	for _, v := range in {
+		if !slices.Contains(dst, v) {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
@@ -20,10 +20,22 @@ func TestConfig(t *testing.T) {
 
 	sampleConfig := Config{
 		Announcer: Announcer{
+			CommunityAttributes: CommunityAttributes{
+				Communities: []string{"65000:100"},
+			},
 			RouterID:     "10.3.3.3",
 			LocalAddress: "10.0.0.1",
 			LocalASN:     65999,
-			Routes:       []string{"10.0.0.128/32"},
+			Routes: []Route{
+				{Prefix: "10.0.0.128/32"},
+				{
+					CommunityAttributes: CommunityAttributes{
+						Communities:      []string{"65000:200"},
+						LargeCommunities: []string{"65999:1:2"},
+					},
+					Prefix: "10.0.0.129/32",
+				},
+			},
 			Peers: []Peer{
 				{
 					Name:          "some_router_1",
@@ -34,7 +46,7 @@ func TestConfig(t *testing.T) {
 					Name:           "some_router_2",
 					RemoteAddress:  "10.0.0.253",
 					RemoteASN:      65000,
-					EnableMultihop: true,
+					EnableMultihop: boolPtr(true),
 					MultihopTTL:    2,
 				},
 			},
@@ -114,7 +126,7 @@ func TestEmptyConfig(t *testing.T) {
 	_, err := NewFromFile("testdata/empty.yaml")
 	r.Error(err)
 	r.Equal(
-		"announcer: (local_address: cannot be blank; local_asn: cannot be blank; peers: cannot be blank; router_id: cannot be blank; routes: cannot be blank.); metrics: (address: cannot be blank; enabled: cannot be blank.); services: cannot be blank.",
+		"announcer: (local_address: cannot be blank; local_asn: cannot be blank; peers: cannot be blank; router_id: cannot be blank.); metrics: (address: cannot be blank; enabled: cannot be blank.); services: cannot be blank.",
 		err.Error(),
 	)
 }
@@ -126,3 +138,1729 @@ func TestEmptyAnnouncerOnlyConfig(t *testing.T) {
 	_, err := NewFromFile("testdata/empty_with_announcer.yaml")
 	r.NoError(err)
 }
+
+func TestServiceRoutes(t *testing.T) {
+	type testCase struct {
+		name      string
+		announcer []Route
+		services  []Service
+		expRoutes [][]string
+		expError  error
+	}
+
+	tcs := []testCase{
+		{
+			name:      "fallback to announcer routes",
+			announcer: routesOf("10.0.0.1/32"),
+			services: []Service{
+				{Name: "http"},
+			},
+			expRoutes: [][]string{{"10.0.0.1/32"}},
+		},
+		{
+			name:      "service routes take precedence",
+			announcer: routesOf("10.0.0.1/32"),
+			services: []Service{
+				{Name: "http", Routes: routesOf("10.0.0.2/32")},
+				{Name: "dns"},
+			},
+			expRoutes: [][]string{{"10.0.0.2/32"}, {"10.0.0.1/32"}},
+		},
+		{
+			name: "service without routes",
+			services: []Service{
+				{Name: "http", Routes: routesOf("10.0.0.2/32")},
+				{Name: "dns"},
+			},
+			expError: errors.New("service `dns` has no routes: neither service nor announcer routes are defined"),
+		},
+		{
+			name:      "several services share announcer routes",
+			announcer: routesOf("10.0.0.1/32"),
+			services: []Service{
+				{Name: "http"},
+				{Name: "dns"},
+			},
+			expRoutes: [][]string{{"10.0.0.1/32"}, {"10.0.0.1/32"}},
+		},
+		{
+			name: "the same network listed twice in different notation",
+			services: []Service{
+				{Name: "dns", Routes: routesOf("10.0.0.0/24", "10.0.0.1/32", "10.0.0.1/24")},
+			},
+			expError: errors.New("route `10.0.0.1/24` is listed more than once in `dns` service"),
+		},
+		{
+			name: "IPv6 route without IPv6 local address",
+			services: []Service{
+				{Name: "dns", Routes: routesOf("10.0.0.1/32", "2001:db8::1/128")},
+			},
+			expError: errors.New("route `2001:db8::1/128` of `dns` service: no local address of the same address family is configured"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			cfg := Config{
+				Announcer: Announcer{
+					LocalAddress: "10.0.0.254",
+					Routes:       tc.announcer,
+				},
+				Services: tc.services,
+			}
+
+			err := cfg.validateServiceRoutes(cfg.Services)
+			if tc.expError != nil {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+				return
+			}
+
+			r.NoError(err)
+			for i, svc := range tc.services {
+				prefixes := []string{}
+				for _, route := range cfg.ServiceRoutes(svc) {
+					prefixes = append(prefixes, route.Prefix)
+				}
+				r.Equalf(tc.expRoutes[i], prefixes, "svc#%d", i)
+			}
+		})
+	}
+}
+
+func TestServiceNamesValidation(t *testing.T) {
+	r := require.New(t)
+
+	newService := func(name, route string) Service {
+		return Service{
+			Name:          name,
+			CheckInterval: th.Duration(time.Second),
+			Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+			Routes:        routesOf(route),
+		}
+	}
+
+	c := &Config{
+		Announcer: Announcer{
+			RouterID:     "10.3.3.3",
+			LocalAddress: "10.0.0.1",
+			LocalASN:     65999,
+			Peers:        []Peer{{Name: "some_router_1", RemoteAddress: "10.0.0.252", RemoteASN: 65000}},
+		},
+		Services: []Service{
+			newService("dns", "10.0.0.53/32"),
+			newService("ntp", "10.0.0.123/32"),
+		},
+		Metrics: Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+	}
+	r.NoError(c.Validate())
+
+	c.Services = append(c.Services, newService("dns", "10.0.0.54/32"))
+	r.EqualError(c.Validate(), "services: `dns` is defined more than once.")
+}
+
+func TestServiceRoutesCommunities(t *testing.T) {
+	r := require.New(t)
+
+	cfg := Config{
+		Announcer: Announcer{
+			CommunityAttributes: CommunityAttributes{
+				Communities: []string{"65000:1"},
+			},
+			Routes: routesOf("10.0.0.1/32"),
+		},
+		Services: []Service{
+			{
+				CommunityAttributes: CommunityAttributes{
+					Communities:         []string{"65000:2", "65000:1"},
+					ExtendedCommunities: []string{"rt:65000:1"},
+				},
+				Name: "http",
+				Routes: []Route{
+					{
+						CommunityAttributes: CommunityAttributes{
+							Communities:      []string{"65000:3"},
+							LargeCommunities: []string{"65000:1:1"},
+						},
+						Prefix: "10.0.0.2/32",
+					},
+				},
+			},
+			{
+				Name: "dns",
+			},
+		},
+	}
+
+	r.Equal([]Route{
+		{
+			CommunityAttributes: CommunityAttributes{
+				Communities:         []string{"65000:1", "65000:2", "65000:3"},
+				LargeCommunities:    []string{"65000:1:1"},
+				ExtendedCommunities: []string{"rt:65000:1"},
+			},
+			Prefix: "10.0.0.2/32",
+		},
+	}, cfg.ServiceRoutes(cfg.Services[0]))
+
+	r.Equal([]Route{
+		{
+			CommunityAttributes: CommunityAttributes{
+				Communities: []string{"65000:1"},
+			},
+			Prefix: "10.0.0.1/32",
+		},
+	}, cfg.ServiceRoutes(cfg.Services[1]))
+}
+
+func TestRouteValidation(t *testing.T) {
+	r := require.New(t)
+
+	err := Route{
+		CommunityAttributes: CommunityAttributes{
+			Communities:         []string{"65000:1", "blah"},
+			LargeCommunities:    []string{"65000:1"},
+			ExtendedCommunities: []string{"rt:65000:1", "xx:1:1"},
+		},
+		Prefix: "10.0.0.1",
+	}.Validate()
+	r.Error(err)
+	r.Equal(
+		"communities: (1: must be a valid community.); extended_communities: (1: must be a valid extended community.); large_communities: (0: must be a valid large community.); prefix: must be a valid CIDR.",
+		err.Error(),
+	)
+}
+
+func TestAnnouncerLocalAddresses(t *testing.T) {
+	type testCase struct {
+		name         string
+		in           Announcer
+		expLocalIPv4 string
+		expLocalIPv6 string
+	}
+
+	tcs := []testCase{
+		{
+			name:         "IPv4 only",
+			in:           Announcer{LocalAddress: "10.0.0.1"},
+			expLocalIPv4: "10.0.0.1",
+		},
+		{
+			name:         "IPv6 only",
+			in:           Announcer{LocalAddress: "2001:db8::1"},
+			expLocalIPv6: "2001:db8::1",
+		},
+		{
+			name:         "dual stack",
+			in:           Announcer{LocalAddress: "10.0.0.1", LocalAddressIPv6: "2001:db8::1"},
+			expLocalIPv4: "10.0.0.1",
+			expLocalIPv6: "2001:db8::1",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			r.Equal(tc.expLocalIPv4, tc.in.LocalIPv4())
+			r.Equal(tc.expLocalIPv6, tc.in.LocalIPv6())
+			r.Equal(tc.expLocalIPv4, tc.in.LocalAddressFor("10.0.0.252"))
+			r.Equal(tc.expLocalIPv6, tc.in.LocalAddressFor("2001:db8::252"))
+		})
+	}
+}
+
+func TestAnnouncerValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       Announcer
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "dual stack peers",
+			in: Announcer{
+				RouterID:         "10.3.3.3",
+				LocalAddress:     "10.0.0.1",
+				LocalAddressIPv6: "2001:db8::1",
+				LocalASN:         65999,
+				Peers: []Peer{
+					{Name: "v4", RemoteAddress: "10.0.0.252", RemoteASN: 65000},
+					{Name: "v6", RemoteAddress: "2001:db8::252", RemoteASN: 65000, Families: []string{"ipv6-unicast"}},
+				},
+			},
+		},
+		{
+			name: "IPv6 peer without IPv6 local address",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "v6", RemoteAddress: "2001:db8::252", RemoteASN: 65000},
+				},
+			},
+			expError: errors.New("peers: peer `v6`: no local address of the same address family is configured."),
+		},
+		{
+			name: "unknown family",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "v4", RemoteAddress: "10.0.0.252", RemoteASN: 65000, Families: []string{"ipv4-multicast"}},
+				},
+			},
+			expError: errors.New("peers: (0: (families: (0: must be a valid value.).).)."),
+		},
+		{
+			name: "local AS and next hop overrides",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "transit1", RemoteAddress: "10.0.1.1", RemoteASN: 65000, LocalAS: 64999, NextHop: "10.0.1.2"},
+				},
+			},
+		},
+		{
+			name: "peer defined more than once",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "transit1", RemoteAddress: "10.0.1.1", RemoteASN: 65000, NextHop: "10.0.1.2"},
+					{Name: "transit1", RemoteAddress: "10.0.2.1", RemoteASN: 65001, NextHop: "10.0.2.2"},
+				},
+			},
+			expError: errors.New("peers: `transit1` is defined more than once."),
+		},
+		{
+			name: "invalid next hop",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "transit1", RemoteAddress: "10.0.1.1", RemoteASN: 65000, NextHop: "transit"},
+				},
+			},
+			expError: errors.New("peers: (0: (next_hop: must be a valid IP address.).)."),
+		},
+		{
+			name: "next hop with VPN family",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "pe1", RemoteAddress: "10.0.0.252", RemoteASN: 65999, NextHop: "10.0.0.2", Families: []string{"ipv4-unicast", "ipv4-vpn"}},
+				},
+			},
+			expError: errors.New("peers: (0: (next_hop: is not supported for VPN and EVPN families.).)."),
+		},
+		{
+			name: "several password sources",
+			in: Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers: []Peer{
+					{Name: "v4", RemoteAddress: "10.0.0.252", RemoteASN: 65000, Password: "secret", PasswordEnv: "PEER_PASSWORD"},
+				},
+			},
+			expError: errors.New("peers: (0: (password_env: must be blank when password or password_file is set.).)."),
+		},
+		{
+			name: "IPv4 address as local IPv6 address",
+			in: Announcer{
+				RouterID:         "10.3.3.3",
+				LocalAddress:     "10.0.0.1",
+				LocalAddressIPv6: "10.0.0.2",
+				LocalASN:         65999,
+				Peers: []Peer{
+					{Name: "v4", RemoteAddress: "10.0.0.252", RemoteASN: 65000},
+				},
+			},
+			expError: errors.New("local_address_ipv6: must be a valid IPv6 address."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := tc.in.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestPeerGroups(t *testing.T) {
+	r := require.New(t)
+
+	a := Announcer{
+		RouterID:     "10.3.3.3",
+		LocalAddress: "10.0.0.1",
+		LocalASN:     65999,
+		PeerGroups: []PeerGroup{
+			{
+				Name:              "tor",
+				RemoteASN:         65000,
+				Families:          []string{"ipv4-unicast"},
+				PasswordEnv:       "TOR_PASSWORD",
+				HoldTime:          th.Duration(9 * time.Second),
+				KeepaliveInterval: th.Duration(3 * time.Second),
+			},
+		},
+		Peers: []Peer{
+			{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"},
+			{Name: "tor2", PeerGroup: "tor", RemoteAddress: "10.0.0.253", RemoteASN: 65001, Password: "secret"},
+			{Name: "spine", RemoteAddress: "10.0.0.254", RemoteASN: 65100},
+		},
+	}
+	r.NoError(a.Validate())
+
+	r.Equal([]Peer{
+		{
+			Name:              "tor1",
+			PeerGroup:         "tor",
+			RemoteAddress:     "10.0.0.252",
+			RemoteASN:         65000,
+			Families:          []string{"ipv4-unicast"},
+			PasswordEnv:       "TOR_PASSWORD",
+			HoldTime:          th.Duration(9 * time.Second),
+			KeepaliveInterval: th.Duration(3 * time.Second),
+		},
+		{
+			Name:              "tor2",
+			PeerGroup:         "tor",
+			RemoteAddress:     "10.0.0.253",
+			RemoteASN:         65001,
+			Families:          []string{"ipv4-unicast"},
+			Password:          "secret",
+			HoldTime:          th.Duration(9 * time.Second),
+			KeepaliveInterval: th.Duration(3 * time.Second),
+		},
+		{Name: "spine", RemoteAddress: "10.0.0.254", RemoteASN: 65100},
+	}, a.ResolvedPeers())
+	// peers referencing the groups are resolved by anycastd
+	r.Empty(a.DynamicPeerGroups())
+
+	a.PeerGroups = append(a.PeerGroups, PeerGroup{Name: "rack", RemoteASN: 65200})
+	a.DynamicNeighbors = []DynamicNeighbor{{Prefix: "10.1.0.0/24", PeerGroup: "rack"}}
+	r.Equal([]PeerGroup{{Name: "rack", RemoteASN: 65200}}, a.DynamicPeerGroups())
+}
+
+func TestPeerGroupBoolOverrides(t *testing.T) {
+	r := require.New(t)
+
+	a := Announcer{
+		RouterID:     "10.3.3.3",
+		LocalAddress: "10.0.0.1",
+		LocalASN:     65999,
+		PeerGroups: []PeerGroup{
+			{Name: "spine", RemoteASN: 65000, EnableMultihop: true, MultihopTTL: 2, PassiveMode: true},
+		},
+		Peers: []Peer{
+			{Name: "spine1", PeerGroup: "spine", RemoteAddress: "10.0.0.252"},
+			{Name: "spine2", PeerGroup: "spine", RemoteAddress: "10.0.0.253", EnableMultihop: boolPtr(false), PassiveMode: boolPtr(false), BFD: &BFD{}},
+		},
+	}
+	r.NoError(a.Validate())
+
+	peers := a.ResolvedPeers()
+	r.True(peers[0].MultihopEnabled())
+	r.True(peers[0].PassiveModeEnabled())
+	r.False(peers[1].MultihopEnabled())
+	r.False(peers[1].PassiveModeEnabled())
+}
+
+func TestPeerGroupsValidation(t *testing.T) {
+	type testCase struct {
+		name       string
+		peerGroups []PeerGroup
+		peer       Peer
+		expError   error
+	}
+
+	tcs := []testCase{
+		{
+			name:       "undefined peer group",
+			peerGroups: []PeerGroup{{Name: "tor", RemoteASN: 65000}},
+			peer:       Peer{Name: "tor1", PeerGroup: "spine", RemoteAddress: "10.0.0.252"},
+			expError:   errors.New("peers: peer `tor1`: peer group `spine` is not defined."),
+		},
+		{
+			name:       "no remote ASN on the peer and the group",
+			peerGroups: []PeerGroup{{Name: "tor"}},
+			peer:       Peer{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"},
+			expError:   errors.New("peers: peer `tor1`: remote_asn: cannot be blank."),
+		},
+		{
+			name:       "keepalive interval override is not less than group hold time",
+			peerGroups: []PeerGroup{{Name: "tor", RemoteASN: 65000, HoldTime: th.Duration(9 * time.Second)}},
+			peer:       Peer{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252", KeepaliveInterval: th.Duration(9 * time.Second)},
+			expError:   errors.New("peers: peer `tor1`: keepalive_interval: must be less than hold_time."),
+		},
+		{
+			name:       "next hop override with group EVPN family",
+			peerGroups: []PeerGroup{{Name: "pe", RemoteASN: 65999, Families: []string{"l2vpn-evpn"}}},
+			peer:       Peer{Name: "pe1", PeerGroup: "pe", RemoteAddress: "10.0.0.252", NextHop: "10.0.0.2"},
+			expError:   errors.New("peers: peer `pe1`: next_hop: is not supported for VPN and EVPN families."),
+		},
+		{
+			name:       "duplicate peer groups",
+			peerGroups: []PeerGroup{{Name: "tor", RemoteASN: 65000}, {Name: "tor", RemoteASN: 65001}},
+			peer:       Peer{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"},
+			expError:   errors.New("peer_groups: `tor` is defined more than once."),
+		},
+		{
+			name:       "invalid peer group",
+			peerGroups: []PeerGroup{{Name: "tor", RemoteASN: 65000, Families: []string{"ipv4-multicast"}}},
+			peer:       Peer{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"},
+			expError:   errors.New("peer_groups: (0: (families: (0: must be a valid value.).).); peers: peer `tor1`: families: (0: must be a valid value.)."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				PeerGroups:   tc.peerGroups,
+				Peers:        []Peer{tc.peer},
+			}.Validate()
+			r.Error(err)
+			r.Equal(tc.expError.Error(), err.Error())
+		})
+	}
+}
+
+func TestDynamicNeighborsValidation(t *testing.T) {
+	type testCase struct {
+		name             string
+		listener         Listener
+		dynamicNeighbors []DynamicNeighbor
+		expError         error
+	}
+
+	tcs := []testCase{
+		{
+			name:             "valid",
+			listener:         Listener{Enabled: true},
+			dynamicNeighbors: []DynamicNeighbor{{Prefix: "10.0.1.0/24", PeerGroup: "tor"}},
+		},
+		{
+			name:             "listener is disabled",
+			dynamicNeighbors: []DynamicNeighbor{{Prefix: "10.0.1.0/24", PeerGroup: "tor"}},
+			expError:         errors.New("dynamic_neighbors: listener must be enabled to accept sessions from dynamic neighbors."),
+		},
+		{
+			name:             "undefined peer group",
+			listener:         Listener{Enabled: true},
+			dynamicNeighbors: []DynamicNeighbor{{Prefix: "10.0.1.0/24", PeerGroup: "spine"}},
+			expError:         errors.New("dynamic_neighbors: dynamic neighbor `10.0.1.0/24`: peer group `spine` is not defined."),
+		},
+		{
+			name:             "invalid prefix and listener",
+			listener:         Listener{Enabled: true, Port: 70000, Addresses: []string{"localhost"}},
+			dynamicNeighbors: []DynamicNeighbor{{Prefix: "10.0.1.0", PeerGroup: "tor"}},
+			expError:         errors.New("dynamic_neighbors: (0: (prefix: must be a valid CIDR.).); listener: (addresses: (0: must be a valid IP address.); port: must be no greater than 65535.)."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := Announcer{
+				RouterID:         "10.3.3.3",
+				LocalAddress:     "10.0.0.1",
+				LocalASN:         65999,
+				PeerGroups:       []PeerGroup{{Name: "tor", RemoteASN: 65000}},
+				Peers:            []Peer{{Name: "spine", RemoteAddress: "10.0.0.252", RemoteASN: 65100}},
+				Listener:         tc.listener,
+				DynamicNeighbors: tc.dynamicNeighbors,
+			}.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestInterfacePeersValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		peer     Peer
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "valid",
+			peer: Peer{Name: "spine1", Interface: "eth1", RemoteASN: 65000},
+		},
+		{
+			name:     "neither address nor interface",
+			peer:     Peer{Name: "spine1", RemoteASN: 65000},
+			expError: errors.New("peers: (0: (remote_address: cannot be blank.).)."),
+		},
+		{
+			name:     "both address and interface",
+			peer:     Peer{Name: "spine1", Interface: "eth1", RemoteAddress: "2001:db8::1", RemoteASN: 65000},
+			expError: errors.New("peers: (0: (remote_address: must be blank when interface is set.).)."),
+		},
+		{
+			name:     "multihop and passive mode",
+			peer:     Peer{Name: "spine1", Interface: "eth1", RemoteASN: 65000, EnableMultihop: boolPtr(true), MultihopTTL: 2, PassiveMode: boolPtr(true)},
+			expError: errors.New("peers: (0: (enable_multihop: is not supported for interface peers; passive_mode: is not supported for interface peers.).)."),
+		},
+		{
+			name:     "next hop",
+			peer:     Peer{Name: "spine1", Interface: "eth1", RemoteASN: 65000, NextHop: "2001:db8::3"},
+			expError: errors.New("peers: (0: (next_hop: is not supported for interface peers.).)."),
+		},
+		{
+			name:     "bfd",
+			peer:     Peer{Name: "spine1", Interface: "eth1", RemoteASN: 65000, BFD: &BFD{}},
+			expError: errors.New("peers: (0: (bfd: is not supported for interface peers.).)."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "2001:db8::2",
+				LocalASN:     65999,
+				Peers:        []Peer{tc.peer},
+			}.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestInterfacePeersServices(t *testing.T) {
+	r := require.New(t)
+
+	c := &Config{
+		Announcer: Announcer{
+			RouterID:     "10.3.3.3",
+			LocalAddress: "2001:db8::2",
+			LocalASN:     65999,
+			Routes:       routesOf("10.0.0.128/32", "2001:db8::128/128"),
+			PeerGroups:   []PeerGroup{{Name: "spine", RemoteASN: 65000}},
+			Peers: []Peer{
+				{Name: "spine1", PeerGroup: "spine", Interface: "eth1"},
+				{Name: "spine2", PeerGroup: "spine", Interface: "eth2"},
+			},
+		},
+		Services: []Service{
+			{Name: "resolver", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}},
+		},
+		Metrics: Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+	}
+	r.NoError(c.Validate())
+	r.True(c.Announcer.ExtendedNextHop())
+
+	c.Services[0].Peers = []string{"spine1"}
+	r.EqualError(c.Validate(), "services: service `resolver`: peer `spine1` is an interface peer, limiting routes to interface peers is not supported.")
+
+	c.Services[0].Peers = nil
+	c.Services[0].PeerGroups = []string{"spine"}
+	r.EqualError(c.Validate(), "services: service `resolver`: peer group `spine` has interface peer `spine1`, limiting routes to interface peers is not supported.")
+
+	// IPv4 routes need IPv4 next hop without interface peers
+	c.Services[0].PeerGroups = nil
+	c.Announcer.Peers = []Peer{{Name: "spine1", RemoteAddress: "2001:db8::1", RemoteASN: 65000}}
+	r.False(c.Announcer.ExtendedNextHop())
+	r.EqualError(c.Validate(), "services: route `10.0.0.128/32` of `resolver` service: no local address of the same address family is configured.")
+}
+
+func TestVRFsValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		vrfs     []VRF
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "valid",
+			vrfs: []VRF{
+				{Name: "customer1", RD: "65000:100", ImportRTs: []string{"65000:100"}, ExportRTs: []string{"65000:100"}, Label: 100},
+				{Name: "customer2", RD: "10.0.0.1:200", ExportRTs: []string{"10.0.0.1:200"}, Family: "evpn"},
+			},
+		},
+		{
+			name: "invalid fields",
+			vrfs: []VRF{
+				{Name: "customer1", RD: "customer1", ImportRTs: []string{"65000"}, Label: 1 << 20, Family: "vxlan"},
+			},
+			expError: errors.New("vrfs: (0: (export_rts: cannot be blank; family: must be a valid value; import_rts: (0: must be a valid route target.); label: must be no greater than 1048575; rd: must be a valid route distinguisher.).)."),
+		},
+		{
+			name: "duplicate name",
+			vrfs: []VRF{
+				{Name: "customer1", RD: "65000:100", ExportRTs: []string{"65000:100"}},
+				{Name: "customer1", RD: "65000:200", ExportRTs: []string{"65000:200"}},
+			},
+			expError: errors.New("vrfs: `customer1` is defined more than once."),
+		},
+		{
+			name: "duplicate route distinguisher",
+			vrfs: []VRF{
+				{Name: "customer1", RD: "65000:100", ExportRTs: []string{"65000:100"}},
+				{Name: "customer2", RD: "65000:100", ExportRTs: []string{"65000:200"}},
+			},
+			expError: errors.New("vrfs: vrf `customer2`: route distinguisher `65000:100` is already used by vrf `customer1`."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers:        []Peer{{Name: "pe1", RemoteAddress: "10.0.0.252", RemoteASN: 65999, Families: []string{"ipv4-vpn", "l2vpn-evpn"}}},
+				VRFs:         tc.vrfs,
+			}.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestServiceVRF(t *testing.T) {
+	r := require.New(t)
+
+	c := &Config{
+		Announcer: Announcer{
+			RouterID:     "10.3.3.3",
+			LocalAddress: "10.0.0.1",
+			LocalASN:     65999,
+			Routes:       routesOf("10.0.0.128/32"),
+			Peers:        []Peer{{Name: "pe1", RemoteAddress: "10.0.0.252", RemoteASN: 65999, Families: []string{"ipv4-vpn", "l2vpn-evpn"}}},
+			VRFs: []VRF{
+				{Name: "customer1", RD: "65000:100", ExportRTs: []string{"65000:100"}},
+				{Name: "customer2", RD: "65000:200", ExportRTs: []string{"65000:200"}, Family: "evpn"},
+			},
+		},
+		Services: []Service{
+			{Name: "resolver", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}, VRF: "customer1"},
+			{Name: "ntp", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}},
+		},
+		Metrics: Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+	}
+	r.NoError(c.Validate())
+
+	r.Equal(&c.Announcer.VRFs[0], c.ServiceVRF(c.Services[0]))
+	r.Nil(c.ServiceVRF(c.Services[1]))
+
+	c.Services[1].VRF = "customer3"
+	r.EqualError(c.Validate(), "services: service `ntp`: vrf `customer3` is not defined.")
+
+	c.Services[1].VRF = "customer1"
+	c.Services[1].Peers = []string{"pe1"}
+	r.EqualError(c.Validate(), "services: service `ntp`: limiting VPN routes to peers is not supported.")
+
+	c.Services[1].VRF = "customer2"
+	r.EqualError(c.Validate(), "services: service `ntp`: limiting EVPN routes to peers is not supported.")
+}
+
+func TestServiceNeighbors(t *testing.T) {
+	r := require.New(t)
+
+	c := &Config{
+		Announcer: Announcer{
+			RouterID:     "10.3.3.3",
+			LocalAddress: "10.0.0.1",
+			LocalASN:     65999,
+			Routes:       routesOf("10.0.0.128/32"),
+			PeerGroups:   []PeerGroup{{Name: "fabric", RemoteASN: 65000}},
+			Peers: []Peer{
+				{Name: "fabric1", PeerGroup: "fabric", RemoteAddress: "10.0.0.252"},
+				{Name: "edge1", RemoteAddress: "10.0.0.253", RemoteASN: 65100},
+				{Name: "edge2", RemoteAddress: "10.0.0.254", RemoteASN: 65100},
+			},
+			Listener:         Listener{Enabled: true},
+			DynamicNeighbors: []DynamicNeighbor{{Prefix: "10.0.1.0/24", PeerGroup: "fabric"}},
+		},
+		Services: []Service{
+			{Name: "resolver", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}, PeerGroups: []string{"fabric"}},
+			{Name: "vip", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}, Peers: []string{"edge1", "edge2"}},
+			{Name: "ntp", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}},
+		},
+		Metrics: Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+	}
+	r.NoError(c.Validate())
+
+	r.Equal([]string{"10.0.0.252", "10.0.1.0/24"}, c.ServiceNeighbors(c.Services[0]))
+	r.Equal([]string{"10.0.0.253", "10.0.0.254"}, c.ServiceNeighbors(c.Services[1]))
+	r.Nil(c.ServiceNeighbors(c.Services[2]))
+
+	c.Services[1].Peers = []string{"edge3"}
+	r.EqualError(c.Validate(), "services: service `vip`: peer `edge3` is not defined.")
+
+	c.Services[1].Peers = nil
+	c.Services[1].PeerGroups = []string{"transit"}
+	r.EqualError(c.Validate(), "services: service `vip`: peer group `transit` is not defined.")
+}
+
+func TestPoliciesValidation(t *testing.T) {
+	type testCase struct {
+		name        string
+		definedSets DefinedSets
+		policies    []Policy
+		expError    error
+	}
+
+	definedSets := DefinedSets{
+		PrefixSets:    []PrefixSet{{Name: "vips", Prefixes: []PolicyPrefix{{Prefix: "10.0.0.128/32"}}}},
+		NeighborSets:  []NeighborSet{{Name: "edge", Neighbors: []string{"10.0.0.253", "10.0.1.0/24"}}},
+		CommunitySets: []CommunitySet{{Name: "blackhole", Communities: []string{"blackhole"}}},
+	}
+
+	tcs := []testCase{
+		{
+			name:        "valid",
+			definedSets: definedSets,
+			policies: []Policy{{Name: "edge", Statements: []Statement{
+				{
+					Conditions: PolicyConditions{PrefixSet: &MatchSet{Name: "vips"}, NeighborSet: &MatchSet{Name: "edge", Match: "invert"}},
+					Actions:    PolicyActions{ASPathPrepend: 3, Communities: []string{"no-export"}},
+				},
+				{
+					Conditions: PolicyConditions{CommunitySet: &MatchSet{Name: "blackhole", Match: "all"}},
+					Actions:    PolicyActions{Reject: true},
+				},
+			}}},
+		},
+		{
+			name:        "undefined set",
+			definedSets: definedSets,
+			policies: []Policy{{Name: "edge", Statements: []Statement{
+				{Conditions: PolicyConditions{NeighborSet: &MatchSet{Name: "transit"}}, Actions: PolicyActions{Reject: true}},
+			}}},
+			expError: errors.New("policies: policy `edge` statement 0: neighbor set `transit` is not defined."),
+		},
+		{
+			name:        "invalid match type",
+			definedSets: definedSets,
+			policies: []Policy{{Name: "edge", Statements: []Statement{
+				{Conditions: PolicyConditions{PrefixSet: &MatchSet{Name: "vips", Match: "all"}}, Actions: PolicyActions{Reject: true}},
+			}}},
+			expError: errors.New("policies: (0: (statements: (0: (conditions: (prefix_set: (match: must be a valid value.).).).).).)."),
+		},
+		{
+			name: "invalid defined sets",
+			definedSets: DefinedSets{
+				PrefixSets: []PrefixSet{
+					{Name: "mixed", Prefixes: []PolicyPrefix{{Prefix: "10.0.0.128/32"}, {Prefix: "2001:db8::/64"}}},
+					{Name: "anycastd-vips", Prefixes: []PolicyPrefix{{Prefix: "10.0.0.0/16", MaskLengthMin: 24, MaskLengthMax: 20}}},
+				},
+				NeighborSets: []NeighborSet{{Name: "edge", Neighbors: []string{"router"}}},
+			},
+			expError: errors.New("defined_sets: (neighbor_sets: (0: (neighbors: (0: must be a valid IP address or CIDR.).).); prefix_sets: (0: (prefixes: must not mix IPv4 and IPv6 prefixes.); 1: (name: must not start with `anycastd-`; prefixes: (0: (mask_length_max: must be no less than mask_length_min.).).).).)."),
+		},
+		{
+			name:        "duplicate policies",
+			definedSets: definedSets,
+			policies: []Policy{
+				{Name: "edge", Statements: []Statement{{Actions: PolicyActions{Reject: true}}}},
+				{Name: "edge", Statements: []Statement{{Actions: PolicyActions{Reject: true}}}},
+			},
+			expError: errors.New("policies: `edge` is defined more than once."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := Announcer{
+				RouterID:     "10.3.3.3",
+				LocalAddress: "10.0.0.1",
+				LocalASN:     65999,
+				Peers:        []Peer{{Name: "edge1", RemoteAddress: "10.0.0.253", RemoteASN: 65100}},
+				DefinedSets:  tc.definedSets,
+				Policies:     tc.policies,
+			}.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestPeerGroupPolicies(t *testing.T) {
+	type testCase struct {
+		name     string
+		group    PeerGroup
+		peers    []Peer
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name:  "valid",
+			group: PeerGroup{Name: "tor", RemoteASN: 65000, Policies: []string{"tor-med"}},
+		},
+		{
+			name:     "undefined policy",
+			group:    PeerGroup{Name: "tor", RemoteASN: 65000, Policies: []string{"transit"}},
+			expError: errors.New("peer_groups: peer group `tor`: policy `transit` is not defined."),
+		},
+		{
+			name:     "policy with neighbor set",
+			group:    PeerGroup{Name: "tor", RemoteASN: 65000, Policies: []string{"edge"}},
+			expError: errors.New("peer_groups: peer group `tor`: policy `edge` statement 0: neighbor set is not supported for peer group policies."),
+		},
+		{
+			name:     "interface peer",
+			group:    PeerGroup{Name: "tor", RemoteASN: 65000, Policies: []string{"tor-med"}},
+			peers:    []Peer{{Name: "tor2", PeerGroup: "tor", Interface: "eth1"}},
+			expError: errors.New("peer_groups: peer group `tor` has interface peer `tor2`, policies are not supported for interface peers."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			med := uint32(100)
+			err := Announcer{
+				RouterID:         "10.3.3.3",
+				LocalAddress:     "10.0.0.1",
+				LocalAddressIPv6: "2001:db8::1",
+				LocalASN:         65999,
+				PeerGroups:       []PeerGroup{tc.group},
+				Peers:            append([]Peer{{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"}}, tc.peers...),
+				DefinedSets:      DefinedSets{NeighborSets: []NeighborSet{{Name: "edge", Neighbors: []string{"10.0.0.253"}}}},
+				Policies: []Policy{
+					{Name: "tor-med", Statements: []Statement{{Actions: PolicyActions{MED: &med}}}},
+					{Name: "edge", Statements: []Statement{{Conditions: PolicyConditions{NeighborSet: &MatchSet{Name: "edge"}}, Actions: PolicyActions{Reject: true}}}},
+				},
+			}.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestPeerGroupNeighbors(t *testing.T) {
+	r := require.New(t)
+
+	a := Announcer{
+		Peers: []Peer{
+			{Name: "tor1", PeerGroup: "tor", RemoteAddress: "10.0.0.252"},
+			{Name: "tor2", PeerGroup: "tor", Interface: "eth1"},
+			{Name: "spine1", RemoteAddress: "10.0.0.254"},
+		},
+		DynamicNeighbors: []DynamicNeighbor{
+			{Prefix: "10.0.2.0/24", PeerGroup: "tor"},
+			{Prefix: "10.0.3.0/24", PeerGroup: "spine"},
+		},
+	}
+
+	r.Equal([]string{"10.0.0.252", "10.0.2.0/24"}, a.PeerGroupNeighbors("tor"))
+	r.Empty(a.PeerGroupNeighbors("edge"))
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func routesOf(prefixes ...string) []Route {
+	routes := []Route{}
+	for _, prefix := range prefixes {
+		routes = append(routes, Route{Prefix: prefix})
+	}
+	return routes
+}
+
+func TestServiceDegradedValidation(t *testing.T) {
+	r := require.New(t)
+
+	svc := Service{
+		Name:          "http",
+		CheckInterval: th.Duration(10 * time.Second),
+		Checks: []Check{
+			{Kind: "http_2xx", Spec: json.RawMessage(`{}`), OnFailure: "degrade"},
+			{Kind: "icmp_ping", Spec: json.RawMessage(`{}`), OnFailure: "restart"},
+		},
+		Degraded: Degraded{
+			ASPathPrepend: 64,
+			MED:           100,
+			Communities:   []string{"65000:1:1"},
+		},
+	}
+
+	err := svc.Validate()
+	r.Error(err)
+	r.Equal(
+		"checks: (1: (on_failure: must be a valid value.).); degraded: (as_path_prepend: must be no greater than 32; communities: (0: must be a valid community.).).",
+		err.Error(),
+	)
+}
+
+func TestDynamicMEDValidation(t *testing.T) {
+	r := require.New(t)
+
+	err := DynamicMED{
+		Hysteresis: 0.1,
+		Buckets: []MEDBucket{
+			{Above: 0, MED: 0},
+			{Above: th.Duration(50 * time.Millisecond), MED: 100},
+		},
+	}.Validate()
+	r.NoError(err)
+
+	err = DynamicMED{
+		Hysteresis: 1,
+		Buckets: []MEDBucket{
+			{Above: th.Duration(50 * time.Millisecond), MED: 100},
+			{Above: 0, MED: 0},
+		},
+	}.Validate()
+	r.Error(err)
+	r.Equal("buckets: must be sorted by `above` in ascending order; hysteresis: must be no greater than 0.9.", err.Error())
+
+	err = DynamicMED{}.Validate()
+	r.Error(err)
+	r.Equal("buckets: cannot be blank.", err.Error())
+}
+
+func TestPeerTimersValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       Peer
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "aggressive timers",
+			in: Peer{
+				Name:              "leaf",
+				RemoteAddress:     "10.0.0.252",
+				RemoteASN:         65000,
+				HoldTime:          th.Duration(9 * time.Second),
+				KeepaliveInterval: th.Duration(3 * time.Second),
+				ConnectRetry:      th.Duration(5 * time.Second),
+				PassiveMode:       boolPtr(true),
+				RemotePort:        1179,
+			},
+		},
+		{
+			name: "keepalive interval is not less than hold time",
+			in: Peer{
+				Name:              "leaf",
+				RemoteAddress:     "10.0.0.252",
+				RemoteASN:         65000,
+				HoldTime:          th.Duration(9 * time.Second),
+				KeepaliveInterval: th.Duration(9 * time.Second),
+			},
+			expError: errors.New("keepalive_interval: must be less than hold_time."),
+		},
+		{
+			name: "too short hold time",
+			in: Peer{
+				Name:          "leaf",
+				RemoteAddress: "10.0.0.252",
+				RemoteASN:     65000,
+				HoldTime:      th.Duration(2 * time.Second),
+			},
+			expError: errors.New("hold_time: must be no less than 3s."),
+		},
+		{
+			name: "fractional seconds and invalid port",
+			in: Peer{
+				Name:          "leaf",
+				RemoteAddress: "10.0.0.252",
+				RemoteASN:     65000,
+				ConnectRetry:  th.Duration(1500 * time.Millisecond),
+				RemotePort:    70000,
+			},
+			expError: errors.New("connect_retry: must be a whole number of seconds; remote_port: must be no greater than 65535."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := tc.in.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestGracefulRestartValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       GracefulRestart
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "graceful restart with long-lived one",
+			in: GracefulRestart{
+				Enabled:     true,
+				RestartTime: th.Duration(120 * time.Second),
+				LongLived: LongLivedGracefulRestart{
+					Enabled:     true,
+					RestartTime: th.Duration(time.Hour),
+				},
+			},
+		},
+		{
+			name: "too long restart time",
+			in: GracefulRestart{
+				Enabled:     true,
+				RestartTime: th.Duration(time.Hour * 2),
+			},
+			expError: errors.New("restart_time: must be no greater than 4095s."),
+		},
+		{
+			name: "long-lived graceful restart without restart time",
+			in: GracefulRestart{
+				Enabled: true,
+				LongLived: LongLivedGracefulRestart{
+					Enabled: true,
+				},
+			},
+			expError: errors.New("long_lived: (restart_time: cannot be blank.)."),
+		},
+		{
+			name: "long-lived graceful restart only",
+			in: GracefulRestart{
+				LongLived: LongLivedGracefulRestart{
+					Enabled:     true,
+					RestartTime: th.Duration(time.Hour),
+				},
+			},
+			expError: errors.New("long_lived: requires graceful restart to be enabled."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := tc.in.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestBMPValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       BMP
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "valid stations",
+			in: BMP{Stations: []BMPStation{
+				{Address: "10.0.0.100"},
+				{Address: "bmp.example.org", Port: 5000, Policy: "all", StatisticsInterval: th.Duration(time.Minute), SysName: "node1"},
+			}},
+		},
+		{
+			name: "invalid station",
+			in: BMP{Stations: []BMPStation{
+				{Address: "10.0.0.100/24", Port: 70000, Policy: "adj-rib-out", StatisticsInterval: th.Duration(1500 * time.Millisecond)},
+			}},
+			expError: errors.New("stations: (0: (address: must be a valid IP address or DNS name; policy: must be a valid value; port: must be no greater than 65535; statistics_interval: must be a whole number of seconds.).)."),
+		},
+		{
+			name: "missing address",
+			in: BMP{Stations: []BMPStation{
+				{Port: 5000},
+			}},
+			expError: errors.New("stations: (0: (address: cannot be blank.).)."),
+		},
+		{
+			name: "duplicate station",
+			in: BMP{Stations: []BMPStation{
+				{Address: "10.0.0.100"},
+				{Address: "10.0.0.100", Port: 11019, Policy: "post"},
+			}},
+			expError: errors.New("stations: station `10.0.0.100:11019` is defined more than once."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := tc.in.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestBMPYAMLConfig(t *testing.T) {
+	r := require.New(t)
+
+	cfg, err := NewFromFile("testdata/bmp.yaml")
+	r.NoError(err)
+	r.Equal(BMP{Stations: []BMPStation{
+		{Address: "10.0.0.100", Port: 11019, Policy: "post", StatisticsInterval: th.Duration(time.Minute)},
+		{Address: "bmp.example.org"},
+	}}, cfg.BMP)
+}
+
+func TestMRTValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       MRT
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "valid dumps",
+			in: MRT{Dumps: []MRTDump{
+				{Type: "updates", FileName: "/var/lib/anycastd/updates.20060102.1504.mrt", RotationInterval: th.Duration(time.Hour), MaxSizeMB: 100},
+				{Type: "table", FileName: "/var/lib/anycastd/table.20060102.1504.mrt", RotationInterval: th.Duration(time.Hour)},
+				{Type: "table", FileName: "/var/lib/anycastd/table.mrt", DumpInterval: th.Duration(5 * time.Minute)},
+			}},
+		},
+		{
+			name: "missing fields",
+			in: MRT{Dumps: []MRTDump{
+				{},
+			}},
+			expError: errors.New("dumps: (0: (file_name: cannot be blank; type: cannot be blank.).)."),
+		},
+		{
+			name: "invalid updates dump",
+			in: MRT{Dumps: []MRTDump{
+				{Type: "updates", FileName: "updates.mrt", DumpInterval: th.Duration(time.Minute), RotationInterval: th.Duration(30 * time.Second)},
+			}},
+			expError: errors.New("dumps: (0: (dump_interval: is not supported for updates dumps; rotation_interval: must be no less than 60s.).)."),
+		},
+		{
+			name: "invalid table dump",
+			in: MRT{Dumps: []MRTDump{
+				{Type: "table", FileName: "table.mrt", DumpInterval: th.Duration(90500 * time.Millisecond), RotationInterval: th.Duration(time.Hour), MaxSizeMB: 100},
+			}},
+			expError: errors.New("dumps: (0: (dump_interval: must be a whole number of seconds; max_size_mb: is supported for updates dumps only; rotation_interval: cannot be set together with dump_interval.).)."),
+		},
+		{
+			name: "rotation by size with long rotation interval",
+			in: MRT{Dumps: []MRTDump{
+				{Type: "updates", FileName: "updates.mrt", RotationInterval: th.Duration(2 * time.Hour), MaxSizeMB: 100},
+			}},
+			expError: errors.New("dumps: (0: (rotation_interval: must be no greater than 1h with max_size_mb.).)."),
+		},
+		{
+			name: "duplicate file name",
+			in: MRT{Dumps: []MRTDump{
+				{Type: "updates", FileName: "dump.mrt"},
+				{Type: "table", FileName: "dump.mrt"},
+			}},
+			expError: errors.New("dumps: `dump.mrt` is defined more than once."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := tc.in.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestMRTYAMLConfig(t *testing.T) {
+	r := require.New(t)
+
+	cfg, err := NewFromFile("testdata/mrt.yaml")
+	r.NoError(err)
+	r.Equal(MRT{Dumps: []MRTDump{
+		{Type: "updates", FileName: "/var/lib/anycastd/mrt/updates.20060102.1504.mrt", RotationInterval: th.Duration(time.Hour), MaxSizeMB: 100},
+		{Type: "table", FileName: "/var/lib/anycastd/mrt/table.mrt", DumpInterval: th.Duration(5 * time.Minute)},
+	}}, cfg.MRT)
+}
+
+func TestKernelBackendValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       []Service
+		expError error
+	}
+
+	newService := func(name string, kernel *Kernel, routes ...string) Service {
+		svc := Service{
+			Name:          name,
+			CheckInterval: th.Duration(time.Second),
+			Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+			Routes:        routesOf(routes...),
+		}
+		if kernel != nil {
+			svc.Backend = BackendKernel
+			svc.Kernel = kernel
+		}
+		return svc
+	}
+
+	tcs := []testCase{
+		{
+			name: "kernel services",
+			in: []Service{
+				newService("dns", &Kernel{Interface: "dummy0", Table: 100, Protocol: 200, Metric: 10, DegradedMetric: 500}, "10.0.0.53/32"),
+				newService("ntp", &Kernel{Type: "blackhole"}, "10.0.0.123/32"),
+				newService("http", &Kernel{Type: "local"}, "2001:db8::80/128"),
+			},
+		},
+		{
+			name: "kernel service without kernel section",
+			in: []Service{
+				{Name: "dns", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}, Routes: routesOf("10.0.0.53/32"), Backend: BackendKernel},
+			},
+			expError: errors.New("services: (0: (kernel: cannot be blank.).)."),
+		},
+		{
+			name: "kernel section of BGP service",
+			in: []Service{
+				{Name: "dns", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}, Routes: routesOf("10.0.0.53/32"), Kernel: &Kernel{Type: "blackhole"}},
+			},
+			expError: errors.New("services: (0: (kernel: is supported for kernel backend only.).)."),
+		},
+		{
+			name: "invalid kernel section",
+			in: []Service{
+				newService("dns", &Kernel{Type: "prohibit", Protocol: 256}, "10.0.0.53/32"),
+				newService("ntp", &Kernel{Type: "blackhole", Interface: "dummy0", Protocol: 4}, "10.0.0.123/32"),
+				newService("http", &Kernel{}, "10.0.0.80/32"),
+				newService("smtp", &Kernel{Interface: "dummy0", Protocol: 2}, "10.0.0.25/32"),
+			},
+			expError: errors.New("services: (0: (kernel: (protocol: must be no greater than 255; type: must be a valid value.).); 1: (kernel: (interface: must be blank for blackhole routes; protocol: must not be static, the routes added by the administrator would be removed.).); 2: (kernel: (interface: cannot be blank.).); 3: (kernel: (protocol: must not be a reserved protocol.).).)."),
+		},
+		{
+			name: "route shared with kernel service",
+			in: []Service{
+				newService("dns", nil, "10.0.0.53/32"),
+				newService("dns-kernel", &Kernel{Type: "blackhole"}, "10.0.0.53/32"),
+			},
+			expError: errors.New("services: route `10.0.0.53/32` is owned by `dns` and `dns-kernel` services, sharing routes is supported for BGP backend only."),
+		},
+		{
+			name: "BGP features of kernel service",
+			in: []Service{
+				func() Service {
+					svc := newService("dns", &Kernel{Type: "blackhole"}, "10.0.0.53/32")
+					svc.Peers = []string{"some_router_1"}
+					return svc
+				}(),
+			},
+			expError: errors.New("services: service `dns`: limiting routes to peers is not supported for kernel backend."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			c := &Config{
+				Announcer: Announcer{
+					RouterID:     "10.3.3.3",
+					LocalAddress: "10.0.0.1",
+					LocalASN:     65999,
+					Peers:        []Peer{{Name: "some_router_1", RemoteAddress: "10.0.0.252", RemoteASN: 65000}},
+				},
+				Services: tc.in,
+				Metrics:  Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+			}
+
+			err := c.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestKernelOnlyConfig(t *testing.T) {
+	r := require.New(t)
+
+	c := &Config{
+		Services: []Service{
+			{
+				Name:          "dns",
+				CheckInterval: th.Duration(time.Second),
+				Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+				Routes:        routesOf("10.0.0.53/32", "2001:db8::53/128"),
+				Backend:       BackendKernel,
+				Kernel:        &Kernel{Type: "blackhole"},
+			},
+		},
+		Metrics: Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+	}
+	r.False(c.BGPEnabled())
+	r.NoError(c.Validate())
+
+	c.Services = append(c.Services, Service{
+		Name:          "ntp",
+		CheckInterval: th.Duration(time.Second),
+		Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+		Routes:        routesOf("10.0.0.123/32"),
+	})
+	r.True(c.BGPEnabled())
+	r.EqualError(c.Validate(), "announcer: (local_address: cannot be blank; local_asn: cannot be blank; peers: cannot be blank; router_id: cannot be blank.); services: route `10.0.0.123/32` of `ntp` service: no local address of the same address family is configured.")
+}
+
+func TestBIRDBackendValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       []Service
+		expError error
+	}
+
+	newService := func(name string, bird *BIRD) Service {
+		return Service{
+			Name:          name,
+			CheckInterval: th.Duration(time.Second),
+			Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+			Backend:       BackendBIRD,
+			BIRD:          bird,
+		}
+	}
+
+	tcs := []testCase{
+		{
+			name: "bird services",
+			in: []Service{
+				newService("dns", &BIRD{Socket: "/run/bird/bird.ctl", Protocol: "anycast_dns", DegradedProtocol: "anycast_dns_degraded", Timeout: th.Duration(time.Second)}),
+				newService("ntp", &BIRD{Protocol: "anycast_ntp"}),
+			},
+		},
+		{
+			name: "bird service without bird section",
+			in: []Service{
+				newService("dns", nil),
+			},
+			expError: errors.New("services: (0: (bird: cannot be blank.).)."),
+		},
+		{
+			name: "bird section of BGP service",
+			in: []Service{
+				{Name: "dns", CheckInterval: th.Duration(time.Second), Checks: []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}}, Routes: routesOf("10.0.0.53/32"), BIRD: &BIRD{Protocol: "anycast_dns"}},
+			},
+			expError: errors.New("services: (0: (bird: is supported for bird backend only.).)."),
+		},
+		{
+			name: "invalid bird section",
+			in: []Service{
+				newService("dns", &BIRD{Protocol: "anycast-dns", DegradedProtocol: "1degraded"}),
+				newService("ntp", &BIRD{Protocol: "anycast_ntp", DegradedProtocol: "anycast_ntp"}),
+				newService("http", &BIRD{}),
+			},
+			expError: errors.New("services: (0: (bird: (degraded_protocol: must be a valid BIRD symbol name; protocol: must be a valid BIRD symbol name.).); 1: (bird: (degraded_protocol: must differ from protocol.).); 2: (bird: (protocol: cannot be blank.).).)."),
+		},
+		{
+			name: "protocol shared by services",
+			in: []Service{
+				newService("dns", &BIRD{Protocol: "anycast_dns", DegradedProtocol: "anycast_degraded"}),
+				newService("ntp", &BIRD{Protocol: "anycast_ntp", DegradedProtocol: "anycast_degraded"}),
+			},
+			expError: errors.New("services: BIRD protocol `anycast_degraded` is controlled by `dns` and `ntp` services."),
+		},
+		{
+			name: "BGP features of bird service",
+			in: []Service{
+				func() Service {
+					svc := newService("dns", &BIRD{Protocol: "anycast_dns"})
+					svc.DynamicMED = &DynamicMED{}
+					return svc
+				}(),
+			},
+			expError: errors.New("services: service `dns`: dynamic MED is not supported for bird backend."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			c := &Config{
+				Announcer: Announcer{
+					RouterID:     "10.3.3.3",
+					LocalAddress: "10.0.0.1",
+					LocalASN:     65999,
+					Peers:        []Peer{{Name: "some_router_1", RemoteAddress: "10.0.0.252", RemoteASN: 65000}},
+				},
+				Services: tc.in,
+				Metrics:  Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+			}
+
+			err := c.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestBIRDOnlyConfig(t *testing.T) {
+	r := require.New(t)
+
+	c := &Config{
+		Services: []Service{
+			{
+				Name:          "dns",
+				CheckInterval: th.Duration(time.Second),
+				Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+				Backend:       BackendBIRD,
+				BIRD:          &BIRD{Protocol: "anycast_dns"},
+			},
+		},
+		Metrics: Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+	}
+	r.False(c.BGPEnabled())
+	r.NoError(c.Validate())
+}
+
+func TestExaBGPYAMLConfig(t *testing.T) {
+	r := require.New(t)
+
+	cfg, err := NewFromFile("testdata/exabgp.yaml")
+	r.NoError(err)
+	r.Equal(ExaBGP{Pipe: "/run/exabgp/exabgp.in", NextHop: "10.0.0.1", LocalASN: 65999}, cfg.ExaBGP)
+	r.False(cfg.BGPEnabled())
+}
+
+func TestExaBGPBackendValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		exabgp   ExaBGP
+		in       []Service
+		expError error
+	}
+
+	newService := func(name string, routes ...string) Service {
+		return Service{
+			Name:          name,
+			CheckInterval: th.Duration(time.Second),
+			Checks:        []Check{{Kind: "test", Spec: json.RawMessage(`{}`)}},
+			Routes:        routesOf(routes...),
+			Backend:       BackendExaBGP,
+		}
+	}
+
+	tcs := []testCase{
+		{
+			name:   "exabgp services",
+			exabgp: ExaBGP{Pipe: "/run/exabgp/exabgp.in", NextHop: "10.0.0.1", LocalASN: 65999},
+			in: []Service{
+				func() Service {
+					svc := newService("dns", "10.0.0.53/32", "2001:db8::53/128")
+					svc.Degraded = Degraded{ASPathPrepend: 2, MED: 500}
+					svc.DynamicMED = &DynamicMED{Check: "latency", Buckets: []MEDBucket{{Above: th.Duration(time.Second), MED: 100}}}
+					return svc
+				}(),
+				newService("ntp", "10.0.0.123/32"),
+			},
+		},
+		{
+			name: "next hop self by default",
+			in: []Service{
+				newService("dns", "10.0.0.53/32"),
+			},
+		},
+		{
+			name:   "invalid next hop",
+			exabgp: ExaBGP{NextHop: "router"},
+			in: []Service{
+				newService("dns", "10.0.0.53/32"),
+			},
+			expError: errors.New("exabgp: (next_hop: must be either `self` or a valid IP address.)."),
+		},
+		{
+			name: "AS path prepend without local ASN",
+			in: []Service{
+				func() Service {
+					svc := newService("dns", "10.0.0.53/32")
+					svc.Degraded = Degraded{ASPathPrepend: 2}
+					return svc
+				}(),
+			},
+			expError: errors.New("exabgp: local_asn is required for AS path prepend of `dns` service."),
+		},
+		{
+			name: "route shared with exabgp service",
+			in: []Service{
+				newService("dns", "10.0.0.53/32"),
+				newService("dns-backup", "10.0.0.53/32"),
+			},
+			expError: errors.New("services: route `10.0.0.53/32` is owned by `dns` and `dns-backup` services, sharing routes is supported for BGP backend only."),
+		},
+		{
+			name: "BGP features of exabgp service",
+			in: []Service{
+				func() Service {
+					svc := newService("dns", "10.0.0.53/32")
+					svc.Peers = []string{"some_router_1"}
+					return svc
+				}(),
+			},
+			expError: errors.New("services: service `dns`: limiting routes to peers is not supported for exabgp backend."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			c := &Config{
+				Announcer: Announcer{
+					Peers: []Peer{{Name: "some_router_1", RemoteAddress: "10.0.0.252", RemoteASN: 65000}},
+				},
+				Services: tc.in,
+				ExaBGP:   tc.exabgp,
+				Metrics:  Metrics{Enabled: true, Address: "127.0.0.1:9090"},
+			}
+			r.False(c.BGPEnabled())
+
+			err := c.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestPeerBFDValidation(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       Peer
+		expError error
+	}
+
+	tcs := []testCase{
+		{
+			name: "defaults",
+			in: Peer{
+				Name:          "leaf",
+				RemoteAddress: "10.0.0.252",
+				RemoteASN:     65000,
+				BFD:           &BFD{},
+			},
+		},
+		{
+			name: "too short intervals",
+			in: Peer{
+				Name:          "leaf",
+				RemoteAddress: "10.0.0.252",
+				RemoteASN:     65000,
+				BFD: &BFD{
+					DesiredMinTxInterval:  th.Duration(time.Millisecond),
+					RequiredMinRxInterval: th.Duration(5 * time.Millisecond),
+				},
+			},
+			expError: errors.New("bfd: (desired_min_tx_interval: must be no less than 10ms; required_min_rx_interval: must be no less than 10ms.)."),
+		},
+		{
+			name: "multihop peer",
+			in: Peer{
+				Name:           "leaf",
+				RemoteAddress:  "10.0.0.252",
+				RemoteASN:      65000,
+				EnableMultihop: boolPtr(true),
+				MultihopTTL:    3,
+				BFD:            &BFD{},
+			},
+			expError: errors.New("bfd: is not supported for multihop peers."),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			err := tc.in.Validate()
+			if tc.expError == nil {
+				r.NoError(err)
+			} else {
+				r.Error(err)
+				r.Equal(tc.expError.Error(), err.Error())
+			}
+		})
+	}
+}
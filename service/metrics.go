@@ -9,15 +9,22 @@ import (
 
 type Metrics interface {
 	ServiceUp(service string)
+	ServiceDegraded(service string)
 	ServiceDown(service string)
 
+	// FailedPrefixes reports the amount of prefixes the last state change
+	// of the service is not applied to.
+	FailedPrefixes(service string, n int)
+
 	MeasureCall(ctx context.Context, service, check string, fn func(ctx context.Context) error) error
 }
 
 type metrics struct {
 	appUpGauge           *prometheus.GaugeVec
 	upGauge              *prometheus.GaugeVec
+	degradedGauge        *prometheus.GaugeVec
 	checkDurationSeconds *prometheus.GaugeVec
+	failedPrefixesGauge  *prometheus.GaugeVec
 }
 
 func NewMetrics(appVersion string) (Metrics, error) {
@@ -39,6 +46,15 @@ func NewMetrics(appVersion string) (Metrics, error) {
 		[]string{"service"},
 	)
 
+	degradedGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "anycastd",
+			Name:      "service_degraded",
+			Help:      "Service degradation status based on checks",
+		},
+		[]string{"service"},
+	)
+
 	checkDurationSeconds := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: "anycastd",
@@ -48,7 +64,16 @@ func NewMetrics(appVersion string) (Metrics, error) {
 		[]string{"service", "check"},
 	)
 
-	for _, m := range []prometheus.Collector{appUpGauge, upGauge, checkDurationSeconds} {
+	failedPrefixesGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "anycastd",
+			Name:      "service_failed_prefixes",
+			Help:      "Amount of prefixes the last service state change is not applied to",
+		},
+		[]string{"service"},
+	)
+
+	for _, m := range []prometheus.Collector{appUpGauge, upGauge, degradedGauge, checkDurationSeconds, failedPrefixesGauge} {
 		if err := prometheus.Register(m); err != nil {
 			return nil, err
 		}
@@ -59,16 +84,29 @@ func NewMetrics(appVersion string) (Metrics, error) {
 	return &metrics{
 		appUpGauge:           appUpGauge,
 		upGauge:              upGauge,
+		degradedGauge:        degradedGauge,
 		checkDurationSeconds: checkDurationSeconds,
+		failedPrefixesGauge:  failedPrefixesGauge,
 	}, nil
 }
 
 func (m *metrics) ServiceUp(service string) {
 	m.upGauge.WithLabelValues(service).Set(1.0)
+	m.degradedGauge.WithLabelValues(service).Set(0.0)
+}
+
+func (m *metrics) ServiceDegraded(service string) {
+	m.upGauge.WithLabelValues(service).Set(1.0)
+	m.degradedGauge.WithLabelValues(service).Set(1.0)
 }
 
 func (m *metrics) ServiceDown(service string) {
 	m.upGauge.WithLabelValues(service).Set(0.0)
+	m.degradedGauge.WithLabelValues(service).Set(0.0)
+}
+
+func (m *metrics) FailedPrefixes(service string, n int) {
+	m.failedPrefixesGauge.WithLabelValues(service).Set(float64(n))
 }
 
 func (m *metrics) MeasureCall(ctx context.Context, service, check string, fn func(ctx context.Context) error) error {
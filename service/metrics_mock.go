@@ -20,10 +20,18 @@ func (m *MetricsMock) ServiceUp(service string) {
 	m.Called(service)
 }
 
+func (m *MetricsMock) ServiceDegraded(service string) {
+	m.Called(service)
+}
+
 func (m *MetricsMock) ServiceDown(service string) {
 	m.Called(service)
 }
 
+func (m *MetricsMock) FailedPrefixes(service string, n int) {
+	m.Called(service, n)
+}
+
 func (m *MetricsMock) MeasureCall(ctx context.Context, service, check string, fn func(ctx context.Context) error) error {
 	m.Called(service, check)
 	return fn(ctx)
@@ -19,6 +19,17 @@ type Service interface {
 type Checker struct {
 	Check checkers.Checker
 	Group string
+
+	// Degrade makes the service degraded instead of down on check failure
+	Degrade bool
+}
+
+// MEDSource defines how MED of the service routes is computed from the
+// duration of the check of the given kind. Durations of all of the checks
+// are summed up when Check is empty.
+type MEDSource struct {
+	Check string
+	MED   *announcer.DynamicMED
 }
 
 type service struct {
@@ -28,8 +39,9 @@ type service struct {
 	interval  time.Duration
 	metrics   Metrics
 	strategy  Strategy
+	medSource *MEDSource
 
-	announced *atomic.Bool
+	state *atomic.Int32
 }
 
 func New(
@@ -39,6 +51,7 @@ func New(
 	interval time.Duration,
 	metrics Metrics,
 	strategy Strategy,
+	medSource *MEDSource,
 ) Service {
 	return &service{
 		name:      name,
@@ -47,10 +60,17 @@ func New(
 		interval:  interval,
 		metrics:   metrics,
 		strategy:  strategy,
-		announced: &atomic.Bool{},
+		medSource: medSource,
+		state:     newState(HealthDown),
 	}
 }
 
+func newState(h Health) *atomic.Int32 {
+	state := &atomic.Int32{}
+	state.Store(int32(h))
+	return state
+}
+
 func (s *service) Run(ctx context.Context) error {
 	for {
 		select {
@@ -66,42 +86,118 @@ func (s *service) Run(ctx context.Context) error {
 
 func (s *service) run(ctx context.Context) error {
 	checkResults := []CheckResult{}
+	measurement := time.Duration(0)
 	for _, check := range s.checks {
+		kind := check.Check.Kind()
+
 		result := true
-		if err := s.metrics.MeasureCall(ctx, s.name, check.Check.Kind(), check.Check.Check); err != nil {
+		start := time.Now()
+		if err := s.metrics.MeasureCall(ctx, s.name, kind, check.Check.Check); err != nil {
 			log.Warnf("check failed: %s", err)
 			result = false
 		}
+		if s.medSource != nil && (s.medSource.Check == "" || s.medSource.Check == kind) {
+			measurement += time.Since(start)
+		}
 		checkResults = append(checkResults, CheckResult{check, result})
 	}
 
-	serviceDown, err := s.strategy(checkResults)
+	if s.medSource != nil {
+		s.updateMED(ctx, measurement)
+	}
+
+	health, err := s.strategy(checkResults)
 	if err != nil {
 		return err
 	}
 
-	if serviceDown {
+	switch health {
+	case HealthDown:
 		s.metrics.ServiceDown(s.name)
-	} else {
+	case HealthDegraded:
+		s.metrics.ServiceDegraded(s.name)
+	default:
 		s.metrics.ServiceUp(s.name)
 	}
 
-	if serviceDown {
-		if s.announced.Load() {
-			if err := s.announcer.Denounce(ctx); err != nil {
-				log.Warnf("denounce failed: %s", err)
-			}
-			s.announced.Store(false)
-		}
-	} else {
-		if !s.announced.Load() {
-			if err := s.announcer.Announce(ctx); err != nil {
-				log.Warnf("announce failed: %s", err)
-			}
-		}
+	if Health(s.state.Load()) == health {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"service": s.name,
+		"from":    Health(s.state.Load()).String(),
+		"to":      health.String(),
+	}).Info("service state changed")
 
-		s.announced.Store(true)
+	// State is not stored on failure so the transition is retried on the
+	// next run.
+	if err := s.transition(ctx, health); err != nil {
+		log.WithFields(log.Fields{
+			"service": s.name,
+		}).Warnf("state change failed: %s", err)
+		return nil
 	}
 
+	s.state.Store(int32(health))
+
 	return nil
 }
+
+// transition applies the health to the announcer and reports the amount of
+// prefixes the change is not applied to.
+func (s *service) transition(ctx context.Context, health Health) error {
+	var err error
+	switch health {
+	case HealthDown:
+		err = errors.Wrap(s.announcer.Denounce(ctx), "denounce failed")
+	case HealthDegraded:
+		err = errors.Wrap(s.announcer.Degrade(ctx), "degrade failed")
+	default:
+		err = errors.Wrap(s.announcer.Announce(ctx), "announce failed")
+	}
+
+	var partialErr *announcer.PartialError
+	if !errors.As(err, &partialErr) {
+		if err == nil {
+			s.metrics.FailedPrefixes(s.name, 0)
+		}
+		return err
+	}
+
+	failed := partialErr.Failed()
+	for _, r := range failed {
+		log.WithFields(log.Fields{
+			"service": s.name,
+			"prefix":  r.Prefix,
+		}).Warnf("prefix state change failed: %s", r.Err)
+	}
+	s.metrics.FailedPrefixes(s.name, len(failed))
+
+	return err
+}
+
+// updateMED passes the measurement to the dynamic MED and sets the new MED
+// on the announcer once it's changed. The announcer re-announces the routes
+// by itself if they're announced.
+func (s *service) updateMED(ctx context.Context, measurement time.Duration) {
+	setter, ok := s.announcer.(announcer.MEDSetter)
+	if !ok {
+		return
+	}
+
+	med, changed := s.medSource.MED.Observe(measurement.Seconds())
+	if !changed {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"service":     s.name,
+		"measurement": measurement,
+		"med":         med,
+	}).Info("MED changed")
+
+	if err := setter.SetMED(ctx, med); err != nil {
+		log.Warnf("setting MED failed: %s", err)
+	}
+}
@@ -25,10 +25,11 @@ func (s *serviceTestSuite) TestRunPass() {
 
 	s.metricsM.On("ServiceUp", "test_service").Return().Once()
 	s.metricsM.On("MeasureCall", "test_service", "test_check").Return().Once()
+	s.metricsM.On("FailedPrefixes", "test_service", 0).Return().Once()
 
 	strategy, _ := GetStrategyNoOptions("")
 
-	svc := New("test_service", s.announcerM, []Checker{{s.checkM, ""}}, 1*time.Second, s.metricsM, strategy).(*service)
+	svc := New("test_service", s.announcerM, []Checker{{Check: s.checkM}}, 1*time.Second, s.metricsM, strategy, nil).(*service)
 
 	err := svc.run(s.ctx)
 	s.Require().NoError(err)
@@ -42,12 +43,38 @@ func (s *serviceTestSuite) TestRunFail() {
 	s.metricsM.On("MeasureCall", "test_service", "test_check").Return().Once()
 
 	strategy, _ := GetStrategyNoOptions("")
-	svc := New("test_service", s.announcerM, []Checker{{s.checkM, ""}}, 1*time.Second, s.metricsM, strategy).(*service)
+	svc := New("test_service", s.announcerM, []Checker{{Check: s.checkM}}, 1*time.Second, s.metricsM, strategy, nil).(*service)
 
 	err := svc.run(s.ctx)
 	s.Require().NoError(err)
 }
 
+func (s *serviceTestSuite) TestRunAnnounceFailureIsRetried() {
+	aCall1 := s.announcerM.On("Announce").Return(&announcer.PartialError{
+		Results: []announcer.PrefixResult{
+			{Prefix: "10.0.0.1/32"},
+			{Prefix: "10.0.0.2/32", Err: errors.New("error")},
+		},
+	}).Once()
+	s.announcerM.On("Announce").Return(nil).NotBefore(aCall1).Once()
+
+	s.checkM.On("Kind").Return("test_check").Times(3)
+	s.checkM.On("Check").Return(nil).Times(3)
+
+	s.metricsM.On("ServiceUp", "test_service").Return().Times(3)
+	s.metricsM.On("MeasureCall", "test_service", "test_check").Return().Times(3)
+	mCall1 := s.metricsM.On("FailedPrefixes", "test_service", 1).Return().Once()
+	s.metricsM.On("FailedPrefixes", "test_service", 0).Return().NotBefore(mCall1).Once()
+
+	strategy, _ := GetStrategyNoOptions("")
+	svc := New("test_service", s.announcerM, []Checker{{Check: s.checkM}}, 1*time.Second, s.metricsM, strategy, nil).(*service)
+
+	for i := 0; i < 3; i++ {
+		err := svc.run(s.ctx)
+		s.Require().NoError(err)
+	}
+}
+
 func (s *serviceTestSuite) TestRunPassThenFailThenPass() {
 	aCall1 := s.announcerM.On("Announce").Return(nil).Once()
 	aCall2 := s.announcerM.On("Denounce").Return(nil).NotBefore(aCall1).Once()
@@ -64,9 +91,73 @@ func (s *serviceTestSuite) TestRunPassThenFailThenPass() {
 	mCall4 := s.metricsM.On("ServiceDown", "test_service").Return().NotBefore(mCall3).Once()
 	mCall5 := s.metricsM.On("MeasureCall", "test_service", "test_check").Return().NotBefore(mCall4).Once()
 	s.metricsM.On("ServiceUp", "test_service").Return().NotBefore(mCall5).Once()
+	s.metricsM.On("FailedPrefixes", "test_service", 0).Return().Times(3)
+
+	strategy, _ := GetStrategyNoOptions("")
+	svc := New("test_service", s.announcerM, []Checker{{Check: s.checkM}}, 1*time.Second, s.metricsM, strategy, nil).(*service)
+
+	for i := 0; i < 3; i++ {
+		err := svc.run(s.ctx)
+		s.Require().NoError(err)
+	}
+}
+
+func (s *serviceTestSuite) TestRunPassThenDegradedThenFail() {
+	aCall1 := s.announcerM.On("Announce").Return(nil).Once()
+	aCall2 := s.announcerM.On("Degrade").Return(nil).NotBefore(aCall1).Once()
+	s.announcerM.On("Denounce").Return(nil).NotBefore(aCall2).Once()
+
+	degradeCheckM := checkers.NewMock()
+	degradeCheckM.On("Kind").Return("degrade_check").Times(3)
+	dCall1 := degradeCheckM.On("Check").Return(nil).Once()
+	degradeCheckM.On("Check").Return(errors.New("error")).NotBefore(dCall1).Twice()
+
+	s.checkM.On("Kind").Return("test_check").Times(3)
+	cCall1 := s.checkM.On("Check").Return(nil).Twice()
+	s.checkM.On("Check").Return(errors.New("error")).NotBefore(cCall1).Once()
+
+	s.metricsM.On("MeasureCall", "test_service", "test_check").Return().Times(3)
+	s.metricsM.On("MeasureCall", "test_service", "degrade_check").Return().Times(3)
+	mCall1 := s.metricsM.On("ServiceUp", "test_service").Return().Once()
+	mCall2 := s.metricsM.On("ServiceDegraded", "test_service").Return().NotBefore(mCall1).Once()
+	s.metricsM.On("ServiceDown", "test_service").Return().NotBefore(mCall2).Once()
+	s.metricsM.On("FailedPrefixes", "test_service", 0).Return().Times(3)
+
+	strategy, _ := GetStrategyNoOptions("")
+	svc := New("test_service", s.announcerM, []Checker{
+		{Check: s.checkM},
+		{Check: degradeCheckM, Degrade: true},
+	}, 1*time.Second, s.metricsM, strategy, nil).(*service)
+
+	for i := 0; i < 3; i++ {
+		err := svc.run(s.ctx)
+		s.Require().NoError(err)
+	}
+
+	degradeCheckM.AssertExpectations(s.T())
+}
+
+func (s *serviceTestSuite) TestRunDynamicMED() {
+	aCall1 := s.announcerM.On("SetMED", uint32(100)).Return(nil).Once()
+	aCall2 := s.announcerM.On("Announce").Return(nil).NotBefore(aCall1).Once()
+	s.announcerM.On("SetMED", uint32(500)).Return(nil).NotBefore(aCall2).Once()
+
+	s.checkM.On("Kind").Return("test_check").Times(3)
+	cCall1 := s.checkM.On("Check").Return(nil).Twice()
+	s.checkM.On("Check").Return(nil).After(10 * time.Millisecond).NotBefore(cCall1).Once()
+
+	s.metricsM.On("MeasureCall", "test_service", "test_check").Return().Times(3)
+	s.metricsM.On("ServiceUp", "test_service").Return().Times(3)
+	s.metricsM.On("FailedPrefixes", "test_service", 0).Return().Once()
 
 	strategy, _ := GetStrategyNoOptions("")
-	svc := New("test_service", s.announcerM, []Checker{{s.checkM, ""}}, 1*time.Second, s.metricsM, strategy).(*service)
+	svc := New("test_service", s.announcerM, []Checker{{Check: s.checkM}}, 1*time.Second, s.metricsM, strategy, &MEDSource{
+		Check: "test_check",
+		MED: announcer.NewDynamicMED([]announcer.MEDBucket{
+			{Above: 0, MED: 100},
+			{Above: 0.005, MED: 500},
+		}, 0.1),
+	}).(*service)
 
 	for i := 0; i < 3; i++ {
 		err := svc.run(s.ctx)
@@ -6,34 +6,90 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Health is the service state computed by strategy from check results.
+type Health int32
+
+const (
+	// HealthUp means the service is healthy and its routes are announced.
+	HealthUp Health = iota
+
+	// HealthDegraded means the service is working but its routes are
+	// announced as less preferred.
+	HealthDegraded
+
+	// HealthDown means the service is unhealthy and its routes are withdrawn.
+	HealthDown
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthUp:
+		return "up"
+	case HealthDegraded:
+		return "degraded"
+	case HealthDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
 type CheckResult struct {
 	checker Checker
 	result  bool
 }
 
-type Strategy func([]CheckResult) (bool, error)
+type Strategy func([]CheckResult) (Health, error)
+
+// withDegraded makes a strategy from the function reporting whether the
+// service is down. The function is evaluated over the checks which withdraw
+// the service on failure only, failure of any check marked to degrade the
+// service makes it degraded unless it's down.
+func withDegraded(isDown func([]CheckResult) bool) Strategy {
+	return func(results []CheckResult) (Health, error) {
+		withdrawing := []CheckResult{}
+		degraded := false
+		for _, result := range results {
+			if result.checker.Degrade {
+				degraded = degraded || !result.result
+				continue
+			}
+			withdrawing = append(withdrawing, result)
+		}
+
+		if len(withdrawing) > 0 && isDown(withdrawing) {
+			return HealthDown, nil
+		}
+
+		if degraded {
+			return HealthDegraded, nil
+		}
+
+		return HealthUp, nil
+	}
+}
 
 func All() Strategy {
-	return func(results []CheckResult) (bool, error) {
+	return withDegraded(func(results []CheckResult) bool {
 		failed := 0
 		for _, result := range results {
 			if !result.result {
 				failed += 1
 			}
 		}
-		return failed == len(results), nil
-	}
+		return failed == len(results)
+	})
 }
 
 func AtLeastOne() Strategy {
-	return func(results []CheckResult) (bool, error) {
+	return withDegraded(func(results []CheckResult) bool {
 		for _, result := range results {
 			if !result.result {
-				return true, nil
+				return true
 			}
 		}
-		return false, nil
-	}
+		return false
+	})
 }
 
 type GroupData struct {
@@ -42,7 +98,7 @@ type GroupData struct {
 }
 
 func AllInGroup() Strategy {
-	return func(results []CheckResult) (bool, error) {
+	return withDegraded(func(results []CheckResult) bool {
 		groups := make(map[string]GroupData)
 
 		for _, result := range results {
@@ -61,11 +117,11 @@ func AllInGroup() Strategy {
 		}
 		for _, groupData := range groups {
 			if groupData.total == groupData.failed {
-				return true, nil
+				return true
 			}
 		}
-		return false, nil
-	}
+		return false
+	})
 }
 
 type AtLeastNPercentageParams struct {
@@ -78,15 +134,15 @@ func AtLeastNPercentage(options json.RawMessage) (Strategy, error) {
 		return nil, err
 	}
 
-	return func(results []CheckResult) (bool, error) {
+	return withDegraded(func(results []CheckResult) bool {
 		failed := 0.0
 		for _, result := range results {
 			if !result.result {
 				failed += 1
 			}
 		}
-		return failed/float64(len(results)) > params.N, nil
-	}, nil
+		return failed/float64(len(results)) > params.N
+	}), nil
 }
 
 func GetStrategy(strategyName string, strategyOptions json.RawMessage) (Strategy, error) {
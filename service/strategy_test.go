@@ -55,12 +55,12 @@ func TestStrategies(t *testing.T) {
 		t.Run(testCase.strategy, func(t *testing.T) {
 			checkResults := []CheckResult{}
 			for i, result := range testCase.results {
-				checkResults = append(checkResults, CheckResult{Checker{checkM, testCase.groups[i]}, result})
+				checkResults = append(checkResults, CheckResult{Checker{Check: checkM, Group: testCase.groups[i]}, result})
 			}
 
-			serviceDown, err := strategy(checkResults)
+			health, err := strategy(checkResults)
 			assert.NoError(t, err)
-			assert.Equal(t, testCase.expected, serviceDown)
+			assert.Equal(t, testCase.expected, health == HealthDown)
 		})
 	}
 
@@ -82,12 +82,45 @@ func TestStrategies(t *testing.T) {
 		t.Run(testCase.strategy, func(t *testing.T) {
 			checkResults := []CheckResult{}
 			for _, result := range testCase.results {
-				checkResults = append(checkResults, CheckResult{Checker{checkM, ""}, result})
+				checkResults = append(checkResults, CheckResult{Checker{Check: checkM}, result})
 			}
 
-			serviceDown, err := strategy(checkResults)
+			health, err := strategy(checkResults)
 			assert.NoError(t, err)
-			assert.Equal(t, testCase.expected, serviceDown)
+			assert.Equal(t, testCase.expected, health == HealthDown)
+		})
+	}
+}
+
+func TestStrategiesDegraded(t *testing.T) {
+	checkM := checkers.NewMock()
+
+	tests := []struct {
+		strategy string
+		results  []bool
+		degrade  []bool
+		expected Health
+	}{
+		{"at_least_one", []bool{true, true}, []bool{false, true}, HealthUp},
+		{"at_least_one", []bool{true, false}, []bool{false, true}, HealthDegraded},
+		{"at_least_one", []bool{false, false}, []bool{false, true}, HealthDown},
+		{"at_least_one", []bool{false}, []bool{true}, HealthDegraded},
+		{"all", []bool{false, true, false}, []bool{false, false, true}, HealthDegraded},
+		{"all", []bool{false, false, false}, []bool{false, false, true}, HealthDown},
+	}
+
+	for _, testCase := range tests {
+		strategy, _ := GetStrategyNoOptions(testCase.strategy)
+
+		t.Run(testCase.strategy, func(t *testing.T) {
+			checkResults := []CheckResult{}
+			for i, result := range testCase.results {
+				checkResults = append(checkResults, CheckResult{Checker{Check: checkM, Degrade: testCase.degrade[i]}, result})
+			}
+
+			health, err := strategy(checkResults)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, health)
 		})
 	}
 }